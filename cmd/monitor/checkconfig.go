@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"network-monitor/internal/capture"
+	"network-monitor/internal/config"
+	"network-monitor/internal/monitor"
+	"os"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/google/gopacket/pcap"
+)
+
+func checkConfig() {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration is invalid: %v\n", err)
+		os.Exit(1)
+	}
+	if err := monitor.CheckConfig(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration is invalid: %v\n", err)
+		os.Exit(1)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tVALUE\tSOURCE")
+	for _, s := range cfg.Settings() {
+		value, err := json.Marshal(s.Value)
+		if err != nil {
+			value = []byte(fmt.Sprint(s.Value))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", s.Key, value, s.Source)
+	}
+	w.Flush()
+	fmt.Println()
+
+	problems := checkSources(cfg)
+	for _, problem := range problems {
+		fmt.Fprintf(os.Stderr, "Problem: %s\n", problem)
+	}
+	if len(problems) > 0 {
+		os.Exit(1)
+	}
+	fmt.Println("Configuration is valid.")
+}
+
+// checkSources verifies that the configured interfaces or capture file
+// exist on this host.
+func checkSources(cfg *config.Config) []string {
+	if cfg.ReadFile != "" {
+		if _, err := os.Stat(cfg.ReadFile); err != nil {
+			return []string{fmt.Sprintf("read_file: %v", err)}
+		}
+		return nil
+	}
+
+	devices, err := capture.Devices()
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	var problems []string
+	for _, ifCfg := range cfg.InterfaceConfigs() {
+		if ifCfg.Name == "" {
+			name, err := capture.PickDefault(devices)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("interface auto-selection: %v", err))
+				continue
+			}
+			fmt.Printf("No interface configured, auto-selection picks %s.\n", name)
+			continue
+		}
+		if !slices.ContainsFunc(devices, func(d pcap.Interface) bool { return d.Name == ifCfg.Name }) {
+			problems = append(problems, fmt.Sprintf("interface %s not found (see list-interfaces)", ifCfg.Name))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"network-monitor/internal/capture"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/google/gopacket/pcap"
+	"github.com/spf13/pflag"
+)
+
+func listInterfaces() {
+	pflag.Parse()
+
+	devices, err := capture.Devices()
+	if err != nil {
+		log.Fatalf("Failed to list interfaces: %v", err)
+	}
+	if len(devices) == 0 {
+		fmt.Println("No capture devices found. Capturing usually needs root or the cap_net_raw capability.")
+		return
+	}
+	picked, pickErr := capture.PickDefault(devices)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\tNAME\tADDRESSES\tDESCRIPTION")
+	for _, device := range devices {
+		mark := ""
+		if device.Name == picked {
+			mark = "*"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", mark, device.Name, formatAddresses(device.Addresses), device.Description)
+	}
+	w.Flush()
+
+	if pickErr != nil {
+		fmt.Printf("\nAuto-selection would fail: %v\n", pickErr)
+	} else {
+		fmt.Printf("\n* is used when no interface is configured.\n")
+	}
+}
+
+func formatAddresses(addrs []pcap.InterfaceAddress) string {
+	var parts []string
+	for _, addr := range addrs {
+		if addr.IP == nil {
+			continue
+		}
+		if ones, bits := addr.Netmask.Size(); bits > 0 {
+			parts = append(parts, fmt.Sprintf("%s/%d", addr.IP, ones))
+		} else {
+			parts = append(parts, addr.IP.String())
+		}
+	}
+	if len(parts) == 0 {
+		return "-"
+	}
+	return strings.Join(parts, ", ")
+}
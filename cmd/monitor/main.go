@@ -1,42 +1,61 @@
 package main
 
 import (
-	"log"
-	"network-monitor/internal/config"
-	"network-monitor/internal/monitor"
+	"fmt"
 	"os"
-	"os/signal"
-	"syscall"
-)
+	"path/filepath"
+	"strings"
 
-func main() {
+	"github.com/spf13/pflag"
+)
 
-	log.Println("Starting network monitor...")
+type command struct {
+	name    string
+	summary string
+	run     func()
+}
 
-	cfg, err := config.LoadConfig()
-	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
-	}
+var commands = []command{
+	{"run", "Capture traffic and send alerts (the default)", runMonitor},
+	{"top", "Show live per-host rates in the terminal", runTop},
+	{"list-interfaces", "List capture devices and the one auto-selection picks", listInterfaces},
+	{"check-config", "Validate the configuration and print the effective settings", checkConfig},
+	{"test-notify", "Send a sample alert through every configured notifier", testNotify},
+}
 
-	log.Printf("Loaded Configuration: Interface='%s', Threshold=%.2f Mbps, Interval=%ds, Webhook Set: %t, TopN: %d",
-		cfg.InterfaceName, cfg.ThresholdMbps, cfg.IntervalSeconds, cfg.WebhookURL != "", cfg.TopN)
+func main() {
+	pflag.Usage = usage
 
-	m, err := monitor.NewMonitor(cfg)
-	if err != nil {
-		log.Fatalf("Failed to initialize monitor: %v", err)
+	name := "run"
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		name = os.Args[1]
+		os.Args = append(os.Args[:1], os.Args[2:]...)
 	}
 
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-
-	go m.Run()
-
-	log.Println("Monitor started. Press Ctrl+C to stop.")
-
-	<-sigChan
-
-	log.Println("Shutdown signal received, stopping monitor...")
-	m.Close()
+	if name == "help" {
+		usage()
+		return
+	}
+	for _, c := range commands {
+		if c.name == name {
+			c.run()
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+	usage()
+	os.Exit(2)
+}
 
-	log.Println("Monitor stopped gracefully.")
+func usage() {
+	prog := filepath.Base(os.Args[0])
+	fmt.Fprintf(os.Stderr, "Usage: %s [command] [flags]\n\nCommands:\n", prog)
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nWithout a command, run is assumed. Run '%s <command> --help' to list its flags.\n", prog)
+	if pflag.CommandLine.HasFlags() {
+		fmt.Fprintln(os.Stderr, "\nFlags:")
+		pflag.PrintDefaults()
+	}
 }
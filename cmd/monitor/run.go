@@ -0,0 +1,92 @@
+package main
+
+import (
+	"log"
+	"network-monitor/internal/config"
+	"network-monitor/internal/monitor"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func runMonitor() {
+	log.Println("Starting network monitor...")
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	log.Printf("Loaded Configuration: Interface='%s', Threshold=%.2f Mbps, Interval=%ds, Webhook Set: %t, Notifiers: %d, TopN: %d",
+		cfg.InterfaceName, cfg.ThresholdMbps, cfg.IntervalSeconds, cfg.WebhookURL != "", len(cfg.Notifiers), cfg.TopN)
+	for _, iface := range cfg.Interfaces {
+		log.Printf("Configured Interface: Name='%s', Threshold=%.2f Mbps", iface.Name, iface.ThresholdMbps)
+	}
+	if cfg.ReadFile != "" {
+		log.Printf("Replaying capture file '%s' (speed: %.2fx, 0 = as fast as possible)", cfg.ReadFile, cfg.ReplaySpeed)
+	}
+
+	m, err := monitor.NewMonitor(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize monitor: %v", err)
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+
+	// Reload requests are coalesced; editors often write a file several
+	// times in quick succession.
+	reloadChan := make(chan struct{}, 1)
+	requestReload := func() {
+		select {
+		case reloadChan <- struct{}{}:
+		default:
+		}
+	}
+	if config.Watch(requestReload) {
+		log.Println("Watching the config file for changes.")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		m.Run()
+		close(done)
+	}()
+
+	log.Println("Monitor started. Press Ctrl+C to stop.")
+
+loop:
+	for {
+		select {
+		case <-sigChan:
+			log.Println("Shutdown signal received, stopping monitor...")
+			break loop
+		case <-done:
+			log.Println("Packet source finished, stopping monitor...")
+			break loop
+		case <-hupChan:
+			log.Println("SIGHUP received.")
+			requestReload()
+		case <-reloadChan:
+			reloadConfig(m)
+		}
+	}
+	m.Close()
+
+	log.Println("Monitor stopped gracefully.")
+}
+
+func reloadConfig(m *monitor.Monitor) {
+	log.Println("Reloading configuration...")
+	cfg, err := config.Reload()
+	if err != nil {
+		log.Printf("Configuration reload failed, keeping the current configuration: %v", err)
+		return
+	}
+	if err := m.ApplyConfig(cfg); err != nil {
+		log.Printf("Configuration reload failed, keeping the current configuration: %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"network-monitor/internal/config"
+	"network-monitor/internal/notify"
+	"os"
+	"time"
+)
+
+func testNotify() {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	notifiers, err := notify.New(cfg)
+	if err != nil {
+		log.Fatalf("Failed to set up notifiers: %v", err)
+	}
+	if len(notifiers) == 0 {
+		log.Fatalf("No notifiers are configured; set webhook_url or notifiers.")
+	}
+
+	name := cfg.InterfaceConfigs()[0].Name
+	if name == "" {
+		name = "default"
+	}
+	event := notify.SampleEvent(name+" (test)", cfg.ThresholdMbps, cfg.IntervalSeconds, time.Now())
+
+	failed := 0
+	for _, n := range notifiers {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err := n.Notify(ctx, event)
+		cancel()
+		if err != nil {
+			failed++
+			fmt.Printf("%s: failed: %v\n", n.Name(), err)
+			continue
+		}
+		fmt.Printf("%s: sent\n", n.Name())
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"log"
+	"network-monitor/internal/config"
+	"network-monitor/internal/monitor"
+	"network-monitor/internal/top"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+func runTop() {
+	refresh := pflag.Duration("refresh", 500*time.Millisecond, "How often the top view is refreshed")
+	sortKey := pflag.String("sort", string(top.SortTotal), "Initial sort column of the top view: total, rx, tx, bytes or host")
+	history := pflag.Int("history", 60, "Number of refreshes shown in the top view sparklines")
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	key, err := top.ParseSortKey(*sortKey)
+	if err != nil {
+		log.Fatalf("Invalid --sort: %v", err)
+	}
+	if *refresh <= 0 {
+		log.Fatalf("Invalid --refresh: must be positive")
+	}
+	if *history <= 0 {
+		log.Fatalf("Invalid --history: must be positive")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	err = monitor.RunTop(ctx, cfg, top.Options{Refresh: *refresh, Sort: key, History: *history})
+	if err != nil {
+		log.Printf("top: %v", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,138 @@
+package alert
+
+import "time"
+
+type Kind string
+
+const (
+	KindInit              Kind = "init"
+	KindThresholdExceeded Kind = "threshold_exceeded"
+	KindBelowThreshold    Kind = "below_threshold"
+	KindNoTraffic         Kind = "no_traffic"
+	KindRule              Kind = "rule"
+	KindResolved          Kind = "resolved"
+	KindSummary           Kind = "summary"
+)
+
+type Talker struct {
+	IP        string  `json:"ip"`
+	SpeedMbps float64 `json:"speed_mbps"`
+	RxMbps    float64 `json:"rx_mbps"`
+	TxMbps    float64 `json:"tx_mbps"`
+	Hostname  string  `json:"hostname,omitempty"`
+	// Processes names the local programs behind the host's traffic, busiest
+	// first, when process attribution is enabled.
+	Processes []string `json:"processes,omitempty"`
+	// Country (ISO code) and AS come from the GeoIP databases.
+	Country        string `json:"country,omitempty"`
+	ASN            uint   `json:"asn,omitempty"`
+	ASOrganization string `json:"as_organization,omitempty"`
+}
+
+type Flow struct {
+	Description string  `json:"flow"`
+	SpeedMbps   float64 `json:"speed_mbps"`
+	SrcIP       string  `json:"src_ip,omitempty"`
+	DstIP       string  `json:"dst_ip,omitempty"`
+	// SrcHost and DstHost are the hostnames of the ends, if known.
+	SrcHost string `json:"src_host,omitempty"`
+	DstHost string `json:"dst_host,omitempty"`
+	// ServerName is the TLS SNI or HTTP Host requested on the connection. It
+	// is also used as the hostname of the server end.
+	ServerName string `json:"server_name,omitempty"`
+	// Process owns the local end of the flow, if known.
+	Process string `json:"process,omitempty"`
+	// Country and AS of the remote end, from the GeoIP databases.
+	Country        string `json:"country,omitempty"`
+	ASN            uint   `json:"asn,omitempty"`
+	ASOrganization string `json:"as_organization,omitempty"`
+}
+
+// Breach describes a single threshold that was crossed. Direction is
+// "total", "rx" or "tx".
+type Breach struct {
+	Direction     string  `json:"direction"`
+	SpeedMbps     float64 `json:"speed_mbps"`
+	ThresholdMbps float64 `json:"threshold_mbps"`
+}
+
+// RuleBreach describes a configured rule. Value, Threshold and Peak are in
+// the unit of Metric ("mbps", "bytes" or "pps").
+type RuleBreach struct {
+	Name       string  `json:"name"`
+	Match      string  `json:"match"`
+	Metric     string  `json:"metric"`
+	Comparison string  `json:"comparison"`
+	Value      float64 `json:"value"`
+	Threshold  float64 `json:"threshold"`
+	Peak       float64 `json:"peak"`
+}
+
+// Summary is the traffic of one interface over the period of a KindSummary
+// event. The period can be longer than the captured time, e.g. if the
+// monitor was started during it.
+type Summary struct {
+	From       time.Time `json:"from"`
+	To         time.Time `json:"to"`
+	TotalBytes int64     `json:"total_bytes"`
+	RxBytes    int64     `json:"rx_bytes"`
+	TxBytes    int64     `json:"tx_bytes"`
+	Packets    int64     `json:"packets"`
+}
+
+// Event is what gets handed to notifiers. Fields that do not apply to a
+// given Kind are left at their zero value.
+type Event struct {
+	Kind            Kind      `json:"kind"`
+	Interface       string    `json:"interface"`
+	Time            time.Time `json:"time"`
+	IntervalSeconds int       `json:"interval_seconds"`
+	ThresholdMbps   float64   `json:"threshold_mbps,omitempty"`
+	SpeedMbps       float64   `json:"speed_mbps"`
+	RxMbps          float64   `json:"rx_mbps"`
+	TxMbps          float64   `json:"tx_mbps"`
+	Breaches        []Breach  `json:"breaches,omitempty"`
+	TopTalkers      []Talker  `json:"top_talkers,omitempty"`
+	TopFlows        []Flow    `json:"top_flows,omitempty"`
+
+	// Duration is how long the condition has been (or was) breached and
+	// PeakMbps the most extreme speed seen in that time (the lowest for
+	// below-threshold alerts).
+	Duration time.Duration `json:"duration,omitempty"`
+	PeakMbps float64       `json:"peak_mbps,omitempty"`
+
+	// ResolvedKind is the kind of alert a KindResolved event clears.
+	ResolvedKind Kind `json:"resolved_kind,omitempty"`
+
+	// Rule is set for KindRule events and for resolved rule alerts.
+	Rule *RuleBreach `json:"rule,omitempty"`
+
+	// Summary is set for KindSummary events. Their speeds are averages over
+	// Duration, the captured time, and PeakMbps is the busiest interval.
+	Summary *Summary `json:"summary,omitempty"`
+}
+
+// Severity ranks how urgent an event is.
+type Severity string
+
+const (
+	SeverityCritical Severity = "critical"
+	SeverityWarning  Severity = "warning"
+	SeverityInfo     Severity = "info"
+)
+
+// Severity returns how urgent the event is. Resolved events have the
+// severity of the alert they clear, so they reach the same people.
+func (e Event) Severity() Severity {
+	kind := e.Kind
+	if kind == KindResolved {
+		kind = e.ResolvedKind
+	}
+	switch kind {
+	case KindThresholdExceeded, KindNoTraffic, KindRule:
+		return SeverityCritical
+	case KindBelowThreshold:
+		return SeverityWarning
+	}
+	return SeverityInfo
+}
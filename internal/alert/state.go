@@ -0,0 +1,248 @@
+package alert
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type State string
+
+const (
+	StateInactive State = "inactive"
+	StatePending  State = "pending"
+	StateFiring   State = "firing"
+)
+
+type Transition string
+
+const (
+	TransitionNone     Transition = "none"
+	TransitionPending  Transition = "pending"
+	TransitionFiring   Transition = "firing"
+	TransitionRenotify Transition = "renotify"
+	TransitionResolved Transition = "resolved"
+)
+
+// Policy controls when a breached condition turns into a notification.
+type Policy struct {
+	// ForIntervals is the number of consecutive breaching intervals required
+	// before an alert fires. Values below 1 are treated as 1.
+	ForIntervals int
+
+	// Cooldown is the minimum time between two firing notifications for the
+	// same alert, whether it stays firing or flaps.
+	Cooldown time.Duration
+}
+
+// Condition is one evaluation of an alert. The alert breaches when Value is
+// above Threshold and, once firing, only resolves when Value drops to
+// ClearThreshold or below. A ClearThreshold of zero means Threshold.
+//
+// Below inverts the comparison: the alert breaches when Value is under
+// Threshold and resolves once it is back at ClearThreshold or above.
+type Condition struct {
+	Key            string
+	Value          float64
+	Threshold      float64
+	ClearThreshold float64
+	Below          bool
+
+	// ForIntervals overrides Policy.ForIntervals when positive.
+	ForIntervals int
+}
+
+func (c Condition) breached() bool {
+	if c.Below {
+		return c.Value < c.Threshold
+	}
+	return c.Value > c.Threshold
+}
+
+func (c Condition) cleared() bool {
+	clearAt := c.ClearThreshold
+	if c.Below {
+		if clearAt < c.Threshold {
+			clearAt = c.Threshold
+		}
+		return c.Value >= clearAt
+	}
+	if clearAt <= 0 || clearAt > c.Threshold {
+		clearAt = c.Threshold
+	}
+	return c.Value <= clearAt
+}
+
+// worse reports whether v is further into breach than the current peak.
+func (c Condition) worse(v, peak float64) bool {
+	if c.Below {
+		return v < peak
+	}
+	return v > peak
+}
+
+type Status struct {
+	Key          string    `json:"key"`
+	State        State     `json:"state"`
+	Since        time.Time `json:"since"`
+	LastNotified time.Time `json:"last_notified"`
+	Consecutive  int       `json:"consecutive"`
+	// PeakValue is the most extreme value seen while breached: the highest
+	// for normal conditions and the lowest for Below conditions.
+	PeakValue float64 `json:"peak_value"`
+	LastValue float64 `json:"last_value"`
+	Threshold float64 `json:"threshold"`
+	notified  bool
+}
+
+type Result struct {
+	Transition Transition
+	// Notify reports whether the transition should be sent to notifiers.
+	Notify bool
+	Status Status
+}
+
+type Tracker struct {
+	mu     sync.Mutex
+	policy Policy
+	alerts map[string]*Status
+}
+
+func NewTracker(policy Policy) *Tracker {
+	if policy.ForIntervals < 1 {
+		policy.ForIntervals = 1
+	}
+	return &Tracker{
+		policy: policy,
+		alerts: make(map[string]*Status),
+	}
+}
+
+func (t *Tracker) SetPolicy(policy Policy) {
+	if policy.ForIntervals < 1 {
+		policy.ForIntervals = 1
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.policy = policy
+}
+
+func (t *Tracker) Evaluate(c Condition, now time.Time) Result {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	forIntervals := t.policy.ForIntervals
+	if c.ForIntervals > 0 {
+		forIntervals = c.ForIntervals
+	}
+
+	s, exists := t.alerts[c.Key]
+	if !exists {
+		s = &Status{Key: c.Key, State: StateInactive}
+		t.alerts[c.Key] = s
+	}
+	s.LastValue = c.Value
+	s.Threshold = c.Threshold
+
+	breached := c.breached()
+	result := Result{Transition: TransitionNone}
+
+	switch s.State {
+	case StateInactive:
+		if !breached {
+			break
+		}
+		s.Since = now
+		s.Consecutive = 1
+		s.PeakValue = c.Value
+		s.notified = false
+		if s.Consecutive >= forIntervals {
+			result = t.fire(s, now)
+		} else {
+			s.State = StatePending
+			result.Transition = TransitionPending
+		}
+
+	case StatePending:
+		if !breached {
+			s.State = StateInactive
+			s.Consecutive = 0
+			break
+		}
+		s.Consecutive++
+		if c.worse(c.Value, s.PeakValue) {
+			s.PeakValue = c.Value
+		}
+		if s.Consecutive >= forIntervals {
+			result = t.fire(s, now)
+		}
+
+	case StateFiring:
+		if c.worse(c.Value, s.PeakValue) {
+			s.PeakValue = c.Value
+		}
+		if c.cleared() {
+			result.Transition = TransitionResolved
+			result.Notify = s.notified
+			result.Status = *s
+			s.State = StateInactive
+			s.Consecutive = 0
+			s.notified = false
+			return result
+		}
+		s.Consecutive++
+		if t.cooledDown(s, now) {
+			s.LastNotified = now
+			s.notified = true
+			result.Transition = TransitionRenotify
+			result.Notify = true
+		}
+	}
+
+	result.Status = *s
+	return result
+}
+
+func (t *Tracker) fire(s *Status, now time.Time) Result {
+	s.State = StateFiring
+	result := Result{Transition: TransitionFiring}
+	if t.cooledDown(s, now) {
+		s.LastNotified = now
+		s.notified = true
+		result.Notify = true
+	}
+	return result
+}
+
+func (t *Tracker) cooledDown(s *Status, now time.Time) bool {
+	return s.LastNotified.IsZero() || now.Sub(s.LastNotified) >= t.policy.Cooldown
+}
+
+// Retain drops every alert whose key keep rejects, e.g. after the rule or
+// interface it belonged to was removed.
+func (t *Tracker) Retain(keep func(key string) bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key := range t.alerts {
+		if !keep(key) {
+			delete(t.alerts, key)
+		}
+	}
+}
+
+// Active returns the alerts that are currently pending or firing, sorted by key.
+func (t *Tracker) Active() []Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var active []Status
+	for _, s := range t.alerts {
+		if s.State != StateInactive {
+			active = append(active, *s)
+		}
+	}
+	sort.Slice(active, func(i, j int) bool {
+		return active[i].Key < active[j].Key
+	})
+	return active
+}
@@ -0,0 +1,114 @@
+package alert
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var start = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func at(i int) time.Time {
+	return start.Add(time.Duration(i) * time.Minute)
+}
+
+func TestTrackerFiresAfterConsecutiveIntervals(t *testing.T) {
+	tracker := NewTracker(Policy{ForIntervals: 3})
+	c := Condition{Key: "eth0/total", Value: 150, Threshold: 100}
+
+	assert.Equal(t, TransitionPending, tracker.Evaluate(c, at(0)).Transition)
+	assert.Equal(t, TransitionNone, tracker.Evaluate(c, at(1)).Transition)
+
+	res := tracker.Evaluate(c, at(2))
+	assert.Equal(t, TransitionFiring, res.Transition)
+	assert.True(t, res.Notify)
+	assert.Equal(t, at(0), res.Status.Since)
+
+	// A single good interval while pending starts the count over.
+	tracker = NewTracker(Policy{ForIntervals: 2})
+	tracker.Evaluate(c, at(0))
+	tracker.Evaluate(Condition{Key: c.Key, Value: 50, Threshold: 100}, at(1))
+	assert.Equal(t, TransitionPending, tracker.Evaluate(c, at(2)).Transition)
+	assert.Equal(t, TransitionFiring, tracker.Evaluate(c, at(3)).Transition)
+}
+
+func TestTrackerHysteresis(t *testing.T) {
+	tracker := NewTracker(Policy{ForIntervals: 1, Cooldown: time.Hour})
+	c := Condition{Key: "eth0/total", Threshold: 100, ClearThreshold: 80}
+
+	c.Value = 120
+	assert.Equal(t, TransitionFiring, tracker.Evaluate(c, at(0)).Transition)
+
+	c.Value = 90
+	assert.Equal(t, TransitionNone, tracker.Evaluate(c, at(1)).Transition)
+	assert.Len(t, tracker.Active(), 1)
+
+	c.Value = 80
+	res := tracker.Evaluate(c, at(2))
+	assert.Equal(t, TransitionResolved, res.Transition)
+	assert.True(t, res.Notify)
+	assert.Equal(t, 120.0, res.Status.PeakValue)
+	assert.Empty(t, tracker.Active())
+}
+
+func TestTrackerCooldown(t *testing.T) {
+	tracker := NewTracker(Policy{ForIntervals: 1, Cooldown: 10 * time.Minute})
+	high := Condition{Key: "eth0/total", Value: 150, Threshold: 100}
+	low := Condition{Key: "eth0/total", Value: 10, Threshold: 100}
+
+	assert.True(t, tracker.Evaluate(high, at(0)).Notify)
+	assert.False(t, tracker.Evaluate(high, at(5)).Notify)
+
+	res := tracker.Evaluate(high, at(10))
+	assert.Equal(t, TransitionRenotify, res.Transition)
+	assert.True(t, res.Notify)
+
+	// Flapping within the cooldown fires silently and resolves silently.
+	assert.True(t, tracker.Evaluate(low, at(11)).Notify)
+	res = tracker.Evaluate(high, at(12))
+	assert.Equal(t, TransitionFiring, res.Transition)
+	assert.False(t, res.Notify)
+	res = tracker.Evaluate(low, at(13))
+	assert.Equal(t, TransitionResolved, res.Transition)
+	assert.False(t, res.Notify)
+}
+
+func TestTrackerBelowCondition(t *testing.T) {
+	tracker := NewTracker(Policy{ForIntervals: 1, Cooldown: time.Hour})
+	c := Condition{Key: "eth0/no_traffic", Threshold: 1, Below: true, ForIntervals: 2}
+
+	c.Value = 0
+	assert.Equal(t, TransitionPending, tracker.Evaluate(c, at(0)).Transition)
+	res := tracker.Evaluate(c, at(1))
+	assert.Equal(t, TransitionFiring, res.Transition)
+	assert.Equal(t, 0.0, res.Status.PeakValue)
+
+	c.Value = 12
+	res = tracker.Evaluate(c, at(2))
+	assert.Equal(t, TransitionResolved, res.Transition)
+	assert.True(t, res.Notify)
+
+	low := Condition{Key: "eth0/below", Threshold: 10, Below: true}
+	low.Value = 4
+	tracker.Evaluate(low, at(0))
+	low.Value = 2
+	tracker.Evaluate(low, at(1))
+	low.Value = 6
+	res = tracker.Evaluate(low, at(2))
+	assert.Equal(t, TransitionNone, res.Transition)
+	assert.Equal(t, 2.0, res.Status.PeakValue, "peak tracks the lowest value for Below conditions")
+}
+
+func TestTrackerRetain(t *testing.T) {
+	tracker := NewTracker(Policy{ForIntervals: 1})
+	tracker.Evaluate(Condition{Key: "eth0/total", Value: 150, Threshold: 100}, at(0))
+	tracker.Evaluate(Condition{Key: "eth0/rule/nas", Value: 150, Threshold: 100}, at(0))
+
+	tracker.Retain(func(key string) bool { return key == "eth0/total" })
+
+	active := tracker.Active()
+	require.Len(t, active, 1)
+	assert.Equal(t, "eth0/total", active[0].Key)
+}
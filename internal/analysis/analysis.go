@@ -1,8 +1,10 @@
 package analysis
 
 import (
+	"fmt"
 	"log"
 	"net"
+	"strings"
 	"sync"
 	"time"
 
@@ -12,50 +14,137 @@ import (
 
 type ConfigForAggregator struct {
 	IntervalSeconds int
+
+	// Interval overrides IntervalSeconds when set, which allows sub-second
+	// intervals.
+	Interval time.Duration
+
+	// UsePacketTime drives interval boundaries from packet capture timestamps
+	// instead of the wall clock. It is used when replaying capture files.
+	UsePacketTime bool
+
+	// LocalNetworks are the addresses and networks considered local when
+	// classifying packet direction.
+	LocalNetworks []*net.IPNet
+
+	FlowIdleTimeout   time.Duration
+	FlowActiveTimeout time.Duration
+	MaxFlows          int
+
+	// Observers are given every packet before it is aggregated.
+	Observers []PacketObserver
 }
 
+// PacketObserver inspects captured packets, e.g. to learn hostnames from DNS
+// responses. It is called from the packet processing goroutine and must not
+// block.
+type PacketObserver interface {
+	ObservePacket(packet gopacket.Packet)
+}
+
+type Direction string
+
+const (
+	DirectionRx      Direction = "rx"
+	DirectionTx      Direction = "tx"
+	DirectionLocal   Direction = "local"
+	DirectionTransit Direction = "transit"
+)
+
+// TrafficData holds per-host counters for an interval. Bytes counts every
+// packet the host sent; RxBytes and TxBytes only count traffic crossing the
+// local network boundary and are therefore only set for local hosts.
 type TrafficData struct {
-	Bytes int64
+	Bytes   int64
+	RxBytes int64
+	TxBytes int64
+}
+
+type IntervalResult struct {
+	Start    time.Time
+	Duration time.Duration
+	Hosts    map[string]*TrafficData
+	RxBytes  int64
+	TxBytes  int64
+	Flows    []FlowRecord
+
+	// Packets counts every packet received in the interval, including ones
+	// that were not IP and therefore not attributed to a host.
+	Packets int64
+}
+
+func (r *IntervalResult) TotalBytes() int64 {
+	total := int64(0)
+	for _, data := range r.Hosts {
+		total += data.Bytes
+	}
+	return total
 }
 
 type Aggregator struct {
-	mu           sync.RWMutex
-	intervalData map[string]*TrafficData
-	interval     time.Duration
-	ticker       *time.Ticker
-	stopChan     chan struct{}
-	resultsChan  chan map[string]*TrafficData
+	mu            sync.RWMutex
+	intervalData  map[string]*TrafficData
+	intervalRx    int64
+	intervalTx    int64
+	intervalPkts  int64
+	intervalStart time.Time
+	localNetworks []*net.IPNet
+	flows         *flowTable
+	interval      time.Duration
+	usePacketTime bool
+	ticker        *time.Ticker
+	stopChan      chan struct{}
+	stopOnce      sync.Once
+	// resultsChan holds one result, so the interval closed by Stop is kept
+	// when the consumer has caught up but is not waiting at that moment.
+	resultsChan  chan *IntervalResult
 	packetSource *gopacket.PacketSource
+	observers    []PacketObserver
 	log          *log.Logger
 }
 
-func NewAggregator(cfg *ConfigForAggregator, packetSource *gopacket.PacketSource, logger *log.Logger) (*Aggregator, chan map[string]*TrafficData) {
+func NewAggregator(cfg *ConfigForAggregator, packetSource *gopacket.PacketSource, logger *log.Logger) (*Aggregator, chan *IntervalResult) {
 	if logger == nil {
 		logger = log.Default()
 	}
-	if cfg.IntervalSeconds <= 0 {
-		logger.Println("Warning: IntervalSeconds is zero or negative, defaulting to 5 seconds.")
-		cfg.IntervalSeconds = 5
+	interval := cfg.Interval
+	if interval <= 0 {
+		if cfg.IntervalSeconds <= 0 {
+			logger.Println("Warning: IntervalSeconds is zero or negative, defaulting to 5 seconds.")
+			cfg.IntervalSeconds = 5
+		}
+		interval = time.Duration(cfg.IntervalSeconds) * time.Second
 	}
-	interval := time.Duration(cfg.IntervalSeconds) * time.Second
 	agg := &Aggregator{
-		intervalData: make(map[string]*TrafficData),
-		interval:     interval,
-		ticker:       time.NewTicker(interval),
-		stopChan:     make(chan struct{}),
-		resultsChan:  make(chan map[string]*TrafficData),
-		packetSource: packetSource,
-		log:          logger,
-	}
-	go agg.run()
-	go agg.processPackets()
+		intervalData:  make(map[string]*TrafficData),
+		interval:      interval,
+		usePacketTime: cfg.UsePacketTime,
+		localNetworks: cfg.LocalNetworks,
+		flows:         newFlowTable(cfg.FlowIdleTimeout, cfg.FlowActiveTimeout, cfg.MaxFlows),
+		stopChan:      make(chan struct{}),
+		resultsChan:   make(chan *IntervalResult, 1),
+		packetSource:  packetSource,
+		observers:     cfg.Observers,
+		log:           logger,
+	}
+	if agg.usePacketTime {
+		go agg.processPacketsByTimestamp()
+	} else {
+		agg.intervalStart = time.Now()
+		agg.ticker = time.NewTicker(interval)
+		go agg.run()
+		go agg.processPackets()
+	}
 	return agg, agg.resultsChan
 }
 
 func (a *Aggregator) Stop() {
-	close(a.stopChan)
-	a.ticker.Stop()
-
+	a.stopOnce.Do(func() {
+		close(a.stopChan)
+	})
+	if a.ticker != nil {
+		a.ticker.Stop()
+	}
 }
 
 func (a *Aggregator) processPackets() {
@@ -68,22 +157,112 @@ func (a *Aggregator) processPackets() {
 			if !ok {
 				a.log.Println("Packet source channel closed.")
 
-				close(a.stopChan)
+				a.stopOnce.Do(func() {
+					close(a.stopChan)
+				})
+				return
+			}
+			a.aggregatePacket(packet)
+		}
+	}
+}
+
+func (a *Aggregator) processPacketsByTimestamp() {
+	defer close(a.resultsChan)
+	var lastPacket time.Time
+	// flush closes the interval the capture ends in. Its rate is over the
+	// time actually covered.
+	flush := func() {
+		if a.intervalStart.IsZero() {
+			return
+		}
+		elapsed := lastPacket.Sub(a.intervalStart)
+		if elapsed <= 0 {
+			elapsed = a.interval
+		}
+		a.processInterval(a.intervalStart.Add(elapsed), elapsed)
+	}
+	for {
+		select {
+		case <-a.stopChan:
+			a.log.Println("Stopping packet processing.")
+			flush()
+			return
+		case packet, ok := <-a.packetSource.Packets():
+			if !ok {
+				a.log.Println("Packet source exhausted.")
+				flush()
 				return
 			}
+
+			ts := packet.Metadata().Timestamp
+			if a.intervalStart.IsZero() {
+				a.intervalStart = ts
+			}
+			if !ts.Before(a.intervalStart.Add(a.interval)) {
+				a.processInterval(a.intervalStart.Add(a.interval), a.interval)
+				if !ts.Before(a.intervalStart.Add(a.interval)) {
+					// Nothing was captured in between; skip to the interval
+					// of the packet, keeping the boundaries aligned.
+					skipped := ts.Sub(a.intervalStart) / a.interval
+					a.mu.Lock()
+					a.intervalStart = a.intervalStart.Add(skipped * a.interval)
+					a.mu.Unlock()
+				}
+			}
+			lastPacket = ts
 			a.aggregatePacket(packet)
 		}
 	}
 }
 
+func (a *Aggregator) isLocal(ip net.IP) bool {
+	for _, network := range a.localNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *Aggregator) classify(srcIP, dstIP net.IP) Direction {
+	srcLocal, dstLocal := a.isLocal(srcIP), a.isLocal(dstIP)
+	switch {
+	case srcLocal && dstLocal:
+		return DirectionLocal
+	case srcLocal:
+		return DirectionTx
+	case dstLocal:
+		return DirectionRx
+	default:
+		return DirectionTransit
+	}
+}
+
+func (a *Aggregator) host(ip string) *TrafficData {
+	data, exists := a.intervalData[ip]
+	if !exists {
+		data = &TrafficData{}
+		a.intervalData[ip] = data
+	}
+	return data
+}
+
 func (a *Aggregator) aggregatePacket(packet gopacket.Packet) {
-	var srcIP net.IP
+	for _, o := range a.observers {
+		o.ObservePacket(packet)
+	}
+
+	var srcIP, dstIP net.IP
 	var packetSize int
+	var protocol string
 
 	ip4Layer := packet.Layer(layers.LayerTypeIPv4)
 	if ip4Layer != nil {
 		ip4, _ := ip4Layer.(*layers.IPv4)
 		srcIP = ip4.SrcIP
+		dstIP = ip4.DstIP
+		protocol = ip4.Protocol.String()
 		packetSize = len(ip4.Payload) + len(ip4.BaseLayer.Contents)
 	} else {
 
@@ -91,6 +270,8 @@ func (a *Aggregator) aggregatePacket(packet gopacket.Packet) {
 		if ip6Layer != nil {
 			ip6, _ := ip6Layer.(*layers.IPv6)
 			srcIP = ip6.SrcIP
+			dstIP = ip6.DstIP
+			protocol = ip6.NextHeader.String()
 			packetSize = len(ip6.Payload) + len(ip6.BaseLayer.Contents)
 
 			if packet.Metadata() != nil {
@@ -101,71 +282,150 @@ func (a *Aggregator) aggregatePacket(packet gopacket.Packet) {
 	}
 
 	if srcIP == nil || packetSize == 0 {
+		a.mu.Lock()
+		a.intervalPkts++
+		a.mu.Unlock()
 		return
 	}
 
-	srcIPStr := srcIP.String()
+	size := int64(packetSize)
+	direction := a.classify(srcIP, dstIP)
+
+	key := FlowKey{SrcIP: srcIP.String(), DstIP: dstIP.String(), Protocol: protocol}
+	var flags uint8
+	var payload []byte
+	switch transport := packet.TransportLayer().(type) {
+	case *layers.TCP:
+		key.SrcPort, key.DstPort, key.Protocol = uint16(transport.SrcPort), uint16(transport.DstPort), "TCP"
+		flags = tcpFlags(transport)
+		payload = transport.Payload
+	case *layers.UDP:
+		key.SrcPort, key.DstPort, key.Protocol = uint16(transport.SrcPort), uint16(transport.DstPort), "UDP"
+	}
+
+	ts := time.Now()
+	if md := packet.Metadata(); md != nil && !md.Timestamp.IsZero() {
+		ts = md.Timestamp
+	}
 
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	data, exists := a.intervalData[srcIPStr]
-	if !exists {
-		data = &TrafficData{}
-		a.intervalData[srcIPStr] = data
+	a.intervalPkts++
+	a.host(key.SrcIP).Bytes += size
+	a.flows.add(key, direction, size, flags, payload, ts)
+
+	switch direction {
+	case DirectionTx:
+		a.host(key.SrcIP).TxBytes += size
+		a.intervalTx += size
+	case DirectionRx:
+		a.host(key.DstIP).RxBytes += size
+		a.intervalRx += size
 	}
-	data.Bytes += int64(packetSize)
 }
 
 func (a *Aggregator) run() {
 	defer close(a.resultsChan)
 	for {
 		select {
-		case <-a.ticker.C:
-			a.processInterval()
+		case now := <-a.ticker.C:
+			a.processInterval(now, a.interval)
 		case <-a.stopChan:
 			a.log.Println("Stopping aggregator ticker.")
 
-			a.processInterval()
+			a.processInterval(time.Now(), a.interval)
 			return
 		}
 	}
 }
 
-func (a *Aggregator) processInterval() {
+// processInterval closes the current interval at end and publishes its
+// snapshot, with rates over duration. The next interval starts at end.
+func (a *Aggregator) processInterval(end time.Time, duration time.Duration) {
 	a.mu.Lock()
 
-	intervalSnapshot := make(map[string]*TrafficData, len(a.intervalData))
-	totalBytes := int64(0)
+	result := &IntervalResult{
+		Start:    a.intervalStart,
+		Duration: duration,
+		Hosts:    make(map[string]*TrafficData, len(a.intervalData)),
+		RxBytes:  a.intervalRx,
+		TxBytes:  a.intervalTx,
+		Flows:    a.flows.export(end),
+		Packets:  a.intervalPkts,
+	}
 	for ip, data := range a.intervalData {
-		intervalSnapshot[ip] = &TrafficData{Bytes: data.Bytes}
-		totalBytes += data.Bytes
+		copied := *data
+		result.Hosts[ip] = &copied
 	}
 
 	a.intervalData = make(map[string]*TrafficData)
+	a.intervalRx = 0
+	a.intervalTx = 0
+	a.intervalPkts = 0
+	a.intervalStart = end
+	droppedFlows := a.flows.dropped
+	a.flows.dropped = 0
 	a.mu.Unlock()
 
-	intervalSeconds := float64(a.interval.Seconds())
-	if intervalSeconds <= 0 {
-		intervalSeconds = 1
+	if droppedFlows > 0 {
+		a.log.Printf("Warning: flow table full (%d flows), %d packets were not attributed to a flow.", a.flows.maxFlows, droppedFlows)
 	}
 
-	overallSpeedMbps := (float64(totalBytes) * 8) / (intervalSeconds * 1_000_000)
+	totalBytes := result.TotalBytes()
+	overallSpeedMbps := CalculateSpeedMbps(totalBytes, result.Duration)
 
-	a.log.Printf("Interval finished. Total Bytes: %d, Overall Speed: %.2f Mbps\n", totalBytes, overallSpeedMbps)
+	a.log.Printf("Interval finished. Total Bytes: %d, Overall Speed: %.2f Mbps (rx: %.2f Mbps, tx: %.2f Mbps)\n",
+		totalBytes, overallSpeedMbps, CalculateSpeedMbps(result.RxBytes, result.Duration), CalculateSpeedMbps(result.TxBytes, result.Duration))
 
+	// The result is kept whenever there is room for it, even when the
+	// aggregator is being stopped.
+	select {
+	case a.resultsChan <- result:
+		return
+	default:
+	}
 	select {
-	case a.resultsChan <- intervalSnapshot:
+	case a.resultsChan <- result:
 
 	case <-a.stopChan:
 
 		a.log.Println("Aggregator stopping, discarding last interval result.")
-	default:
+	}
 
-		a.resultsChan <- intervalSnapshot
+}
 
+// ParseNetworks parses a list of CIDRs or bare IP addresses into networks.
+// Bare addresses are treated as single-host networks.
+func ParseNetworks(values []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address %q", value)
+			}
+			networks = append(networks, HostNetwork(ip))
+			continue
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", value, err)
+		}
+		networks = append(networks, network)
 	}
+	return networks, nil
+}
 
+func HostNetwork(ip net.IP) *net.IPNet {
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
 }
 
 func CalculateSpeedMbps(bytes int64, interval time.Duration) float64 {
@@ -0,0 +1,295 @@
+package analysis
+
+import (
+	"io"
+	"log"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testPacket struct {
+	ts      time.Time
+	srcIP   string
+	dstIP   string
+	payload int
+}
+
+type sliceSource struct {
+	packets [][]byte
+	infos   []gopacket.CaptureInfo
+	// block, if set, holds back the end of the capture until it is closed.
+	block chan struct{}
+}
+
+func (s *sliceSource) ReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	if len(s.packets) == 0 {
+		if s.block != nil {
+			<-s.block
+		}
+		return nil, gopacket.CaptureInfo{}, io.EOF
+	}
+	data, ci := s.packets[0], s.infos[0]
+	s.packets, s.infos = s.packets[1:], s.infos[1:]
+	return data, ci, nil
+}
+
+func newTestSource(t *testing.T, packets []testPacket) *gopacket.PacketSource {
+	t.Helper()
+	return gopacket.NewPacketSource(testPackets(t, packets), layers.LinkTypeEthernet)
+}
+
+func testPackets(t *testing.T, packets []testPacket) *sliceSource {
+	t.Helper()
+	src := &sliceSource{}
+	for _, p := range packets {
+		eth := &layers.Ethernet{
+			SrcMAC:       net.HardwareAddr{0, 0, 0, 0, 0, 1},
+			DstMAC:       net.HardwareAddr{0, 0, 0, 0, 0, 2},
+			EthernetType: layers.EthernetTypeIPv4,
+		}
+		ip := &layers.IPv4{
+			Version:  4,
+			TTL:      64,
+			Protocol: layers.IPProtocolUDP,
+			SrcIP:    net.ParseIP(p.srcIP).To4(),
+			DstIP:    net.ParseIP(p.dstIP).To4(),
+		}
+		udp := &layers.UDP{SrcPort: 40000, DstPort: 53}
+		require.NoError(t, udp.SetNetworkLayerForChecksum(ip))
+
+		buf := gopacket.NewSerializeBuffer()
+		opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+		err := gopacket.SerializeLayers(buf, opts, eth, ip, udp, gopacket.Payload(make([]byte, p.payload)))
+		require.NoError(t, err)
+
+		data := buf.Bytes()
+		src.packets = append(src.packets, data)
+		src.infos = append(src.infos, gopacket.CaptureInfo{
+			Timestamp:     p.ts,
+			CaptureLength: len(data),
+			Length:        len(data),
+		})
+	}
+	return src
+}
+
+func collectResults(t *testing.T, results chan *IntervalResult) []*IntervalResult {
+	t.Helper()
+	var out []*IntervalResult
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case r, ok := <-results:
+			if !ok {
+				return out
+			}
+			out = append(out, r)
+		case <-timeout:
+			t.Fatal("timed out waiting for aggregator results")
+		}
+	}
+}
+
+func TestAggregatorPacketTimeIntervals(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	source := newTestSource(t, []testPacket{
+		{ts: base, srcIP: "10.0.0.1", dstIP: "10.0.0.2", payload: 100},
+		{ts: base.Add(2 * time.Second), srcIP: "10.0.0.1", dstIP: "10.0.0.2", payload: 100},
+		{ts: base.Add(3 * time.Second), srcIP: "10.0.0.3", dstIP: "10.0.0.2", payload: 50},
+		{ts: base.Add(12 * time.Second), srcIP: "10.0.0.3", dstIP: "10.0.0.2", payload: 10},
+	})
+
+	agg, results := NewAggregator(&ConfigForAggregator{IntervalSeconds: 5, UsePacketTime: true}, source, log.New(io.Discard, "", 0))
+	defer agg.Stop()
+
+	got := collectResults(t, results)
+	require.Len(t, got, 2, "the quiet interval between 5s and 10s is skipped")
+
+	const headers = 20 + 8
+	assert.Equal(t, base, got[0].Start)
+	assert.Equal(t, 5*time.Second, got[0].Duration)
+	require.Contains(t, got[0].Hosts, "10.0.0.1")
+	require.Contains(t, got[0].Hosts, "10.0.0.3")
+	assert.Equal(t, int64(2*(100+headers)), got[0].Hosts["10.0.0.1"].Bytes)
+	assert.Equal(t, int64(50+headers), got[0].Hosts["10.0.0.3"].Bytes)
+	assert.Equal(t, int64(3), got[0].Packets)
+
+	assert.Equal(t, base.Add(10*time.Second), got[1].Start)
+	assert.Equal(t, int64(10+headers), got[1].TotalBytes())
+}
+
+func TestAggregatorPacketTimeGap(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	source := newTestSource(t, []testPacket{
+		{ts: base, srcIP: "10.0.0.1", dstIP: "10.0.0.2", payload: 100},
+		{ts: base.Add(3*time.Hour + 11*time.Second), srcIP: "10.0.0.1", dstIP: "10.0.0.2", payload: 100},
+	})
+
+	agg, results := NewAggregator(&ConfigForAggregator{IntervalSeconds: 5, UsePacketTime: true}, source, log.New(io.Discard, "", 0))
+	defer agg.Stop()
+
+	got := collectResults(t, results)
+	require.Len(t, got, 2, "a gap yields no intervals")
+	assert.Equal(t, base, got[0].Start)
+	assert.Equal(t, 5*time.Second, got[0].Duration)
+	assert.Equal(t, base.Add(3*time.Hour+10*time.Second), got[1].Start, "intervals stay aligned to the first packet")
+	assert.Equal(t, int64(1), got[1].Packets)
+	assert.Equal(t, time.Second, got[1].Duration, "the last interval only covers the capture")
+	require.Len(t, got[1].Flows, 1)
+}
+
+func TestAggregatorStopFlushesLastInterval(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	src := testPackets(t, []testPacket{
+		{ts: base, srcIP: "10.0.0.1", dstIP: "10.0.0.2", payload: 100},
+		{ts: base.Add(3*time.Hour + 2*time.Second), srcIP: "10.0.0.1", dstIP: "10.0.0.2", payload: 100},
+	})
+	// The capture stays open until the aggregator is stopped.
+	src.block = make(chan struct{})
+	defer close(src.block)
+
+	observer := &signalObserver{after: 2, seen: make(chan struct{})}
+	agg, results := NewAggregator(&ConfigForAggregator{
+		IntervalSeconds: 5,
+		UsePacketTime:   true,
+		Observers:       []PacketObserver{observer},
+	}, gopacket.NewPacketSource(src, layers.LinkTypeEthernet), log.New(io.Discard, "", 0))
+
+	<-observer.seen
+	first := <-results
+	assert.Equal(t, base, first.Start)
+	agg.Stop()
+
+	got := collectResults(t, results)
+	require.Len(t, got, 1)
+	last := got[0]
+	assert.Equal(t, base.Add(3*time.Hour), last.Start)
+	assert.Equal(t, 2*time.Second, last.Duration, "the interval ends at the last packet, not where it started")
+	require.Len(t, last.Flows, 1)
+}
+
+func TestCalculateSpeedMbps(t *testing.T) {
+	assert.Equal(t, 8.0, CalculateSpeedMbps(1_000_000, time.Second))
+	assert.Equal(t, 0.8, CalculateSpeedMbps(1_000_000, 10*time.Second))
+	assert.Equal(t, 0.0, CalculateSpeedMbps(1_000_000, 0))
+}
+
+func TestAggregatorDirectionAccounting(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	source := newTestSource(t, []testPacket{
+		{ts: base, srcIP: "192.168.1.10", dstIP: "1.1.1.1", payload: 100},
+		{ts: base.Add(time.Second), srcIP: "1.1.1.1", dstIP: "192.168.1.10", payload: 1000},
+		{ts: base.Add(2 * time.Second), srcIP: "192.168.1.10", dstIP: "192.168.1.20", payload: 500},
+		{ts: base.Add(3 * time.Second), srcIP: "8.8.8.8", dstIP: "1.1.1.1", payload: 10},
+	})
+
+	localNetworks, err := ParseNetworks([]string{"192.168.1.0/24"})
+	require.NoError(t, err)
+
+	agg, results := NewAggregator(&ConfigForAggregator{
+		IntervalSeconds: 5,
+		UsePacketTime:   true,
+		LocalNetworks:   localNetworks,
+	}, source, log.New(io.Discard, "", 0))
+	defer agg.Stop()
+
+	got := collectResults(t, results)
+	require.Len(t, got, 1)
+
+	const headers = 20 + 8
+	result := got[0]
+	assert.Equal(t, int64(100+headers), result.TxBytes)
+	assert.Equal(t, int64(1000+headers), result.RxBytes)
+
+	local := result.Hosts["192.168.1.10"]
+	require.NotNil(t, local)
+	assert.Equal(t, int64(100+headers+500+headers), local.Bytes)
+	assert.Equal(t, int64(100+headers), local.TxBytes)
+	assert.Equal(t, int64(1000+headers), local.RxBytes)
+
+	remote := result.Hosts["1.1.1.1"]
+	require.NotNil(t, remote)
+	assert.Equal(t, int64(1000+headers), remote.Bytes)
+	assert.Zero(t, remote.RxBytes)
+	assert.Zero(t, remote.TxBytes)
+
+	peer := result.Hosts["192.168.1.20"]
+	assert.Nil(t, peer, "local-to-local traffic must not be counted as rx")
+}
+
+func TestParseNetworks(t *testing.T) {
+	networks, err := ParseNetworks([]string{"10.0.0.0/8", " 192.168.1.1 ", "2001:db8::/32", ""})
+	require.NoError(t, err)
+	require.Len(t, networks, 3)
+	assert.Equal(t, "10.0.0.0/8", networks[0].String())
+	assert.Equal(t, "192.168.1.1/32", networks[1].String())
+	assert.Equal(t, "2001:db8::/32", networks[2].String())
+
+	_, err = ParseNetworks([]string{"not-a-network"})
+	assert.Error(t, err)
+}
+
+func TestAggregatorSubSecondInterval(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	source := newTestSource(t, []testPacket{
+		{ts: base, srcIP: "10.0.0.1", dstIP: "10.0.0.2", payload: 100},
+		{ts: base.Add(300 * time.Millisecond), srcIP: "10.0.0.1", dstIP: "10.0.0.2", payload: 100},
+		{ts: base.Add(700 * time.Millisecond), srcIP: "10.0.0.1", dstIP: "10.0.0.2", payload: 100},
+	})
+
+	agg, results := NewAggregator(&ConfigForAggregator{IntervalSeconds: 5, Interval: 500 * time.Millisecond, UsePacketTime: true}, source, log.New(io.Discard, "", 0))
+	defer agg.Stop()
+
+	got := collectResults(t, results)
+	require.Len(t, got, 2)
+	assert.Equal(t, 500*time.Millisecond, got[0].Duration)
+	assert.Equal(t, int64(2), got[0].Packets)
+	assert.Equal(t, int64(1), got[1].Packets)
+}
+
+type countingObserver struct {
+	packets int
+}
+
+func (o *countingObserver) ObservePacket(packet gopacket.Packet) {
+	o.packets++
+}
+
+// signalObserver closes seen once it has observed after packets.
+type signalObserver struct {
+	after int
+	seen  chan struct{}
+}
+
+func (o *signalObserver) ObservePacket(packet gopacket.Packet) {
+	o.after--
+	if o.after == 0 {
+		close(o.seen)
+	}
+}
+
+func TestAggregatorObservers(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	source := newTestSource(t, []testPacket{
+		{ts: base, srcIP: "10.0.0.1", dstIP: "10.0.0.2", payload: 100},
+		{ts: base.Add(time.Second), srcIP: "10.0.0.2", dstIP: "10.0.0.1", payload: 100},
+	})
+
+	observer := &countingObserver{}
+	agg, results := NewAggregator(&ConfigForAggregator{
+		IntervalSeconds: 5,
+		UsePacketTime:   true,
+		Observers:       []PacketObserver{observer},
+	}, source, log.New(io.Discard, "", 0))
+	defer agg.Stop()
+
+	got := collectResults(t, results)
+	require.Len(t, got, 1)
+	assert.Equal(t, 2, observer.packets)
+}
@@ -0,0 +1,209 @@
+package analysis
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	DefaultFlowIdleTimeout   = 60 * time.Second
+	DefaultFlowActiveTimeout = 30 * time.Minute
+	DefaultMaxFlows          = 100000
+)
+
+const (
+	TCPFlagFIN uint8 = 1 << iota
+	TCPFlagSYN
+	TCPFlagRST
+	TCPFlagPSH
+	TCPFlagACK
+	TCPFlagURG
+	TCPFlagECE
+	TCPFlagCWR
+)
+
+// FlowKey identifies a unidirectional flow by its 5-tuple.
+type FlowKey struct {
+	SrcIP    string
+	DstIP    string
+	SrcPort  uint16
+	DstPort  uint16
+	Protocol string
+}
+
+func (k FlowKey) String() string {
+	src, dst := k.SrcIP, k.DstIP
+	if k.SrcPort != 0 || k.DstPort != 0 {
+		src = net.JoinHostPort(k.SrcIP, strconv.Itoa(int(k.SrcPort)))
+		dst = net.JoinHostPort(k.DstIP, strconv.Itoa(int(k.DstPort)))
+	}
+	return fmt.Sprintf("%s → %s %s", src, dst, k.Protocol)
+}
+
+func (k FlowKey) reverse() FlowKey {
+	return FlowKey{SrcIP: k.DstIP, DstIP: k.SrcIP, SrcPort: k.DstPort, DstPort: k.SrcPort, Protocol: k.Protocol}
+}
+
+// FlowRecord is the per-interval export of a flow. Bytes and Packets cover
+// the interval only; TotalBytes and TotalPackets cover the flow's lifetime.
+// ServerName is the TLS SNI or HTTP Host the client of a TCP connection asked
+// for, set on both directions; ServerIP is the address it belongs to.
+type FlowRecord struct {
+	Key          FlowKey
+	Direction    Direction
+	Bytes        int64
+	Packets      int64
+	TotalBytes   int64
+	TotalPackets int64
+	FirstSeen    time.Time
+	LastSeen     time.Time
+	TCPFlags     uint8
+	ServerName   string
+	ServerIP     string
+}
+
+type flowEntry struct {
+	record          FlowRecord
+	intervalBytes   int64
+	intervalPackets int64
+	// inspected counts the payload packets searched for a server name.
+	inspected int
+}
+
+type flowTable struct {
+	flows         map[FlowKey]*flowEntry
+	idleTimeout   time.Duration
+	activeTimeout time.Duration
+	maxFlows      int
+	dropped       int64
+}
+
+func newFlowTable(idleTimeout, activeTimeout time.Duration, maxFlows int) *flowTable {
+	if idleTimeout <= 0 {
+		idleTimeout = DefaultFlowIdleTimeout
+	}
+	if activeTimeout <= 0 {
+		activeTimeout = DefaultFlowActiveTimeout
+	}
+	if maxFlows <= 0 {
+		maxFlows = DefaultMaxFlows
+	}
+	return &flowTable{
+		flows:         make(map[FlowKey]*flowEntry),
+		idleTimeout:   idleTimeout,
+		activeTimeout: activeTimeout,
+		maxFlows:      maxFlows,
+	}
+}
+
+func (t *flowTable) add(key FlowKey, direction Direction, size int64, flags uint8, payload []byte, ts time.Time) {
+	entry, exists := t.flows[key]
+	if !exists {
+		if len(t.flows) >= t.maxFlows {
+			t.dropped++
+			return
+		}
+		entry = &flowEntry{record: FlowRecord{Key: key, Direction: direction, FirstSeen: ts}}
+		if reverse, ok := t.flows[key.reverse()]; ok {
+			entry.record.ServerName = reverse.record.ServerName
+			entry.record.ServerIP = reverse.record.ServerIP
+		}
+		t.flows[key] = entry
+	}
+	if key.Protocol == "TCP" && len(payload) > 0 && entry.record.ServerName == "" && entry.inspected < maxServerNamePayloads {
+		entry.inspected++
+		if name := serverName(payload); name != "" {
+			t.setServerName(key, entry, name)
+		}
+	}
+	entry.record.TotalBytes += size
+	entry.record.TotalPackets++
+	entry.record.TCPFlags |= flags
+	if ts.After(entry.record.LastSeen) {
+		entry.record.LastSeen = ts
+	}
+	entry.intervalBytes += size
+	entry.intervalPackets++
+}
+
+// setServerName names the server end of the connection, which is the
+// destination of the flow the client's request was seen on.
+func (t *flowTable) setServerName(key FlowKey, entry *flowEntry, name string) {
+	entry.record.ServerName, entry.record.ServerIP = name, key.DstIP
+	if reverse, ok := t.flows[key.reverse()]; ok && reverse.record.ServerName == "" {
+		reverse.record.ServerName, reverse.record.ServerIP = name, key.DstIP
+	}
+}
+
+// export returns the flows that saw traffic since the last export and
+// expires flows that are idle, finished (FIN/RST) or have exceeded the
+// active timeout. Expired flows start a new record on their next packet.
+func (t *flowTable) export(now time.Time) []FlowRecord {
+	var records []FlowRecord
+	for key, entry := range t.flows {
+		if entry.intervalPackets > 0 {
+			record := entry.record
+			record.Bytes = entry.intervalBytes
+			record.Packets = entry.intervalPackets
+			records = append(records, record)
+			entry.intervalBytes = 0
+			entry.intervalPackets = 0
+		}
+
+		switch {
+		case now.Sub(entry.record.LastSeen) >= t.idleTimeout:
+		case now.Sub(entry.record.FirstSeen) >= t.activeTimeout:
+		case entry.record.TCPFlags&(TCPFlagFIN|TCPFlagRST) != 0:
+		default:
+			continue
+		}
+		delete(t.flows, key)
+	}
+	return records
+}
+
+func tcpFlags(tcp *layers.TCP) uint8 {
+	var flags uint8
+	if tcp.FIN {
+		flags |= TCPFlagFIN
+	}
+	if tcp.SYN {
+		flags |= TCPFlagSYN
+	}
+	if tcp.RST {
+		flags |= TCPFlagRST
+	}
+	if tcp.PSH {
+		flags |= TCPFlagPSH
+	}
+	if tcp.ACK {
+		flags |= TCPFlagACK
+	}
+	if tcp.URG {
+		flags |= TCPFlagURG
+	}
+	if tcp.ECE {
+		flags |= TCPFlagECE
+	}
+	if tcp.CWR {
+		flags |= TCPFlagCWR
+	}
+	return flags
+}
+
+// TopFlows returns the n flows with the most bytes in the interval.
+func TopFlows(flows []FlowRecord, n int) []FlowRecord {
+	sorted := append([]FlowRecord(nil), flows...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Bytes > sorted[j].Bytes
+	})
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
@@ -0,0 +1,74 @@
+package analysis
+
+import (
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregatorExportsFlows(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	source := newTestSource(t, []testPacket{
+		{ts: base, srcIP: "10.0.0.5", dstIP: "1.2.3.4", payload: 100},
+		{ts: base.Add(time.Second), srcIP: "10.0.0.5", dstIP: "1.2.3.4", payload: 100},
+		{ts: base.Add(2 * time.Second), srcIP: "1.2.3.4", dstIP: "10.0.0.5", payload: 10},
+		{ts: base.Add(6 * time.Second), srcIP: "10.0.0.5", dstIP: "1.2.3.4", payload: 100},
+	})
+
+	agg, results := NewAggregator(&ConfigForAggregator{IntervalSeconds: 5, UsePacketTime: true}, source, log.New(io.Discard, "", 0))
+	defer agg.Stop()
+
+	got := collectResults(t, results)
+	require.Len(t, got, 2)
+
+	const headers = 20 + 8
+	require.Len(t, got[0].Flows, 2)
+	top := TopFlows(got[0].Flows, 1)
+	require.Len(t, top, 1)
+	assert.Equal(t, FlowKey{SrcIP: "10.0.0.5", DstIP: "1.2.3.4", SrcPort: 40000, DstPort: 53, Protocol: "UDP"}, top[0].Key)
+	assert.Equal(t, "10.0.0.5:40000 → 1.2.3.4:53 UDP", top[0].Key.String())
+	assert.Equal(t, int64(2*(100+headers)), top[0].Bytes)
+	assert.Equal(t, int64(2), top[0].Packets)
+	assert.Equal(t, base, top[0].FirstSeen)
+	assert.Equal(t, base.Add(time.Second), top[0].LastSeen)
+
+	require.Len(t, got[1].Flows, 1)
+	assert.Equal(t, int64(100+headers), got[1].Flows[0].Bytes)
+	assert.Equal(t, int64(3*(100+headers)), got[1].Flows[0].TotalBytes)
+	assert.Equal(t, base, got[1].Flows[0].FirstSeen)
+}
+
+func TestFlowTableTimeouts(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	table := newFlowTable(10*time.Second, time.Minute, 2)
+
+	idle := FlowKey{SrcIP: "10.0.0.1", DstIP: "10.0.0.2", SrcPort: 1, DstPort: 2, Protocol: "UDP"}
+	closed := FlowKey{SrcIP: "10.0.0.1", DstIP: "10.0.0.2", SrcPort: 3, DstPort: 4, Protocol: "TCP"}
+	overflow := FlowKey{SrcIP: "10.0.0.1", DstIP: "10.0.0.2", SrcPort: 5, DstPort: 6, Protocol: "UDP"}
+
+	table.add(idle, DirectionLocal, 100, 0, nil, base)
+	table.add(closed, DirectionLocal, 100, TCPFlagSYN, nil, base)
+	table.add(overflow, DirectionLocal, 100, 0, nil, base)
+	assert.Equal(t, int64(1), table.dropped)
+
+	table.add(closed, DirectionLocal, 100, TCPFlagFIN|TCPFlagACK, nil, base.Add(time.Second))
+	records := table.export(base.Add(5 * time.Second))
+	assert.Len(t, records, 2)
+	assert.NotContains(t, table.flows, closed, "finished TCP flows are expired after export")
+	assert.Contains(t, table.flows, idle)
+
+	records = table.export(base.Add(10 * time.Second))
+	assert.Empty(t, records)
+	assert.NotContains(t, table.flows, idle, "idle flows are expired")
+
+	table.add(idle, DirectionLocal, 100, 0, nil, base.Add(11*time.Second))
+	for i := 1; i <= 6; i++ {
+		table.add(idle, DirectionLocal, 100, 0, nil, base.Add(time.Duration(11+i*9)*time.Second))
+	}
+	table.export(base.Add(71 * time.Second))
+	assert.NotContains(t, table.flows, idle, "flows are restarted after the active timeout")
+}
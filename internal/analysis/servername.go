@@ -0,0 +1,204 @@
+package analysis
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// maxServerNamePayloads is how many payload packets of a TCP flow are
+// searched for a server name before giving up. The ClientHello or request
+// line is normally the first one; the margin covers a leading empty segment
+// or a retransmission.
+const maxServerNamePayloads = 3
+
+var httpMethods = [][]byte{
+	[]byte("GET "), []byte("POST "), []byte("HEAD "), []byte("PUT "), []byte("DELETE "),
+	[]byte("OPTIONS "), []byte("PATCH "), []byte("CONNECT "),
+}
+
+// serverName returns the name a client asked for in the first bytes of a TCP
+// stream: the SNI of a TLS ClientHello or the Host header of an HTTP/1.x
+// request. Payloads cut short by the snapshot length are parsed as far as
+// they go.
+func serverName(payload []byte) string {
+	var name string
+	switch {
+	case len(payload) > 5 && payload[0] == 0x16:
+		name = tlsServerName(payload)
+	case isHTTPRequest(payload):
+		name = httpHost(payload)
+	}
+	return validServerName(name)
+}
+
+func tlsServerName(payload []byte) string {
+	// Record header (5), handshake header (4), client version (2), random (32).
+	r := reader(payload[5:])
+	if handshake, ok := r.byte(); !ok || handshake != 0x01 {
+		return ""
+	}
+	if !r.skip(3 + 2 + 32) {
+		return ""
+	}
+	sessionID, ok := r.vector(1)
+	if !ok || len(sessionID) > 32 {
+		return ""
+	}
+	if _, ok := r.vector(2); !ok { // cipher suites
+		return ""
+	}
+	if _, ok := r.vector(1); !ok { // compression methods
+		return ""
+	}
+	// The extensions may be truncated, so walk whatever was captured rather
+	// than insisting on the declared length.
+	if !r.skip(2) {
+		return ""
+	}
+	for {
+		extType, ok := r.uint16()
+		if !ok {
+			return ""
+		}
+		ext, ok := r.vector(2)
+		if !ok {
+			return ""
+		}
+		if extType == 0 {
+			return sniHostName(ext)
+		}
+	}
+}
+
+func sniHostName(ext []byte) string {
+	r := reader(ext)
+	list, ok := r.vector(2)
+	if !ok {
+		return ""
+	}
+	r = reader(list)
+	for {
+		nameType, ok := r.byte()
+		if !ok {
+			return ""
+		}
+		name, ok := r.vector(2)
+		if !ok {
+			return ""
+		}
+		if nameType == 0 {
+			return string(name)
+		}
+	}
+}
+
+func isHTTPRequest(payload []byte) bool {
+	for _, method := range httpMethods {
+		if bytes.HasPrefix(payload, method) {
+			return true
+		}
+	}
+	return false
+}
+
+func httpHost(payload []byte) string {
+	lines := bytes.Split(payload, []byte("\r\n"))
+	// The last line may be cut off by the snapshot length; skip the request
+	// line and stop at the end of the headers.
+	if len(lines) < 3 {
+		return ""
+	}
+	for _, line := range lines[1 : len(lines)-1] {
+		if len(line) == 0 {
+			break
+		}
+		name, value, ok := bytes.Cut(line, []byte(":"))
+		if !ok || !strings.EqualFold(string(name), "host") {
+			continue
+		}
+		host := strings.TrimSpace(string(value))
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		return host
+	}
+	return ""
+}
+
+// validServerName lowercases name and rejects anything that is not a
+// plausible DNS name, including IP literals, which add nothing to the flow.
+func validServerName(name string) string {
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	if name == "" || len(name) > 253 {
+		return ""
+	}
+	if _, err := netip.ParseAddr(name); err == nil {
+		return ""
+	}
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '-', c == '.', c == '_':
+		default:
+			return ""
+		}
+	}
+	return name
+}
+
+// reader consumes big-endian TLS fields, reporting false once the data runs
+// out.
+type reader []byte
+
+func (r *reader) byte() (byte, bool) {
+	if len(*r) < 1 {
+		return 0, false
+	}
+	b := (*r)[0]
+	*r = (*r)[1:]
+	return b, true
+}
+
+func (r *reader) uint16() (uint16, bool) {
+	if len(*r) < 2 {
+		return 0, false
+	}
+	v := binary.BigEndian.Uint16(*r)
+	*r = (*r)[2:]
+	return v, true
+}
+
+func (r *reader) skip(n int) bool {
+	if len(*r) < n {
+		return false
+	}
+	*r = (*r)[n:]
+	return true
+}
+
+// vector reads a field prefixed by a lengthBytes-wide length.
+func (r *reader) vector(lengthBytes int) ([]byte, bool) {
+	var n int
+	switch lengthBytes {
+	case 1:
+		b, ok := r.byte()
+		if !ok {
+			return nil, false
+		}
+		n = int(b)
+	case 2:
+		v, ok := r.uint16()
+		if !ok {
+			return nil, false
+		}
+		n = int(v)
+	}
+	if len(*r) < n {
+		return nil, false
+	}
+	v := (*r)[:n]
+	*r = (*r)[n:]
+	return v, true
+}
@@ -0,0 +1,84 @@
+package analysis
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// clientHello returns the first record a TLS client sends for serverName.
+func clientHello(t *testing.T, serverName string) []byte {
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		conn := tls.Client(client, &tls.Config{ServerName: serverName, InsecureSkipVerify: true})
+		_ = conn.Handshake()
+		client.Close()
+	}()
+
+	buf := make([]byte, 16384)
+	require.NoError(t, server.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, err := server.Read(buf)
+	require.NoError(t, err)
+	return buf[:n]
+}
+
+func TestServerNameTLS(t *testing.T) {
+	hello := clientHello(t, "Video.Example.com")
+	assert.Equal(t, "video.example.com", serverName(hello))
+	assert.Empty(t, serverName(hello[:60]), "cut off before the extensions")
+	assert.Empty(t, serverName(clientHello(t, "")), "no SNI")
+
+	// A hello whose SNI sits after an extension larger than the snapshot.
+	record := []byte{0x16, 0x03, 0x01, 0x10, 0x00, 0x01, 0x00, 0x10, 0x00, 0x03, 0x03}
+	record = append(record, make([]byte, 32)...)
+	record = append(record, 0x00, 0x00, 0x02, 0x13, 0x01, 0x01, 0x00, 0x10, 0x00)
+	record = append(record, 0x00, 0x15, 0x08, 0x00)
+	record = append(record, make([]byte, 900)...)
+	assert.Empty(t, serverName(record))
+}
+
+func TestServerNameHTTP(t *testing.T) {
+	request := "GET /index.html HTTP/1.1\r\nUser-Agent: curl\r\nhost: www.example.com:8080\r\nAccept: */*\r\n\r\n"
+	assert.Equal(t, "www.example.com", serverName([]byte(request)))
+	assert.Empty(t, serverName([]byte("GET / HTTP/1.1\r\nHost: 192.0.2.1\r\n\r\n")), "IP literals are not names")
+	assert.Empty(t, serverName([]byte("GET / HTTP/1.1\r\nAccept: */*\r\n\r\nHost: late.example.com\r\n")), "only headers count")
+	assert.Empty(t, serverName([]byte("GET / HTTP/1.1\r\nHost: www.exam")), "truncated header")
+	assert.Empty(t, serverName([]byte("GET /index.html HTTP/1.1")), "request line only")
+	assert.Empty(t, serverName([]byte("HTTP/1.1 200 OK\r\nHost: www.example.com\r\n\r\n")), "responses are ignored")
+}
+
+func TestFlowTableServerName(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	table := newFlowTable(time.Minute, time.Hour, 10)
+
+	request := FlowKey{SrcIP: "10.0.0.5", DstIP: "203.0.113.7", SrcPort: 51234, DstPort: 443, Protocol: "TCP"}
+	response := request.reverse()
+	table.add(request, DirectionTx, 60, TCPFlagSYN, nil, base)
+	table.add(response, DirectionRx, 60, TCPFlagSYN|TCPFlagACK, nil, base)
+	table.add(request, DirectionTx, 600, TCPFlagPSH|TCPFlagACK, clientHello(t, "video.example.com"), base)
+	table.add(response, DirectionRx, 1500, TCPFlagACK, []byte{0x16, 0x03, 0x03}, base)
+
+	later := FlowKey{SrcIP: "10.0.0.5", DstIP: "203.0.113.7", SrcPort: 51235, DstPort: 80, Protocol: "TCP"}
+	table.add(later, DirectionTx, 100, TCPFlagPSH, []byte("POST /upload HTTP/1.1\r\nHost: upload.example.com\r\n\r\n"), base)
+	table.add(later.reverse(), DirectionRx, 100, TCPFlagPSH, []byte("HTTP/1.1 200 OK\r\n\r\n"), base)
+
+	unnamed := FlowKey{SrcIP: "10.0.0.5", DstIP: "203.0.113.8", SrcPort: 51236, DstPort: 443, Protocol: "TCP"}
+	for i := 0; i < maxServerNamePayloads; i++ {
+		table.add(unnamed, DirectionTx, 100, TCPFlagPSH, []byte{0x17, 0x03, 0x03}, base)
+	}
+	table.add(unnamed, DirectionTx, 100, TCPFlagPSH, []byte("GET / HTTP/1.1\r\nHost: late.example.com\r\n\r\n"), base)
+
+	names := map[FlowKey][2]string{}
+	for _, record := range table.export(base) {
+		names[record.Key] = [2]string{record.ServerName, record.ServerIP}
+	}
+	assert.Equal(t, [2]string{"video.example.com", "203.0.113.7"}, names[request])
+	assert.Equal(t, [2]string{"video.example.com", "203.0.113.7"}, names[response], "the reply direction shares the name")
+	assert.Equal(t, [2]string{"upload.example.com", "203.0.113.7"}, names[later.reverse()], "a reply started after the request inherits it")
+	assert.Equal(t, [2]string{"", ""}, names[unnamed], "only the first payloads are inspected")
+}
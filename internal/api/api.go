@@ -0,0 +1,375 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"network-monitor/internal/alert"
+	"network-monitor/internal/analysis"
+	"network-monitor/internal/broker"
+	"network-monitor/internal/config"
+	"network-monitor/internal/geoip"
+	"network-monitor/internal/storage"
+	"strings"
+	"time"
+)
+
+// Snapshot is the outcome of the latest completed interval on one interface.
+type Snapshot struct {
+	Interface       string         `json:"interface"`
+	Start           time.Time      `json:"start"`
+	DurationSeconds float64        `json:"duration_seconds"`
+	TotalBytes      int64          `json:"total_bytes"`
+	RxBytes         int64          `json:"rx_bytes"`
+	TxBytes         int64          `json:"tx_bytes"`
+	Packets         int64          `json:"packets"`
+	SpeedMbps       float64        `json:"speed_mbps"`
+	RxMbps          float64        `json:"rx_mbps"`
+	TxMbps          float64        `json:"tx_mbps"`
+	ActiveFlows     int            `json:"active_flows"`
+	TopTalkers      []alert.Talker `json:"top_talkers"`
+	TopFlows        []alert.Flow   `json:"top_flows"`
+	// Countries and ASNs break the interval's traffic down by the remote
+	// ends when GeoIP databases are configured.
+	Countries []geoip.CountryTraffic `json:"countries,omitempty"`
+	ASNs      []geoip.ASNTraffic     `json:"asns,omitempty"`
+}
+
+// Update is published after every interval: the interval's snapshot and the
+// interface's pending and firing alerts.
+type Update struct {
+	Snapshot
+	Alerts []alert.Status `json:"alerts"`
+}
+
+// CaptureHealth describes the state of one capture pipeline. Packet counters
+// come from libpcap and are only available for live captures.
+type CaptureHealth struct {
+	Interface string `json:"interface"`
+	Mode      string `json:"mode"`
+	BPFFilter string `json:"bpf_filter"`
+	// LastUpdate is when the monitor last processed an interval of this
+	// pipeline, in wall-clock time.
+	LastUpdate       *time.Time `json:"last_update,omitempty"`
+	Healthy          bool       `json:"healthy"`
+	PacketsReceived  int        `json:"packets_received"`
+	PacketsDropped   int        `json:"packets_dropped"`
+	PacketsIfDropped int        `json:"packets_if_dropped"`
+	Error            string     `json:"error,omitempty"`
+}
+
+// Source is the running monitor as seen by the API.
+type Source interface {
+	Snapshots() []Snapshot
+	// Recent returns the intervals kept in memory, oldest first.
+	Recent() []Snapshot
+	ActiveAlerts() []alert.Status
+	// RecentAlerts returns the latest alert notifications, newest first.
+	RecentAlerts() []alert.Event
+	Health() []CaptureHealth
+	Config() *config.Config
+	// History returns nil when history is disabled.
+	History() *storage.Store
+	Subscribe(buffer int) *broker.Subscription[Update]
+	// Hostname returns the known hostname of an IP address, or "".
+	Hostname(ip string) string
+}
+
+// AlertsFor returns the alerts of one interface. Alert keys start with the
+// interface name.
+func AlertsFor(alerts []alert.Status, iface string) []alert.Status {
+	result := []alert.Status{}
+	for _, status := range alerts {
+		if strings.HasPrefix(status.Key, iface+"/") {
+			result = append(result, status)
+		}
+	}
+	return result
+}
+
+const defaultHostWindow = time.Hour
+
+type HostSample struct {
+	Interface       string    `json:"interface"`
+	Start           time.Time `json:"start"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	storage.HostBytes
+	SpeedMbps float64 `json:"speed_mbps"`
+}
+
+type HostHistory struct {
+	Host       string             `json:"host"`
+	Hostname   string             `json:"hostname,omitempty"`
+	Resolution storage.Resolution `json:"resolution"`
+	From       time.Time          `json:"from"`
+	To         time.Time          `json:"to"`
+	Total      storage.HostBytes  `json:"total"`
+	Samples    []HostSample       `json:"samples"`
+}
+
+type handler struct {
+	source Source
+}
+
+// NewHandler serves the JSON API under /api/v1/.
+func NewHandler(source Source) http.Handler {
+	h := &handler{source: source}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/current", h.current)
+	mux.HandleFunc("GET /api/v1/recent", h.recent)
+	mux.HandleFunc("GET /api/v1/health", h.health)
+	mux.HandleFunc("GET /api/v1/hosts/{ip}", h.host)
+	mux.HandleFunc("GET /api/v1/alerts", h.alerts)
+	mux.HandleFunc("GET /api/v1/config", h.config)
+	mux.HandleFunc("GET /api/v1/stream", h.stream)
+	return mux
+}
+
+// current returns the latest snapshot of every interface, or of the one
+// given by ?interface=.
+func (h *handler) current(w http.ResponseWriter, r *http.Request) {
+	iface := r.URL.Query().Get("interface")
+	snapshots := []Snapshot{}
+	for _, snapshot := range h.source.Snapshots() {
+		if iface == "" || snapshot.Interface == iface {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	if iface != "" && len(snapshots) == 0 {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("no data for interface %q", iface))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"interfaces": snapshots})
+}
+
+// recent returns the intervals kept in memory, oldest first, so charts can
+// be filled before the first streamed update arrives.
+func (h *handler) recent(w http.ResponseWriter, r *http.Request) {
+	iface := r.URL.Query().Get("interface")
+	snapshots := []Snapshot{}
+	for _, snapshot := range h.source.Recent() {
+		if iface == "" || snapshot.Interface == iface {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"snapshots": snapshots})
+}
+
+func (h *handler) health(w http.ResponseWriter, r *http.Request) {
+	health := h.source.Health()
+	if health == nil {
+		health = []CaptureHealth{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"interfaces": health})
+}
+
+// host returns the recorded traffic of one host. The range defaults to the
+// last hour and can be set with from and to (RFC 3339) or since (a
+// duration such as 24h). Without history it is answered from the intervals
+// kept in memory.
+func (h *handler) host(w http.ResponseWriter, r *http.Request) {
+	ip := net.ParseIP(r.PathValue("ip"))
+	if ip == nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid IP address %q", r.PathValue("ip")))
+		return
+	}
+
+	q, err := parseHostQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	q.Host = ip.String()
+
+	var samples []storage.Sample
+	if history := h.source.History(); history != nil {
+		if q.Resolution == "" {
+			q.Resolution = history.ResolutionFor(q.From)
+		}
+		samples, err = history.Query(q)
+		if err != nil {
+			log.Printf("API: error querying history for %s: %v", q.Host, err)
+			writeError(w, http.StatusInternalServerError, "failed to query traffic history")
+			return
+		}
+	} else {
+		recent := h.source.Recent()
+		if recent == nil {
+			writeError(w, http.StatusServiceUnavailable, "no traffic recorded yet and traffic history is disabled, set storage_path to record it")
+			return
+		}
+		if q.Resolution != "" && q.Resolution != storage.ResolutionRaw {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("resolution %s needs traffic history, set storage_path to record it", q.Resolution))
+			return
+		}
+		q.Resolution = storage.ResolutionRaw
+		samples = recentSamples(recent, q)
+	}
+
+	result := HostHistory{
+		Host:       q.Host,
+		Hostname:   h.source.Hostname(q.Host),
+		Resolution: q.Resolution,
+		From:       q.From,
+		To:         q.To,
+		Samples:    make([]HostSample, 0, len(samples)),
+	}
+	for _, sample := range samples {
+		data := sample.Hosts[q.Host]
+		result.Total.Bytes += data.Bytes
+		result.Total.RxBytes += data.RxBytes
+		result.Total.TxBytes += data.TxBytes
+		result.Samples = append(result.Samples, HostSample{
+			Interface:       sample.Interface,
+			Start:           sample.Start,
+			DurationSeconds: sample.Duration.Seconds(),
+			HostBytes:       data,
+			SpeedMbps:       analysis.CalculateSpeedMbps(data.Bytes, sample.Duration),
+		})
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// recentSamples selects the host's samples from the intervals kept in
+// memory. Those only list the top talkers of each interval, whose byte
+// counts are recovered from their rates.
+func recentSamples(recent []Snapshot, q storage.Query) []storage.Sample {
+	var samples []storage.Sample
+	for _, snapshot := range recent {
+		if q.Interface != "" && snapshot.Interface != q.Interface {
+			continue
+		}
+		if snapshot.Start.Before(q.From) || !snapshot.Start.Before(q.To) {
+			continue
+		}
+		duration := time.Duration(snapshot.DurationSeconds * float64(time.Second))
+		for _, talker := range snapshot.TopTalkers {
+			if talker.IP != q.Host {
+				continue
+			}
+			samples = append(samples, storage.Sample{
+				Interface: snapshot.Interface,
+				Start:     snapshot.Start,
+				Duration:  duration,
+				Hosts: map[string]storage.HostBytes{q.Host: {
+					Bytes:   rateBytes(talker.SpeedMbps, duration),
+					RxBytes: rateBytes(talker.RxMbps, duration),
+					TxBytes: rateBytes(talker.TxMbps, duration),
+				}},
+			})
+		}
+	}
+	return samples
+}
+
+// rateBytes is the inverse of analysis.CalculateSpeedMbps.
+func rateBytes(mbps float64, duration time.Duration) int64 {
+	return int64(math.Round(mbps * duration.Seconds() * 1_000_000 / 8))
+}
+
+func parseHostQuery(r *http.Request) (storage.Query, error) {
+	values := r.URL.Query()
+	q := storage.Query{Interface: values.Get("interface"), To: time.Now()}
+
+	if v := values.Get("to"); v != "" {
+		to, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return q, fmt.Errorf("invalid to: %w", err)
+		}
+		q.To = to
+	}
+
+	q.From = q.To.Add(-defaultHostWindow)
+	if v := values.Get("since"); v != "" {
+		since, err := time.ParseDuration(v)
+		if err != nil || since <= 0 {
+			return q, fmt.Errorf("invalid since %q: must be a positive duration", v)
+		}
+		q.From = q.To.Add(-since)
+	}
+	if v := values.Get("from"); v != "" {
+		from, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return q, fmt.Errorf("invalid from: %w", err)
+		}
+		q.From = from
+	}
+	if !q.From.Before(q.To) {
+		return q, fmt.Errorf("from must be before to")
+	}
+
+	if v := values.Get("resolution"); v != "" {
+		res, err := storage.ParseResolution(v)
+		if err != nil {
+			return q, err
+		}
+		q.Resolution = res
+	}
+	return q, nil
+}
+
+func (h *handler) alerts(w http.ResponseWriter, r *http.Request) {
+	alerts := h.source.ActiveAlerts()
+	if alerts == nil {
+		alerts = []alert.Status{}
+	}
+	recent := h.source.RecentAlerts()
+	if recent == nil {
+		recent = []alert.Event{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"alerts": alerts, "recent": recent})
+}
+
+func (h *handler) config(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.source.Config().Redacted())
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("API: error writing response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// Server serves the API on its own port, for when it should not share the
+// metrics server.
+type Server struct {
+	server *http.Server
+}
+
+func NewServer(port string, handler http.Handler) *Server {
+	return &Server{
+		server: &http.Server{
+			Addr:    ":" + port,
+			Handler: handler,
+		},
+	}
+}
+
+func (s *Server) Start() {
+	go func() {
+		log.Printf("Starting API server on %s", s.server.Addr)
+		if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("API server error: %v", err)
+		}
+	}()
+}
+
+func (s *Server) Stop() {
+	log.Println("Stopping API server...")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := s.server.Shutdown(ctx); err != nil {
+		log.Printf("Error shutting down API server: %v", err)
+	}
+}
@@ -0,0 +1,194 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"network-monitor/internal/alert"
+	"network-monitor/internal/broker"
+	"network-monitor/internal/config"
+	"network-monitor/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSource struct {
+	snapshots []Snapshot
+	recent    []Snapshot
+	alerts    []alert.Status
+	events    []alert.Event
+	health    []CaptureHealth
+	cfg       *config.Config
+	history   *storage.Store
+	updates   *broker.Broker[Update]
+	hostnames map[string]string
+}
+
+func (f *fakeSource) Snapshots() []Snapshot        { return f.snapshots }
+func (f *fakeSource) Recent() []Snapshot           { return f.recent }
+func (f *fakeSource) ActiveAlerts() []alert.Status { return f.alerts }
+func (f *fakeSource) RecentAlerts() []alert.Event  { return f.events }
+func (f *fakeSource) Health() []CaptureHealth      { return f.health }
+func (f *fakeSource) Config() *config.Config       { return f.cfg }
+func (f *fakeSource) History() *storage.Store      { return f.history }
+func (f *fakeSource) Hostname(ip string) string    { return f.hostnames[ip] }
+func (f *fakeSource) Subscribe(buffer int) *broker.Subscription[Update] {
+	return f.updates.Subscribe(buffer)
+}
+
+func get(t *testing.T, source Source, path string, v any) int {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	NewHandler(source).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), v))
+	return rec.Code
+}
+
+func TestCurrent(t *testing.T) {
+	source := &fakeSource{snapshots: []Snapshot{
+		{Interface: "eth0", SpeedMbps: 12.5, TopTalkers: []alert.Talker{{IP: "10.0.0.1", SpeedMbps: 10}}},
+		{Interface: "wlan0", SpeedMbps: 1},
+	}}
+
+	var body struct {
+		Interfaces []map[string]any `json:"interfaces"`
+	}
+	assert.Equal(t, http.StatusOK, get(t, source, "/api/v1/current", &body))
+	require.Len(t, body.Interfaces, 2)
+	assert.Equal(t, 12.5, body.Interfaces[0]["speed_mbps"])
+	talkers := body.Interfaces[0]["top_talkers"].([]any)
+	assert.Equal(t, "10.0.0.1", talkers[0].(map[string]any)["ip"])
+
+	assert.Equal(t, http.StatusOK, get(t, source, "/api/v1/current?interface=wlan0", &body))
+	require.Len(t, body.Interfaces, 1)
+	assert.Equal(t, "wlan0", body.Interfaces[0]["interface"])
+
+	var errBody map[string]string
+	assert.Equal(t, http.StatusNotFound, get(t, source, "/api/v1/current?interface=eth9", &errBody))
+	assert.Contains(t, errBody["error"], "eth9")
+}
+
+func TestHost(t *testing.T) {
+	store, err := storage.Open(filepath.Join(t.TempDir(), "history.db"), storage.Retention{})
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, store.Write(storage.Sample{
+			Interface: "eth0",
+			Start:     start.Add(time.Duration(i) * 10 * time.Second),
+			Duration:  10 * time.Second,
+			Hosts: map[string]storage.HostBytes{
+				"10.0.0.1": {Bytes: 1_250_000, RxBytes: 1_000_000, TxBytes: 250_000},
+				"10.0.0.2": {Bytes: 1},
+			},
+		}))
+	}
+	source := &fakeSource{history: store, hostnames: map[string]string{"10.0.0.1": "nas.lan"}}
+
+	var history HostHistory
+	code := get(t, source, "/api/v1/hosts/10.0.0.1?from=2024-01-01T12:00:00Z&to=2024-01-01T13:00:00Z&resolution=raw", &history)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "10.0.0.1", history.Host)
+	assert.Equal(t, "nas.lan", history.Hostname)
+	assert.Equal(t, storage.ResolutionRaw, history.Resolution)
+	require.Len(t, history.Samples, 3)
+	assert.InDelta(t, 1.0, history.Samples[0].SpeedMbps, 1e-9)
+	assert.Equal(t, int64(3_750_000), history.Total.Bytes)
+	assert.Equal(t, int64(3_000_000), history.Total.RxBytes)
+
+	code = get(t, source, "/api/v1/hosts/10.0.0.1?to=2024-01-01T13:00:00Z&since=30m", &history)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Empty(t, history.Samples)
+
+	var errBody map[string]string
+	assert.Equal(t, http.StatusBadRequest, get(t, source, "/api/v1/hosts/not-an-ip", &errBody))
+	assert.Equal(t, http.StatusBadRequest, get(t, source, "/api/v1/hosts/10.0.0.1?resolution=5m", &errBody))
+	assert.Equal(t, http.StatusBadRequest, get(t, source, "/api/v1/hosts/10.0.0.1?since=-1h", &errBody))
+	assert.Equal(t, http.StatusServiceUnavailable, get(t, &fakeSource{}, "/api/v1/hosts/10.0.0.1", &errBody))
+}
+
+func TestHostWithoutHistory(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	source := &fakeSource{recent: []Snapshot{
+		{Interface: "eth0", Start: start, DurationSeconds: 10, TopTalkers: []alert.Talker{
+			{IP: "10.0.0.1", SpeedMbps: 1, RxMbps: 0.8, TxMbps: 0.2},
+			{IP: "10.0.0.2", SpeedMbps: 5},
+		}},
+		{Interface: "wlan0", Start: start, DurationSeconds: 10},
+		{Interface: "eth0", Start: start.Add(10 * time.Second), DurationSeconds: 10, TopTalkers: []alert.Talker{
+			{IP: "10.0.0.1", SpeedMbps: 2},
+		}},
+	}}
+
+	var history HostHistory
+	code := get(t, source, "/api/v1/hosts/10.0.0.1?from=2024-01-01T12:00:00Z&to=2024-01-01T13:00:00Z", &history)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, storage.ResolutionRaw, history.Resolution)
+	require.Len(t, history.Samples, 2)
+	assert.Equal(t, storage.HostBytes{Bytes: 1_250_000, RxBytes: 1_000_000, TxBytes: 250_000}, history.Samples[0].HostBytes)
+	assert.InDelta(t, 2.0, history.Samples[1].SpeedMbps, 1e-9)
+	assert.Equal(t, int64(3_750_000), history.Total.Bytes)
+
+	code = get(t, source, "/api/v1/hosts/10.0.0.1?from=2024-01-01T12:00:05Z&to=2024-01-01T13:00:00Z", &history)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, history.Samples, 1)
+
+	var errBody map[string]string
+	assert.Equal(t, http.StatusBadRequest, get(t, source, "/api/v1/hosts/10.0.0.1?resolution=1h", &errBody))
+}
+
+func TestAlertsAndConfig(t *testing.T) {
+	source := &fakeSource{
+		alerts: []alert.Status{{Key: "eth0/total", State: alert.StateFiring, LastValue: 150, Threshold: 100}},
+		events: []alert.Event{{Kind: alert.KindResolved, ResolvedKind: alert.KindThresholdExceeded, Interface: "eth0", Duration: time.Minute}},
+		cfg:    &config.Config{InterfaceName: "eth0", WebhookURL: "https://discord.com/api/webhooks/1/token"},
+	}
+
+	var alerts struct {
+		Alerts []alert.Status `json:"alerts"`
+		Recent []alert.Event  `json:"recent"`
+	}
+	assert.Equal(t, http.StatusOK, get(t, source, "/api/v1/alerts", &alerts))
+	require.Len(t, alerts.Alerts, 1)
+	assert.Equal(t, alert.StateFiring, alerts.Alerts[0].State)
+	assert.Equal(t, 150.0, alerts.Alerts[0].LastValue)
+	require.Len(t, alerts.Recent, 1)
+	assert.Equal(t, alert.KindThresholdExceeded, alerts.Recent[0].ResolvedKind)
+	assert.Equal(t, time.Minute, alerts.Recent[0].Duration)
+
+	var cfg map[string]any
+	assert.Equal(t, http.StatusOK, get(t, source, "/api/v1/config", &cfg))
+	assert.Equal(t, "eth0", cfg["interface"])
+	assert.Equal(t, "REDACTED", cfg["webhook_url"])
+}
+
+func TestRecentAndHealth(t *testing.T) {
+	source := &fakeSource{
+		recent: []Snapshot{{Interface: "eth0", SpeedMbps: 1}, {Interface: "wlan0"}, {Interface: "eth0", SpeedMbps: 2}},
+		health: []CaptureHealth{{Interface: "eth0", Mode: "live", Healthy: true, PacketsDropped: 3}},
+	}
+
+	var recent struct {
+		Snapshots []Snapshot `json:"snapshots"`
+	}
+	assert.Equal(t, http.StatusOK, get(t, source, "/api/v1/recent?interface=eth0", &recent))
+	require.Len(t, recent.Snapshots, 2)
+	assert.Equal(t, 2.0, recent.Snapshots[1].SpeedMbps)
+
+	var health struct {
+		Interfaces []CaptureHealth `json:"interfaces"`
+	}
+	assert.Equal(t, http.StatusOK, get(t, source, "/api/v1/health", &health))
+	require.Len(t, health.Interfaces, 1)
+	assert.True(t, health.Interfaces[0].Healthy)
+	assert.Equal(t, 3, health.Interfaces[0].PacketsDropped)
+	assert.Nil(t, health.Interfaces[0].LastUpdate)
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	streamBuffer      = 16
+	keepAliveInterval = 15 * time.Second
+)
+
+// stream pushes every interval as a Server-Sent Event named "interval".
+// It starts with the latest interval of each interface so clients have data
+// straight away. ?interface= limits the stream to one interface.
+func (h *handler) stream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+
+	sub := h.source.Subscribe(streamBuffer)
+	defer sub.Close()
+
+	iface := r.URL.Query().Get("interface")
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	alerts := h.source.ActiveAlerts()
+	for _, snapshot := range h.source.Snapshots() {
+		if iface == "" || snapshot.Interface == iface {
+			if err := writeEvent(w, "interval", Update{Snapshot: snapshot, Alerts: AlertsFor(alerts, snapshot.Interface)}); err != nil {
+				return
+			}
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case update, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if iface != "" && update.Interface != iface {
+				continue
+			}
+			if err := writeEvent(w, "interval", update); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("API: error encoding %s event: %v", event, err)
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	return err
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"network-monitor/internal/alert"
+	"network-monitor/internal/broker"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readEvent reads one Server-Sent Event, skipping comments.
+func readEvent(t *testing.T, r *bufio.Reader) (string, Update) {
+	t.Helper()
+	var event string
+	var update Update
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &update))
+		case line == "" && event != "":
+			return event, update
+		}
+	}
+}
+
+func TestStream(t *testing.T) {
+	source := &fakeSource{
+		snapshots: []Snapshot{{Interface: "eth0", SpeedMbps: 5}, {Interface: "wlan0"}},
+		alerts: []alert.Status{
+			{Key: "eth0/total", State: alert.StateFiring},
+			{Key: "wlan0/rx", State: alert.StatePending},
+		},
+		updates: broker.New[Update](),
+	}
+	server := httptest.NewServer(NewHandler(source))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/api/v1/stream?interface=eth0")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	r := bufio.NewReader(resp.Body)
+
+	event, update := readEvent(t, r)
+	assert.Equal(t, "interval", event)
+	assert.Equal(t, "eth0", update.Interface)
+	assert.Equal(t, 5.0, update.SpeedMbps)
+	require.Len(t, update.Alerts, 1)
+	assert.Equal(t, "eth0/total", update.Alerts[0].Key)
+
+	source.updates.Publish(Update{Snapshot: Snapshot{Interface: "wlan0"}})
+	source.updates.Publish(Update{Snapshot: Snapshot{Interface: "eth0", SpeedMbps: 7}})
+	_, update = readEvent(t, r)
+	assert.Equal(t, 7.0, update.SpeedMbps, "other interfaces are filtered out")
+
+	source.updates.Close()
+	_, err = io.ReadAll(r)
+	assert.NoError(t, err, "the stream ends when the broker is closed")
+}
@@ -0,0 +1,150 @@
+package broker
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Broker fans every published value out to all current subscribers.
+// Publish does not wait for ordinary subscribers: one whose buffer is full
+// misses the value, so one slow client cannot hold up the others or the
+// publisher. Subscribers registered with SubscribeAll receive every value
+// instead, and Publish waits for them.
+type Broker[T any] struct {
+	mu     sync.Mutex
+	subs   map[*Subscription[T]]struct{}
+	closed bool
+}
+
+type Subscription[T any] struct {
+	// C receives the published values. It is closed when the subscription
+	// or the broker is closed.
+	C <-chan T
+
+	ch     chan T
+	broker *Broker[T]
+	all    bool
+	// done is closed by Close and cancels sends that are waiting for a
+	// SubscribeAll subscriber.
+	done chan struct{}
+	// sending counts the publishes that may still send to ch; ch is only
+	// closed once they are finished.
+	sending sync.WaitGroup
+	dropped atomic.Int64
+}
+
+func New[T any]() *Broker[T] {
+	return &Broker[T]{subs: make(map[*Subscription[T]]struct{})}
+}
+
+// Subscribe registers a subscriber that can fall behind by up to buffer
+// values before it starts missing them.
+func (b *Broker[T]) Subscribe(buffer int) *Subscription[T] {
+	return b.subscribe(buffer, false)
+}
+
+// SubscribeAll registers a subscriber that misses no values: once its
+// buffer is full, Publish waits for it. It must keep reading C until the
+// broker is closed, or Close the subscription when it stops.
+func (b *Broker[T]) SubscribeAll(buffer int) *Subscription[T] {
+	return b.subscribe(buffer, true)
+}
+
+func (b *Broker[T]) subscribe(buffer int, all bool) *Subscription[T] {
+	ch := make(chan T, buffer)
+	sub := &Subscription[T]{C: ch, ch: ch, broker: b, all: all, done: make(chan struct{})}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(ch)
+		return sub
+	}
+	b.subs[sub] = struct{}{}
+	return sub
+}
+
+// Publish sends v to every current subscriber. The lock is only held to
+// take the list of subscribers, so subscribing and unsubscribing are not
+// held up while Publish waits for a SubscribeAll subscriber.
+func (b *Broker[T]) Publish(v T) {
+	b.mu.Lock()
+	subs := make([]*Subscription[T], 0, len(b.subs))
+	for sub := range b.subs {
+		sub.sending.Add(1)
+		subs = append(subs, sub)
+	}
+	b.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.send(v)
+		sub.sending.Done()
+	}
+}
+
+func (s *Subscription[T]) send(v T) {
+	if s.all {
+		select {
+		case s.ch <- v:
+		case <-s.done:
+		}
+		return
+	}
+	select {
+	case s.ch <- v:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// Subscribers returns the number of active subscriptions.
+func (b *Broker[T]) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs)
+}
+
+// Close ends every subscription once the publishes in progress have been
+// delivered. Later publishes are ignored and later subscriptions are closed
+// immediately.
+func (b *Broker[T]) Close() {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	b.closed = true
+	subs := b.subs
+	b.subs = make(map[*Subscription[T]]struct{})
+	b.mu.Unlock()
+
+	for sub := range subs {
+		sub.sending.Wait()
+		close(sub.ch)
+	}
+}
+
+// Close unsubscribes. C is closed as soon as no publish is sending to it.
+// It is safe to call more than once and after the broker has been closed.
+func (s *Subscription[T]) Close() {
+	b := s.broker
+	b.mu.Lock()
+	_, ok := b.subs[s]
+	delete(b.subs, s)
+	b.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	close(s.done)
+	go func() {
+		s.sending.Wait()
+		close(s.ch)
+	}()
+}
+
+// Dropped returns how many values the subscriber missed because its buffer
+// was full.
+func (s *Subscription[T]) Dropped() int64 {
+	return s.dropped.Load()
+}
@@ -0,0 +1,113 @@
+package broker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBrokerFanOut(t *testing.T) {
+	b := New[int]()
+	first := b.Subscribe(2)
+	second := b.Subscribe(2)
+	assert.Equal(t, 2, b.Subscribers())
+
+	b.Publish(1)
+	assert.Equal(t, 1, <-first.C)
+	assert.Equal(t, 1, <-second.C)
+
+	second.Close()
+	second.Close()
+	assert.Equal(t, 1, b.Subscribers())
+	_, ok := <-second.C
+	assert.False(t, ok, "closed subscriptions stop receiving")
+
+	b.Publish(2)
+	assert.Equal(t, 2, <-first.C)
+}
+
+func TestBrokerDropsForSlowSubscriber(t *testing.T) {
+	b := New[int]()
+	slow := b.Subscribe(1)
+
+	b.Publish(1)
+	b.Publish(2)
+	b.Publish(3)
+
+	assert.Equal(t, 1, <-slow.C)
+	assert.Equal(t, int64(2), slow.Dropped())
+}
+
+func TestBrokerSubscribeAll(t *testing.T) {
+	b := New[int]()
+	all := b.SubscribeAll(1)
+	slow := b.Subscribe(1)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i <= 3; i++ {
+			b.Publish(i)
+		}
+	}()
+
+	var got []int
+	for range 3 {
+		got = append(got, <-all.C)
+	}
+	<-done
+	assert.Equal(t, []int{1, 2, 3}, got, "Publish waits for the subscriber")
+	assert.Zero(t, all.Dropped())
+	assert.Equal(t, 1, <-slow.C)
+	assert.Equal(t, int64(2), slow.Dropped(), "ordinary subscribers still miss values")
+}
+
+func TestBrokerWaitingPublishDoesNotBlock(t *testing.T) {
+	b := New[int]()
+	all := b.SubscribeAll(0)
+	go b.Publish(1)
+
+	// Subscribing and unsubscribing go on while Publish waits.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sub := b.Subscribe(1)
+		sub.Close()
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Subscribe waited for a publish")
+	}
+	assert.Equal(t, 1, <-all.C)
+
+	// Closing the subscription cancels a publish that waits for it.
+	published := make(chan struct{})
+	go func() {
+		defer close(published)
+		b.Publish(2)
+	}()
+	all.Close()
+	for range all.C {
+	}
+	<-published
+	b.Close()
+}
+
+func TestBrokerClose(t *testing.T) {
+	b := New[string]()
+	sub := b.Subscribe(1)
+
+	b.Close()
+	_, ok := <-sub.C
+	assert.False(t, ok)
+	sub.Close()
+
+	b.Publish("ignored")
+	late := b.Subscribe(1)
+	_, ok = <-late.C
+	require.False(t, ok, "subscribing to a closed broker returns a closed subscription")
+	assert.Equal(t, 0, b.Subscribers())
+}
@@ -4,55 +4,136 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net"
 	"strings"
 	"time"
 
 	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
 	"github.com/google/gopacket/pcap"
 )
 
 const (
-	snapshotLen int32         = 1024
-	promiscuous bool          = true
-	timeout     time.Duration = -1 * time.Second
+	DefaultSnapshotLen int32 = 1024
 
-	bpfFilter string = "ip or ip6"
+	timeout time.Duration = -1 * time.Second
 )
 
-func StartCapture(interfaceName string) (*gopacket.PacketSource, *pcap.Handle, error) {
-	var handle *pcap.Handle
-	var err error
+type Options struct {
+	SnapshotLen int32
+	Promiscuous bool
+	BPFFilter   string
+}
 
-	if interfaceName == "" {
+// filterLinkTypes are the link types ValidateBPFFilter compiles against.
+// Ethernet comes first so its error is the one reported.
+var filterLinkTypes = []layers.LinkType{
+	layers.LinkTypeEthernet,
+	layers.LinkTypeRaw,
+	layers.LinkTypeLinuxSLL,
+	layers.LinkTypeNull,
+	layers.LinkTypeLoop,
+	layers.LinkTypeIEEE80211Radio,
+}
 
-		devices, err := pcap.FindAllDevs()
-		if err != nil {
-			return nil, nil, fmt.Errorf("error finding devices: %w", err)
+// ValidateBPFFilter compiles the filter expression without opening a device
+// so that syntax errors are reported before any capture starts. The link
+// type of the device is not known yet, so a filter is accepted if it
+// compiles for any common one; SetBPFFilter on the opened handle has the
+// final say.
+func ValidateBPFFilter(filter string, snapshotLen int32) error {
+	if filter == "" {
+		return nil
+	}
+	var firstErr error
+	for _, linkType := range filterLinkTypes {
+		_, err := pcap.CompileBPFFilter(linkType, int(snapshotLen), filter)
+		if err == nil {
+			return nil
+		}
+		if firstErr == nil {
+			firstErr = err
 		}
+	}
+	return fmt.Errorf("invalid BPF filter '%s': %w", filter, firstErr)
+}
+
+func DefaultInterface() (string, error) {
+	devices, err := Devices()
+	if err != nil {
+		return "", err
+	}
+	return PickDefault(devices)
+}
+
+// Devices lists the capture devices known to libpcap.
+func Devices() ([]pcap.Interface, error) {
+	devices, err := pcap.FindAllDevs()
+	if err != nil {
+		return nil, fmt.Errorf("error finding devices: %w", err)
+	}
+	return devices, nil
+}
+
+// PickDefault returns the device used when no interface is configured: the
+// first non-loopback device with an address.
+func PickDefault(devices []pcap.Interface) (string, error) {
+	if len(devices) == 0 {
+		return "", errors.New("no network interfaces found")
+	}
 
-		if len(devices) == 0 {
-			return nil, nil, errors.New("no network interfaces found")
+	for _, device := range devices {
+
+		if strings.HasPrefix(device.Name, "lo") {
+			continue
 		}
 
-		for _, device := range devices {
+		if len(device.Addresses) == 0 {
+			continue
+		}
+		return device.Name, nil
+	}
+	return "", errors.New("no suitable network interface found (non-loopback with addresses)")
+}
 
-			if strings.HasPrefix(device.Name, "lo") {
-				continue
-			}
+func InterfaceAddresses(interfaceName string) ([]net.IP, error) {
+	devices, err := pcap.FindAllDevs()
+	if err != nil {
+		return nil, fmt.Errorf("error finding devices: %w", err)
+	}
 
-			if len(device.Addresses) == 0 {
-				continue
+	for _, device := range devices {
+		if device.Name != interfaceName {
+			continue
+		}
+		var addrs []net.IP
+		for _, addr := range device.Addresses {
+			if addr.IP != nil {
+				addrs = append(addrs, addr.IP)
 			}
-			log.Printf("No interface specified, using first valid device found: %s", device.Name)
-			interfaceName = device.Name
-			break
 		}
-		if interfaceName == "" {
-			return nil, nil, errors.New("no suitable network interface found (non-loopback with addresses)")
+		return addrs, nil
+	}
+	return nil, fmt.Errorf("interface %s not found", interfaceName)
+}
+
+func StartCapture(interfaceName string, opts Options) (*gopacket.PacketSource, *pcap.Handle, error) {
+	var handle *pcap.Handle
+	var err error
+
+	if interfaceName == "" {
+		interfaceName, err = DefaultInterface()
+		if err != nil {
+			return nil, nil, err
 		}
+		log.Printf("No interface specified, using first valid device found: %s", interfaceName)
 	}
 
-	handle, err = pcap.OpenLive(interfaceName, snapshotLen, promiscuous, timeout)
+	if opts.SnapshotLen <= 0 {
+		opts.SnapshotLen = DefaultSnapshotLen
+	}
+
+	handle, err = pcap.OpenLive(interfaceName, opts.SnapshotLen, opts.Promiscuous, timeout)
 	if err != nil {
 
 		if strings.Contains(strings.ToLower(err.Error()), "permission denied") {
@@ -61,11 +142,9 @@ func StartCapture(interfaceName string) (*gopacket.PacketSource, *pcap.Handle, e
 		return nil, nil, fmt.Errorf("error opening device %s: %w", interfaceName, err)
 	}
 
-	log.Printf("Using BPF filter: %s", bpfFilter)
-	err = handle.SetBPFFilter(bpfFilter)
-	if err != nil {
+	if err := applyFilter(handle, opts.BPFFilter); err != nil {
 		handle.Close()
-		return nil, nil, fmt.Errorf("error setting BPF filter '%s': %w", bpfFilter, err)
+		return nil, nil, err
 	}
 
 	packetSource := gopacket.NewPacketSource(handle, handle.LinkType())
@@ -73,3 +152,66 @@ func StartCapture(interfaceName string) (*gopacket.PacketSource, *pcap.Handle, e
 
 	return packetSource, handle, nil
 }
+
+func applyFilter(handle *pcap.Handle, filter string) error {
+	if filter == "" {
+		log.Printf("No BPF filter configured, capturing all packets.")
+		return nil
+	}
+	log.Printf("Using BPF filter: %s", filter)
+	if err := handle.SetBPFFilter(filter); err != nil {
+		return fmt.Errorf("error setting BPF filter '%s': %w", filter, err)
+	}
+	return nil
+}
+
+func OpenFile(path string, speed float64, filter string) (*gopacket.PacketSource, *pcap.Handle, error) {
+	handle, err := pcap.OpenOffline(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening capture file %s: %w", path, err)
+	}
+
+	if err := applyFilter(handle, filter); err != nil {
+		handle.Close()
+		return nil, nil, err
+	}
+
+	var source gopacket.PacketDataSource = handle
+	if speed > 0 {
+		log.Printf("Replaying %s at %.2fx recorded speed.", path, speed)
+		source = &pacedSource{source: handle, speed: speed}
+	} else {
+		log.Printf("Replaying %s as fast as possible.", path)
+	}
+
+	packetSource := gopacket.NewPacketSource(source, handle.LinkType())
+	return packetSource, handle, nil
+}
+
+// pacedSource delays packets so that they are delivered with the same spacing
+// as their capture timestamps, scaled by speed.
+type pacedSource struct {
+	source  gopacket.PacketDataSource
+	speed   float64
+	started time.Time
+	firstTS time.Time
+}
+
+func (p *pacedSource) ReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	data, ci, err := p.source.ReadPacketData()
+	if err != nil {
+		return data, ci, err
+	}
+
+	if p.firstTS.IsZero() {
+		p.firstTS = ci.Timestamp
+		p.started = time.Now()
+		return data, ci, nil
+	}
+
+	offset := time.Duration(float64(ci.Timestamp.Sub(p.firstTS)) / p.speed)
+	if wait := time.Until(p.started.Add(offset)); wait > 0 {
+		time.Sleep(wait)
+	}
+	return data, ci, nil
+}
@@ -0,0 +1,29 @@
+package capture
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/gopacket/pcap"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPickDefault(t *testing.T) {
+	addr := []pcap.InterfaceAddress{{IP: net.ParseIP("192.168.1.10")}}
+
+	name, err := PickDefault([]pcap.Interface{
+		{Name: "lo", Addresses: []pcap.InterfaceAddress{{IP: net.ParseIP("127.0.0.1")}}},
+		{Name: "docker0"},
+		{Name: "eth0", Addresses: addr},
+		{Name: "eth1", Addresses: addr},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "eth0", name)
+
+	_, err = PickDefault([]pcap.Interface{{Name: "lo", Addresses: addr}, {Name: "eth0"}})
+	assert.Error(t, err)
+
+	_, err = PickDefault(nil)
+	assert.Error(t, err)
+}
@@ -1,57 +1,349 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
+	"net"
+	"net/mail"
+	"net/url"
+	"network-monitor/internal/alert"
 	"strings"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
+const maxSnapshotLen = 262144
+
 type Config struct {
 	InterfaceName string `mapstructure:"interface"`
 
-	ThresholdMbps float64 `mapstructure:"threshold_mbps"`
+	ThresholdMbps   float64 `mapstructure:"threshold_mbps"`
+	RxThresholdMbps float64 `mapstructure:"rx_threshold_mbps"`
+	TxThresholdMbps float64 `mapstructure:"tx_threshold_mbps"`
+
+	ClearThresholdMbps   float64 `mapstructure:"clear_threshold_mbps"`
+	RxClearThresholdMbps float64 `mapstructure:"rx_clear_threshold_mbps"`
+	TxClearThresholdMbps float64 `mapstructure:"tx_clear_threshold_mbps"`
+
+	MinThresholdMbps   float64 `mapstructure:"min_threshold_mbps"`
+	NoTrafficIntervals int     `mapstructure:"no_traffic_intervals"`
+
+	LocalNetworks []string `mapstructure:"local_networks"`
+
+	BPFFilter   string `mapstructure:"bpf_filter"`
+	SnapshotLen int    `mapstructure:"snapshot_len"`
+	Promiscuous bool   `mapstructure:"promiscuous"`
+
+	FlowIdleTimeoutSeconds   int `mapstructure:"flow_idle_timeout_seconds"`
+	FlowActiveTimeoutSeconds int `mapstructure:"flow_active_timeout_seconds"`
+	FlowMaxEntries           int `mapstructure:"flow_max_entries"`
 
 	WebhookURL string `mapstructure:"webhook_url"`
 
+	Notifiers []NotifierConfig `mapstructure:"notifiers"`
+	// Templates maps event kinds to text/template files replacing the
+	// built-in notification messages.
+	Templates map[string]string `mapstructure:"templates"`
+
+	NotifyQueuePath    string `mapstructure:"notify_queue_path"`
+	NotifyMaxAttempts  int    `mapstructure:"notify_max_attempts"`
+	NotifyDrainSeconds int    `mapstructure:"notify_drain_seconds"`
+	// SummaryIntervalHours sends a traffic summary of every interface this
+	// often and at shutdown. 0 disables summaries.
+	SummaryIntervalHours int `mapstructure:"summary_interval_hours"`
+
 	IntervalSeconds int `mapstructure:"interval_seconds"`
 
 	TopN int `mapstructure:"top_n"`
 
+	AlertForIntervals    int `mapstructure:"alert_for_intervals"`
+	AlertCooldownSeconds int `mapstructure:"alert_cooldown_seconds"`
+
 	MetricsEnabled bool   `mapstructure:"metrics_enabled"`
 	MetricsPort    string `mapstructure:"metrics_port"`
 
+	APIEnabled       bool   `mapstructure:"api_enabled"`
+	APIPort          string `mapstructure:"api_port"`
+	DashboardEnabled bool   `mapstructure:"dashboard_enabled"`
+
+	DNSSnooping         bool    `mapstructure:"dns_snooping"`
+	ReverseDNS          bool    `mapstructure:"reverse_dns"`
+	ReverseDNSCacheSize int     `mapstructure:"reverse_dns_cache_size"`
+	ReverseDNSRate      float64 `mapstructure:"reverse_dns_rate"`
+	HostnameMetrics     bool    `mapstructure:"hostname_metrics"`
+
+	ProcessAttribution bool   `mapstructure:"process_attribution"`
+	ProcessMetrics     bool   `mapstructure:"process_metrics"`
+	ProcPath           string `mapstructure:"proc_path"`
+	DockerSocket       string `mapstructure:"docker_socket"`
+
+	GeoIPCountryDB string `mapstructure:"geoip_country_db"`
+	GeoIPASNDB     string `mapstructure:"geoip_asn_db"`
+	GeoIPMetrics   bool   `mapstructure:"geoip_metrics"`
+
+	ReadFile    string  `mapstructure:"read_file"`
+	ReplaySpeed float64 `mapstructure:"replay_speed"`
+
+	StoragePath                string `mapstructure:"storage_path"`
+	StorageRawRetentionHours   int    `mapstructure:"storage_raw_retention_hours"`
+	StorageMinuteRetentionDays int    `mapstructure:"storage_minute_retention_days"`
+	StorageHourRetentionDays   int    `mapstructure:"storage_hour_retention_days"`
+	StorageDayRetentionDays    int    `mapstructure:"storage_day_retention_days"`
+
+	Interfaces []InterfaceConfig `mapstructure:"interfaces"`
+
+	Rules []RuleConfig `mapstructure:"rules"`
+
 	ConfigFile string
 }
 
-func LoadConfig() (*Config, error) {
-	var cfg Config
+const (
+	NotifierDiscord = "discord"
+	NotifierSlack   = "slack"
+	NotifierTeams   = "teams"
+	NotifierWebhook = "webhook"
+	NotifierEmail   = "email"
+)
+
+// Ways an email notifier secures its SMTP connection.
+const (
+	SMTPStartTLS = "starttls"
+	SMTPTLS      = "tls"
+	SMTPNone     = "none"
+)
+
+// NotifierConfig describes one notification backend. Which fields are used
+// depends on Type.
+type NotifierConfig struct {
+	Type string `mapstructure:"type"`
+	Name string `mapstructure:"name"`
+
+	WebhookURL string `mapstructure:"webhook_url"`
+
+	// Headers, BearerToken and Secret (for HMAC signatures) are settings of
+	// the generic webhook.
+	Headers     map[string]string `mapstructure:"headers"`
+	BearerToken string            `mapstructure:"bearer_token"`
+	Secret      string            `mapstructure:"secret"`
+
+	// SMTP settings of email notifiers. SMTPTLS is "starttls" (default),
+	// "tls" or "none"; SMTPPort defaults to 465 for "tls" and 587 otherwise.
+	SMTPHost string `mapstructure:"smtp_host"`
+	SMTPPort int    `mapstructure:"smtp_port"`
+	SMTPTLS  string `mapstructure:"smtp_tls"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	From     string `mapstructure:"from"`
+	// To receive every email; Recipients, keyed by severity (critical,
+	// warning or info), receive only the events of that severity.
+	To         []string            `mapstructure:"to"`
+	Recipients map[string][]string `mapstructure:"recipients"`
+
+	// Templates override the top-level templates for this notifier.
+	Templates map[string]string `mapstructure:"templates"`
+}
 
+const (
+	RuleMetricMbps  = "mbps"
+	RuleMetricBytes = "bytes"
+	RuleMetricPPS   = "pps"
+)
+
+// RuleConfig is a threshold on the traffic selected by Match. The rule fires
+// once Metric compared against Threshold has held for ForSeconds.
+type RuleConfig struct {
+	Name       string    `mapstructure:"name"`
+	Interface  string    `mapstructure:"interface"`
+	Match      RuleMatch `mapstructure:"match"`
+	Metric     string    `mapstructure:"metric"`
+	Comparison string    `mapstructure:"comparison"`
+	Threshold  float64   `mapstructure:"threshold"`
+	ForSeconds int       `mapstructure:"for_seconds"`
+}
+
+// RuleMatch selects flows. Empty fields match everything; CIDR and Port
+// match either end of a flow. Countries, ExcludeCountries and ASNs match the
+// remote ends whose country or AS is known, so they need the GeoIP
+// databases.
+type RuleMatch struct {
+	CIDR             string   `mapstructure:"cidr"`
+	Port             int      `mapstructure:"port"`
+	Protocol         string   `mapstructure:"protocol"`
+	Direction        string   `mapstructure:"direction"`
+	Countries        []string `mapstructure:"countries"`
+	ExcludeCountries []string `mapstructure:"exclude_countries"`
+	ASNs             []uint   `mapstructure:"asns"`
+}
+
+// ForIntervals converts ForSeconds into a number of monitoring intervals,
+// rounding up. A rule always needs at least one interval.
+func (r RuleConfig) ForIntervals(intervalSeconds int) int {
+	if intervalSeconds <= 0 || r.ForSeconds <= 0 {
+		return 1
+	}
+	return (r.ForSeconds + intervalSeconds - 1) / intervalSeconds
+}
+
+// InterfaceConfig holds the settings for one capture interface. Zero values
+// inherit the corresponding top-level setting.
+type InterfaceConfig struct {
+	Name string `mapstructure:"name"`
+
+	ThresholdMbps   float64 `mapstructure:"threshold_mbps"`
+	RxThresholdMbps float64 `mapstructure:"rx_threshold_mbps"`
+	TxThresholdMbps float64 `mapstructure:"tx_threshold_mbps"`
+
+	ClearThresholdMbps   float64 `mapstructure:"clear_threshold_mbps"`
+	RxClearThresholdMbps float64 `mapstructure:"rx_clear_threshold_mbps"`
+	TxClearThresholdMbps float64 `mapstructure:"tx_clear_threshold_mbps"`
+
+	MinThresholdMbps   float64 `mapstructure:"min_threshold_mbps"`
+	NoTrafficIntervals int     `mapstructure:"no_traffic_intervals"`
+
+	LocalNetworks []string `mapstructure:"local_networks"`
+
+	BPFFilter   string `mapstructure:"bpf_filter"`
+	SnapshotLen int    `mapstructure:"snapshot_len"`
+	Promiscuous *bool  `mapstructure:"promiscuous"`
+}
+
+func setDefaults() {
 	viper.SetDefault("interface", "")
 	viper.SetDefault("threshold_mbps", 100.0)
+	viper.SetDefault("rx_threshold_mbps", 0.0)
+	viper.SetDefault("tx_threshold_mbps", 0.0)
+	viper.SetDefault("clear_threshold_mbps", 0.0)
+	viper.SetDefault("rx_clear_threshold_mbps", 0.0)
+	viper.SetDefault("tx_clear_threshold_mbps", 0.0)
+	viper.SetDefault("min_threshold_mbps", 0.0)
+	viper.SetDefault("no_traffic_intervals", 0)
+	viper.SetDefault("alert_for_intervals", 1)
+	viper.SetDefault("alert_cooldown_seconds", 3600)
+	viper.SetDefault("local_networks", []string{})
+
+	viper.SetDefault("bpf_filter", "ip or ip6")
+	viper.SetDefault("snapshot_len", 1024)
+	viper.SetDefault("promiscuous", true)
 	viper.SetDefault("webhook_url", "")
+	viper.SetDefault("notify_queue_path", "")
+	viper.SetDefault("notify_max_attempts", 20)
+	viper.SetDefault("notify_drain_seconds", 10)
+	viper.SetDefault("summary_interval_hours", 0)
 	viper.SetDefault("interval_seconds", 60)
 	viper.SetDefault("top_n", 5)
 
+	viper.SetDefault("flow_idle_timeout_seconds", 60)
+	viper.SetDefault("flow_active_timeout_seconds", 1800)
+	viper.SetDefault("flow_max_entries", 100000)
+
 	viper.SetDefault("metrics_enabled", true)
 	viper.SetDefault("metrics_port", "9090")
+	viper.SetDefault("api_enabled", false)
+	viper.SetDefault("api_port", "")
+	viper.SetDefault("dashboard_enabled", false)
+
+	viper.SetDefault("dns_snooping", false)
+	viper.SetDefault("reverse_dns", false)
+	viper.SetDefault("reverse_dns_cache_size", 10000)
+	viper.SetDefault("reverse_dns_rate", 10.0)
+	viper.SetDefault("hostname_metrics", false)
+
+	viper.SetDefault("process_attribution", false)
+	viper.SetDefault("process_metrics", false)
+	viper.SetDefault("proc_path", "/proc")
+	viper.SetDefault("docker_socket", "/var/run/docker.sock")
+
+	viper.SetDefault("geoip_country_db", "")
+	viper.SetDefault("geoip_asn_db", "")
+	viper.SetDefault("geoip_metrics", false)
+
+	viper.SetDefault("read_file", "")
+	viper.SetDefault("replay_speed", 0.0)
+	viper.SetDefault("storage_path", "")
+	viper.SetDefault("storage_raw_retention_hours", 24)
+	viper.SetDefault("storage_minute_retention_days", 7)
+	viper.SetDefault("storage_hour_retention_days", 90)
+	viper.SetDefault("storage_day_retention_days", 730)
+}
+
+func registerFlags(flags *pflag.FlagSet) {
+	flags.String("config", "", "Path to config file (e.g., config.yaml)")
+	flags.String("interface", viper.GetString("interface"), "Network interface name")
+	flags.Float64("threshold_mbps", viper.GetFloat64("threshold_mbps"), "Speed threshold in Mbps")
+	flags.Float64("rx_threshold_mbps", viper.GetFloat64("rx_threshold_mbps"), "Download (rx) speed threshold in Mbps (0 disables)")
+	flags.Float64("tx_threshold_mbps", viper.GetFloat64("tx_threshold_mbps"), "Upload (tx) speed threshold in Mbps (0 disables)")
+	flags.Float64("clear_threshold_mbps", viper.GetFloat64("clear_threshold_mbps"), "Speed in Mbps below which a firing alert resolves (0 = threshold_mbps)")
+	flags.Float64("rx_clear_threshold_mbps", viper.GetFloat64("rx_clear_threshold_mbps"), "Download speed in Mbps below which a firing rx alert resolves (0 = rx_threshold_mbps)")
+	flags.Float64("tx_clear_threshold_mbps", viper.GetFloat64("tx_clear_threshold_mbps"), "Upload speed in Mbps below which a firing tx alert resolves (0 = tx_threshold_mbps)")
+	flags.Float64("min_threshold_mbps", viper.GetFloat64("min_threshold_mbps"), "Alert when the speed stays below this value in Mbps (0 disables)")
+	flags.Int("no_traffic_intervals", viper.GetInt("no_traffic_intervals"), "Alert after this many consecutive intervals without any packets (0 disables)")
+	flags.Int("alert_for_intervals", viper.GetInt("alert_for_intervals"), "Consecutive intervals a threshold must be exceeded before alerting")
+	flags.Int("alert_cooldown_seconds", viper.GetInt("alert_cooldown_seconds"), "Minimum seconds between repeated notifications for the same alert")
+	flags.StringSlice("local_networks", viper.GetStringSlice("local_networks"), "Additional CIDRs treated as local when classifying rx/tx traffic")
+
+	flags.String("bpf_filter", viper.GetString("bpf_filter"), "BPF filter expression applied to captured packets")
+	flags.Int("snapshot_len", viper.GetInt("snapshot_len"), "Maximum number of bytes captured per packet")
+	flags.Bool("promiscuous", viper.GetBool("promiscuous"), "Capture in promiscuous mode")
+	flags.String("webhook_url", viper.GetString("webhook_url"), "Discord webhook URL")
+	flags.String("notify_queue_path", viper.GetString("notify_queue_path"), "Path of a file that keeps undelivered notifications across restarts (empty keeps them in memory)")
+	flags.Int("notify_max_attempts", viper.GetInt("notify_max_attempts"), "Attempts per notification before it is dropped")
+	flags.Int("notify_drain_seconds", viper.GetInt("notify_drain_seconds"), "How long shutdown waits for queued notifications to be sent")
+	flags.Int("summary_interval_hours", viper.GetInt("summary_interval_hours"), "Send a traffic summary every this many hours and at shutdown (0 = off)")
+	flags.Int("interval_seconds", viper.GetInt("interval_seconds"), "Monitoring interval in seconds")
+	flags.Int("top_n", viper.GetInt("top_n"), "Number of top talkers to report")
+
+	flags.Int("flow_idle_timeout_seconds", viper.GetInt("flow_idle_timeout_seconds"), "Expire flows with no packets for this many seconds")
+	flags.Int("flow_active_timeout_seconds", viper.GetInt("flow_active_timeout_seconds"), "Restart long-lived flow records after this many seconds")
+	flags.Int("flow_max_entries", viper.GetInt("flow_max_entries"), "Maximum number of tracked flows")
+
+	flags.Bool("metrics_enabled", viper.GetBool("metrics_enabled"), "Enable Prometheus metrics endpoint")
+	flags.String("metrics_port", viper.GetString("metrics_port"), "Port for Prometheus metrics endpoint")
+	flags.Bool("api_enabled", viper.GetBool("api_enabled"), "Enable the JSON API")
+	flags.String("api_port", viper.GetString("api_port"), "Port for the JSON API (empty = serve it on the metrics port)")
+	flags.Bool("dashboard_enabled", viper.GetBool("dashboard_enabled"), "Serve the web dashboard next to the JSON API")
+
+	flags.Bool("dns_snooping", viper.GetBool("dns_snooping"), "Learn hostnames from DNS responses seen on the wire")
+	flags.Bool("reverse_dns", viper.GetBool("reverse_dns"), "Look up PTR records for addresses without a snooped hostname")
+	flags.Int("reverse_dns_cache_size", viper.GetInt("reverse_dns_cache_size"), "Maximum number of cached reverse DNS results")
+	flags.Float64("reverse_dns_rate", viper.GetFloat64("reverse_dns_rate"), "Maximum reverse DNS lookups per second")
+	flags.Bool("hostname_metrics", viper.GetBool("hostname_metrics"), "Export network_host_info with the hostname of every host")
 
-	pflag.StringVar(&cfg.ConfigFile, "config", "", "Path to config file (e.g., config.yaml)")
-	pflag.String("interface", viper.GetString("interface"), "Network interface name")
-	pflag.Float64("threshold_mbps", viper.GetFloat64("threshold_mbps"), "Speed threshold in Mbps")
-	pflag.String("webhook_url", viper.GetString("webhook_url"), "Discord webhook URL")
-	pflag.Int("interval_seconds", viper.GetInt("interval_seconds"), "Monitoring interval in seconds")
-	pflag.Int("top_n", viper.GetInt("top_n"), "Number of top talkers to report")
+	flags.Bool("process_attribution", viper.GetBool("process_attribution"), "Attribute local flows to processes and containers via /proc")
+	flags.Bool("process_metrics", viper.GetBool("process_metrics"), "Export per-process speeds as Prometheus metrics (needs process_attribution)")
+	flags.String("proc_path", viper.GetString("proc_path"), "Path of the proc filesystem used for process attribution")
+	flags.String("docker_socket", viper.GetString("docker_socket"), "Docker API socket used to look up container names (empty disables)")
 
-	pflag.Bool("metrics_enabled", viper.GetBool("metrics_enabled"), "Enable Prometheus metrics endpoint")
-	pflag.String("metrics_port", viper.GetString("metrics_port"), "Port for Prometheus metrics endpoint")
+	flags.String("geoip_country_db", viper.GetString("geoip_country_db"), "Path of a MaxMind Country or City database (.mmdb)")
+	flags.String("geoip_asn_db", viper.GetString("geoip_asn_db"), "Path of a MaxMind ASN database (.mmdb)")
+	flags.Bool("geoip_metrics", viper.GetBool("geoip_metrics"), "Export per-country and per-ASN traffic as Prometheus metrics")
+
+	flags.String("read_file", viper.GetString("read_file"), "Replay packets from a pcap/pcapng file instead of capturing live")
+	flags.Float64("replay_speed", viper.GetFloat64("replay_speed"), "Replay speed multiplier for read_file (1 = recorded speed, 0 = as fast as possible)")
+
+	flags.String("storage_path", viper.GetString("storage_path"), "Path of the traffic history database (empty disables history)")
+	flags.Int("storage_raw_retention_hours", viper.GetInt("storage_raw_retention_hours"), "Hours to keep per-interval history (0 = forever)")
+	flags.Int("storage_minute_retention_days", viper.GetInt("storage_minute_retention_days"), "Days to keep per-minute history (0 = forever)")
+	flags.Int("storage_hour_retention_days", viper.GetInt("storage_hour_retention_days"), "Days to keep per-hour history (0 = forever)")
+	flags.Int("storage_day_retention_days", viper.GetInt("storage_day_retention_days"), "Days to keep per-day history (0 = forever)")
+}
+
+func LoadConfig() (*Config, error) {
+	var cfg Config
+
+	setDefaults()
+	if pflag.Lookup("config") == nil {
+		registerFlags(pflag.CommandLine)
+	}
 
 	pflag.VisitAll(func(f *pflag.Flag) {
 		viper.BindPFlag(f.Name, f)
 	})
 	pflag.Parse()
+	cfg.ConfigFile, _ = pflag.CommandLine.GetString("config")
 
 	viper.SetEnvPrefix("NM")
 	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_", "-", "_"))
@@ -69,7 +361,8 @@ func LoadConfig() (*Config, error) {
 	}
 
 	if err := viper.ReadInConfig(); err != nil {
-		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
+		var notFound viper.ConfigFileNotFoundError
+		if errors.As(err, &notFound) || errors.Is(err, fs.ErrNotExist) {
 
 			if cfg.ConfigFile != "" {
 				return nil, fmt.Errorf("config file specified but not found: %w", err)
@@ -86,22 +379,478 @@ func LoadConfig() (*Config, error) {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
 
-	if cfg.WebhookURL == "" {
-		fmt.Println("Warning: Discord webhook URL is not set. Notifications will not be sent.")
+	if cfg.WebhookURL == "" && len(cfg.Notifiers) == 0 {
+		fmt.Println("Warning: No webhook URL or notifiers are configured. Notifications will not be sent.")
 	}
-	if cfg.IntervalSeconds <= 0 {
-		return nil, fmt.Errorf("interval_seconds must be positive")
+	if err := cfg.Validate(); err != nil {
+		return nil, err
 	}
-	if cfg.TopN <= 0 {
-		return nil, fmt.Errorf("top_n must be positive")
+
+	return &cfg, nil
+}
+
+// Reload re-reads the config file on top of the flags and environment
+// variables given at startup and validates the result.
+func Reload() (*Config, error) {
+	if viper.ConfigFileUsed() == "" {
+		return nil, fmt.Errorf("no config file in use")
+	}
+	if err := viper.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
-	if cfg.ThresholdMbps <= 0 {
-		return nil, fmt.Errorf("threshold_mbps must be positive")
+
+	var cfg Config
+	if err := viper.Unmarshal(&cfg); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
+	cfg.ConfigFile, _ = pflag.CommandLine.GetString("config")
 
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
 	return &cfg, nil
 }
 
+// Watch calls onChange whenever the config file changes on disk. It returns
+// false if no config file is in use.
+func Watch(onChange func()) bool {
+	if viper.ConfigFileUsed() == "" {
+		return false
+	}
+	viper.OnConfigChange(func(fsnotify.Event) {
+		onChange()
+	})
+	viper.WatchConfig()
+	return true
+}
+
+func (c *Config) Validate() error {
+	if c.IntervalSeconds <= 0 {
+		return fmt.Errorf("interval_seconds must be positive")
+	}
+	if c.TopN <= 0 {
+		return fmt.Errorf("top_n must be positive")
+	}
+	if c.ThresholdMbps <= 0 {
+		return fmt.Errorf("threshold_mbps must be positive")
+	}
+	if c.SnapshotLen <= 0 || c.SnapshotLen > maxSnapshotLen {
+		return fmt.Errorf("snapshot_len must be between 1 and %d", maxSnapshotLen)
+	}
+	if c.FlowIdleTimeoutSeconds <= 0 {
+		return fmt.Errorf("flow_idle_timeout_seconds must be positive")
+	}
+	if c.FlowActiveTimeoutSeconds <= 0 {
+		return fmt.Errorf("flow_active_timeout_seconds must be positive")
+	}
+	if c.FlowMaxEntries <= 0 {
+		return fmt.Errorf("flow_max_entries must be positive")
+	}
+	if c.RxThresholdMbps < 0 {
+		return fmt.Errorf("rx_threshold_mbps must not be negative")
+	}
+	if c.TxThresholdMbps < 0 {
+		return fmt.Errorf("tx_threshold_mbps must not be negative")
+	}
+	if err := validateClearThreshold("clear_threshold_mbps", c.ClearThresholdMbps, c.ThresholdMbps); err != nil {
+		return err
+	}
+	if err := validateClearThreshold("rx_clear_threshold_mbps", c.RxClearThresholdMbps, c.RxThresholdMbps); err != nil {
+		return err
+	}
+	if err := validateClearThreshold("tx_clear_threshold_mbps", c.TxClearThresholdMbps, c.TxThresholdMbps); err != nil {
+		return err
+	}
+	if err := validateLowTraffic("", c.MinThresholdMbps, c.ThresholdMbps, c.NoTrafficIntervals); err != nil {
+		return err
+	}
+	if c.AlertForIntervals <= 0 {
+		return fmt.Errorf("alert_for_intervals must be positive")
+	}
+	if c.AlertCooldownSeconds < 0 {
+		return fmt.Errorf("alert_cooldown_seconds must not be negative")
+	}
+	if err := validateNetworks("local_networks", c.LocalNetworks); err != nil {
+		return err
+	}
+	if c.ReplaySpeed < 0 {
+		return fmt.Errorf("replay_speed must not be negative")
+	}
+	if c.StorageRawRetentionHours < 0 || c.StorageMinuteRetentionDays < 0 || c.StorageHourRetentionDays < 0 || c.StorageDayRetentionDays < 0 {
+		return fmt.Errorf("storage retention settings must not be negative")
+	}
+
+	if c.ReverseDNS && (c.ReverseDNSCacheSize <= 0 || c.ReverseDNSRate <= 0) {
+		return fmt.Errorf("reverse_dns_cache_size and reverse_dns_rate must be positive")
+	}
+	if c.ProcessMetrics && !c.ProcessAttribution {
+		return fmt.Errorf("process_metrics requires process_attribution")
+	}
+	if c.GeoIPMetrics && c.GeoIPCountryDB == "" && c.GeoIPASNDB == "" {
+		return fmt.Errorf("geoip_metrics requires geoip_country_db or geoip_asn_db")
+	}
+
+	if c.ReadFile != "" && len(c.Interfaces) > 0 {
+		return fmt.Errorf("read_file cannot be combined with interfaces")
+	}
+
+	if err := c.validateRules(); err != nil {
+		return err
+	}
+
+	if c.NotifyMaxAttempts < 1 {
+		return fmt.Errorf("notify_max_attempts must be at least 1")
+	}
+	if c.NotifyDrainSeconds < 0 {
+		return fmt.Errorf("notify_drain_seconds must not be negative")
+	}
+	if c.SummaryIntervalHours < 0 {
+		return fmt.Errorf("summary_interval_hours must not be negative")
+	}
+	notifierNames := make(map[string]bool)
+	if c.WebhookURL != "" {
+		notifierNames[NotifierDiscord] = true
+	}
+	if err := validateTemplates("templates", c.Templates); err != nil {
+		return err
+	}
+	for i, notifier := range c.Notifiers {
+		field := fmt.Sprintf("notifiers[%d]", i)
+		if err := validateTemplates(field+".templates", notifier.Templates); err != nil {
+			return err
+		}
+		name := c.NotifierName(i)
+		if notifierNames[name] {
+			return fmt.Errorf("%s: notifier name %q is used more than once", field, name)
+		}
+		notifierNames[name] = true
+		switch notifier.Type {
+		case NotifierDiscord, NotifierSlack, NotifierTeams, NotifierWebhook:
+			if notifier.WebhookURL == "" {
+				return fmt.Errorf("%s.webhook_url is required for %s notifiers", field, notifier.Type)
+			}
+		case NotifierEmail:
+			if err := validateEmail(field, notifier); err != nil {
+				return err
+			}
+		case "":
+			return fmt.Errorf("%s.type is required", field)
+		default:
+			return fmt.Errorf("%s.type %q is not supported", field, notifier.Type)
+		}
+		if notifier.Type == NotifierWebhook {
+			if u, err := url.Parse(notifier.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("%s.webhook_url must be an http or https URL", field)
+			}
+		} else if len(notifier.Headers) > 0 || notifier.BearerToken != "" || notifier.Secret != "" {
+			return fmt.Errorf("%s: headers, bearer_token and secret are only supported for webhook notifiers", field)
+		}
+		if notifier.Type != NotifierEmail && (notifier.SMTPHost != "" || notifier.From != "" || len(notifier.To) > 0 || len(notifier.Recipients) > 0) {
+			return fmt.Errorf("%s: smtp_host, from, to and recipients are only supported for email notifiers", field)
+		}
+	}
+
+	names := make(map[string]bool)
+	for i, iface := range c.Interfaces {
+		if names[iface.Name] {
+			if iface.Name == "" {
+				return fmt.Errorf("interfaces: only one entry may omit the name for auto-selection")
+			}
+			return fmt.Errorf("interfaces: %s is listed more than once", iface.Name)
+		}
+		names[iface.Name] = true
+
+		field := fmt.Sprintf("interfaces[%d]", i)
+		if iface.ThresholdMbps < 0 {
+			return fmt.Errorf("%s.threshold_mbps must not be negative", field)
+		}
+		if iface.RxThresholdMbps < 0 {
+			return fmt.Errorf("%s.rx_threshold_mbps must not be negative", field)
+		}
+		if iface.TxThresholdMbps < 0 {
+			return fmt.Errorf("%s.tx_threshold_mbps must not be negative", field)
+		}
+		if err := validateClearThreshold(field+".clear_threshold_mbps", iface.ClearThresholdMbps, iface.ThresholdMbps); err != nil {
+			return err
+		}
+		if err := validateClearThreshold(field+".rx_clear_threshold_mbps", iface.RxClearThresholdMbps, iface.RxThresholdMbps); err != nil {
+			return err
+		}
+		if err := validateClearThreshold(field+".tx_clear_threshold_mbps", iface.TxClearThresholdMbps, iface.TxThresholdMbps); err != nil {
+			return err
+		}
+		if err := validateLowTraffic(field+".", iface.MinThresholdMbps, iface.ThresholdMbps, iface.NoTrafficIntervals); err != nil {
+			return err
+		}
+		if err := validateNetworks(field+".local_networks", iface.LocalNetworks); err != nil {
+			return err
+		}
+		if iface.SnapshotLen < 0 || iface.SnapshotLen > maxSnapshotLen {
+			return fmt.Errorf("%s.snapshot_len must be between 1 and %d", field, maxSnapshotLen)
+		}
+	}
+
+	return nil
+}
+
+func (c *Config) validateRules() error {
+	names := make(map[string]bool)
+	for i, rule := range c.Rules {
+		field := fmt.Sprintf("rules[%d]", i)
+		if rule.Name == "" {
+			return fmt.Errorf("%s.name is required", field)
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("%s: rule name %q is used more than once", field, rule.Name)
+		}
+		names[rule.Name] = true
+
+		switch rule.Metric {
+		case RuleMetricMbps, RuleMetricBytes, RuleMetricPPS:
+		default:
+			return fmt.Errorf("%s.metric must be one of %s, %s or %s", field, RuleMetricMbps, RuleMetricBytes, RuleMetricPPS)
+		}
+		if rule.Comparison != ">" && rule.Comparison != "<" {
+			return fmt.Errorf("%s.comparison must be \">\" or \"<\"", field)
+		}
+		if rule.Threshold < 0 {
+			return fmt.Errorf("%s.threshold must not be negative", field)
+		}
+		if rule.ForSeconds < 0 {
+			return fmt.Errorf("%s.for_seconds must not be negative", field)
+		}
+
+		if rule.Match.CIDR != "" {
+			if err := validateNetworks(field+".match.cidr", []string{rule.Match.CIDR}); err != nil {
+				return err
+			}
+		}
+		if rule.Match.Port < 0 || rule.Match.Port > 65535 {
+			return fmt.Errorf("%s.match.port must be between 0 and 65535", field)
+		}
+		switch rule.Match.Direction {
+		case "", "rx", "tx", "local", "transit":
+		default:
+			return fmt.Errorf("%s.match.direction must be one of rx, tx, local or transit", field)
+		}
+		if len(rule.Match.Countries) > 0 || len(rule.Match.ExcludeCountries) > 0 {
+			if c.GeoIPCountryDB == "" {
+				return fmt.Errorf("%s.match: countries and exclude_countries require geoip_country_db", field)
+			}
+			for _, code := range append(rule.Match.Countries, rule.Match.ExcludeCountries...) {
+				if len(code) != 2 {
+					return fmt.Errorf("%s.match: %q is not a two-letter country code", field, code)
+				}
+			}
+		}
+		if len(rule.Match.ASNs) > 0 && c.GeoIPASNDB == "" {
+			return fmt.Errorf("%s.match.asns requires geoip_asn_db", field)
+		}
+	}
+	return nil
+}
+
+func validateClearThreshold(field string, clear, threshold float64) error {
+	if clear < 0 {
+		return fmt.Errorf("%s must not be negative", field)
+	}
+	if clear > 0 && threshold > 0 && clear > threshold {
+		return fmt.Errorf("%s must not be above its threshold", field)
+	}
+	return nil
+}
+
+func validateLowTraffic(prefix string, minThreshold, threshold float64, noTrafficIntervals int) error {
+	if minThreshold < 0 {
+		return fmt.Errorf("%smin_threshold_mbps must not be negative", prefix)
+	}
+	if minThreshold > 0 && threshold > 0 && minThreshold >= threshold {
+		return fmt.Errorf("%smin_threshold_mbps must be below threshold_mbps", prefix)
+	}
+	if noTrafficIntervals < 0 {
+		return fmt.Errorf("%sno_traffic_intervals must not be negative", prefix)
+	}
+	return nil
+}
+
+func validateNetworks(field string, networks []string) error {
+	for _, network := range networks {
+		if _, _, err := net.ParseCIDR(network); err != nil && net.ParseIP(network) == nil {
+			return fmt.Errorf("%s entry %q is not a valid CIDR or IP address", field, network)
+		}
+	}
+	return nil
+}
+
+// InterfaceConfigs returns the interfaces to monitor with inherited settings
+// filled in. Without an interfaces list, the top-level interface is used.
+func (c *Config) InterfaceConfigs() []InterfaceConfig {
+	if len(c.Interfaces) == 0 {
+		return []InterfaceConfig{{
+			Name:            c.InterfaceName,
+			ThresholdMbps:   c.ThresholdMbps,
+			RxThresholdMbps: c.RxThresholdMbps,
+			TxThresholdMbps: c.TxThresholdMbps,
+
+			ClearThresholdMbps:   c.ClearThresholdMbps,
+			RxClearThresholdMbps: c.RxClearThresholdMbps,
+			TxClearThresholdMbps: c.TxClearThresholdMbps,
+
+			MinThresholdMbps:   c.MinThresholdMbps,
+			NoTrafficIntervals: c.NoTrafficIntervals,
+
+			LocalNetworks: c.LocalNetworks,
+			BPFFilter:     c.BPFFilter,
+			SnapshotLen:   c.SnapshotLen,
+			Promiscuous:   boolPtr(c.Promiscuous),
+		}}
+	}
+
+	resolved := make([]InterfaceConfig, 0, len(c.Interfaces))
+	for _, iface := range c.Interfaces {
+		// Clear thresholds are only inherited together with the threshold
+		// they belong to; an overridden threshold clears at itself.
+		if iface.ThresholdMbps == 0 {
+			iface.ThresholdMbps = c.ThresholdMbps
+			if iface.ClearThresholdMbps == 0 {
+				iface.ClearThresholdMbps = c.ClearThresholdMbps
+			}
+		}
+		if iface.RxThresholdMbps == 0 {
+			iface.RxThresholdMbps = c.RxThresholdMbps
+			if iface.RxClearThresholdMbps == 0 {
+				iface.RxClearThresholdMbps = c.RxClearThresholdMbps
+			}
+		}
+		if iface.TxThresholdMbps == 0 {
+			iface.TxThresholdMbps = c.TxThresholdMbps
+			if iface.TxClearThresholdMbps == 0 {
+				iface.TxClearThresholdMbps = c.TxClearThresholdMbps
+			}
+		}
+		if iface.MinThresholdMbps == 0 {
+			iface.MinThresholdMbps = c.MinThresholdMbps
+		}
+		if iface.NoTrafficIntervals == 0 {
+			iface.NoTrafficIntervals = c.NoTrafficIntervals
+		}
+		if len(iface.LocalNetworks) == 0 {
+			iface.LocalNetworks = c.LocalNetworks
+		}
+		if iface.BPFFilter == "" {
+			iface.BPFFilter = c.BPFFilter
+		}
+		if iface.SnapshotLen == 0 {
+			iface.SnapshotLen = c.SnapshotLen
+		}
+		if iface.Promiscuous == nil {
+			iface.Promiscuous = boolPtr(c.Promiscuous)
+		}
+		resolved = append(resolved, iface)
+	}
+	return resolved
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func validateEmail(field string, notifier NotifierConfig) error {
+	if notifier.SMTPHost == "" {
+		return fmt.Errorf("%s.smtp_host is required for email notifiers", field)
+	}
+	if notifier.SMTPPort < 0 || notifier.SMTPPort > 65535 {
+		return fmt.Errorf("%s.smtp_port must be between 1 and 65535", field)
+	}
+	switch notifier.SMTPTLS {
+	case "", SMTPStartTLS, SMTPTLS, SMTPNone:
+	default:
+		return fmt.Errorf("%s.smtp_tls must be one of %s, %s or %s", field, SMTPStartTLS, SMTPTLS, SMTPNone)
+	}
+	if notifier.WebhookURL != "" {
+		return fmt.Errorf("%s.webhook_url is not used by email notifiers", field)
+	}
+	if notifier.From == "" {
+		return fmt.Errorf("%s.from is required for email notifiers", field)
+	}
+	if _, err := mail.ParseAddress(notifier.From); err != nil {
+		return fmt.Errorf("%s.from: invalid address %q: %w", field, notifier.From, err)
+	}
+
+	count := len(notifier.To)
+	for _, addr := range notifier.To {
+		if _, err := mail.ParseAddress(addr); err != nil {
+			return fmt.Errorf("%s.to: invalid address %q: %w", field, addr, err)
+		}
+	}
+	for severity, addrs := range notifier.Recipients {
+		switch alert.Severity(severity) {
+		case alert.SeverityCritical, alert.SeverityWarning, alert.SeverityInfo:
+		default:
+			return fmt.Errorf("%s.recipients: unknown severity %q, must be one of %s, %s or %s",
+				field, severity, alert.SeverityCritical, alert.SeverityWarning, alert.SeverityInfo)
+		}
+		for _, addr := range addrs {
+			if _, err := mail.ParseAddress(addr); err != nil {
+				return fmt.Errorf("%s.recipients.%s: invalid address %q: %w", field, severity, addr, err)
+			}
+		}
+		count += len(addrs)
+	}
+	if count == 0 {
+		return fmt.Errorf("%s: email notifiers need at least one address in to or recipients", field)
+	}
+	return nil
+}
+
+func validateTemplates(field string, templates map[string]string) error {
+	for kind, path := range templates {
+		if path == "" {
+			return fmt.Errorf("%s.%s: path is required", field, kind)
+		}
+	}
+	return nil
+}
+
+// NotifierTemplates returns the template files of the i-th notifier: the
+// top-level ones with the notifier's own on top.
+func (c *Config) NotifierTemplates(i int) map[string]string {
+	if len(c.Notifiers[i].Templates) == 0 {
+		return c.Templates
+	}
+	merged := make(map[string]string, len(c.Templates)+len(c.Notifiers[i].Templates))
+	for kind, path := range c.Templates {
+		merged[kind] = path
+	}
+	for kind, path := range c.Notifiers[i].Templates {
+		merged[kind] = path
+	}
+	return merged
+}
+
+// NotifierName returns the name of the i-th notifier: its configured name or
+// "<type>-<i>". A top-level webhook_url is the Discord notifier "discord".
+func (c *Config) NotifierName(i int) string {
+	if c.Notifiers[i].Name != "" {
+		return c.Notifiers[i].Name
+	}
+	return fmt.Sprintf("%s-%d", c.Notifiers[i].Type, i)
+}
+
+// GetNotifyDrainTimeout is how long Close waits for queued notifications.
+func (c *Config) GetNotifyDrainTimeout() time.Duration {
+	return time.Duration(c.NotifyDrainSeconds) * time.Second
+}
+
+// GetSummaryInterval is the period of traffic summaries, 0 if they are off.
+func (c *Config) GetSummaryInterval() time.Duration {
+	return time.Duration(c.SummaryIntervalHours) * time.Hour
+}
+
+func (c *Config) GetAlertCooldown() time.Duration {
+	return time.Duration(c.AlertCooldownSeconds) * time.Second
+}
+
 func (c *Config) GetIntervalDuration() time.Duration {
 	return time.Duration(c.IntervalSeconds) * time.Second
 }
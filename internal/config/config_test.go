@@ -15,6 +15,8 @@ import (
 func resetViper() {
 	viper.Reset()
 	pflag.CommandLine = pflag.NewFlagSet(os.Args[0], pflag.ExitOnError)
+	setDefaults()
+	registerFlags(pflag.CommandLine)
 }
 
 func createTempConfigFile(t *testing.T, content string) string {
@@ -89,12 +91,6 @@ func TestLoadConfigEnvVars(t *testing.T) {
 func TestLoadConfigFlags(t *testing.T) {
 	resetViper()
 
-	pflag.String("interface", "", "")
-	pflag.Float64("threshold_mbps", 0, "")
-	pflag.String("webhook_url", "", "")
-	pflag.Int("interval_seconds", 0, "")
-	pflag.Int("top_n", 0, "")
-
 	pflag.Set("interface", "flag_iface")
 	pflag.Set("threshold_mbps", "99.9")
 	pflag.Set("webhook_url", "http://flag.hook")
@@ -130,12 +126,6 @@ top_n: 50
 
 	t.Setenv("NM_TOP_N", "10")
 
-	pflag.String("interface", "", "")
-	pflag.Float64("threshold_mbps", 0, "")
-	pflag.String("webhook_url", "", "")
-	pflag.Int("interval_seconds", 0, "")
-	pflag.Int("top_n", 0, "")
-
 	pflag.Set("interface", "flag_iface")
 
 	pflag.Set("webhook_url", "http://flag.hook")
@@ -203,11 +193,6 @@ func TestLoadConfigValidation(t *testing.T) {
 				t.Setenv(k, v)
 			}
 
-			pflag.String("interface", "", "")
-			pflag.Float64("threshold_mbps", 0, "")
-			pflag.String("webhook_url", "", "")
-			pflag.Int("interval_seconds", 0, "")
-			pflag.Int("top_n", 0, "")
 			for k, v := range tc.flags {
 				err := pflag.Set(k, v)
 				require.NoError(t, err, "Failed to set flag %s=%s", k, v)
@@ -248,3 +233,629 @@ func TestLoadConfigBadFileFormat(t *testing.T) {
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to read config file")
 }
+
+func TestLoadConfigReplay(t *testing.T) {
+	resetViper()
+
+	pflag.Set("read_file", "/tmp/incident.pcapng")
+	pflag.Set("replay_speed", "2")
+
+	cfg, err := LoadConfig()
+	assert.NoError(t, err)
+	require.NotNil(t, cfg)
+
+	assert.Equal(t, "/tmp/incident.pcapng", cfg.ReadFile)
+	assert.Equal(t, 2.0, cfg.ReplaySpeed)
+}
+
+func TestLoadConfigReplayNegativeSpeed(t *testing.T) {
+	resetViper()
+
+	t.Setenv("NM_REPLAY_SPEED", "-1")
+
+	_, err := LoadConfig()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "replay_speed must not be negative")
+}
+
+func TestLoadConfigDirection(t *testing.T) {
+	resetViper()
+	configFileContent := `
+rx_threshold_mbps: 80
+tx_threshold_mbps: 20
+local_networks:
+  - "192.168.0.0/16"
+  - "10.0.0.1"
+`
+	configFile := createTempConfigFile(t, configFileContent)
+	pflag.Set("config", configFile)
+
+	cfg, err := LoadConfig()
+	assert.NoError(t, err)
+	require.NotNil(t, cfg)
+
+	assert.Equal(t, 80.0, cfg.RxThresholdMbps)
+	assert.Equal(t, 20.0, cfg.TxThresholdMbps)
+	assert.Equal(t, []string{"192.168.0.0/16", "10.0.0.1"}, cfg.LocalNetworks)
+}
+
+func TestLoadConfigInvalidLocalNetwork(t *testing.T) {
+	resetViper()
+
+	t.Setenv("NM_LOCAL_NETWORKS", "192.168.0.0/33")
+
+	_, err := LoadConfig()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "local_networks entry")
+}
+
+func TestLoadConfigInterfaces(t *testing.T) {
+	resetViper()
+	configFileContent := `
+threshold_mbps: 100
+rx_threshold_mbps: 40
+local_networks: ["192.168.0.0/16"]
+interfaces:
+  - name: "wan0"
+    threshold_mbps: 900
+  - name: "vlan10"
+    tx_threshold_mbps: 5
+    local_networks: ["10.10.0.0/24"]
+`
+	configFile := createTempConfigFile(t, configFileContent)
+	pflag.Set("config", configFile)
+
+	cfg, err := LoadConfig()
+	require.NoError(t, err)
+	require.Len(t, cfg.Interfaces, 2)
+
+	ifaces := cfg.InterfaceConfigs()
+	require.Len(t, ifaces, 2)
+
+	assert.Equal(t, "wan0", ifaces[0].Name)
+	assert.Equal(t, 900.0, ifaces[0].ThresholdMbps)
+	assert.Equal(t, 40.0, ifaces[0].RxThresholdMbps)
+	assert.Equal(t, []string{"192.168.0.0/16"}, ifaces[0].LocalNetworks)
+
+	assert.Equal(t, "vlan10", ifaces[1].Name)
+	assert.Equal(t, 100.0, ifaces[1].ThresholdMbps)
+	assert.Equal(t, 5.0, ifaces[1].TxThresholdMbps)
+	assert.Equal(t, []string{"10.10.0.0/24"}, ifaces[1].LocalNetworks)
+}
+
+func TestInterfaceConfigsWithoutList(t *testing.T) {
+	cfg := &Config{InterfaceName: "eth0", ThresholdMbps: 50, TxThresholdMbps: 10}
+
+	ifaces := cfg.InterfaceConfigs()
+	require.Len(t, ifaces, 1)
+	assert.Equal(t, "eth0", ifaces[0].Name)
+	assert.Equal(t, 50.0, ifaces[0].ThresholdMbps)
+	assert.Equal(t, 10.0, ifaces[0].TxThresholdMbps)
+}
+
+func TestLoadConfigInterfacesValidation(t *testing.T) {
+	testCases := []struct {
+		name     string
+		content  string
+		errorMsg string
+	}{
+		{
+			name: "Duplicate interface",
+			content: `
+interfaces:
+  - name: "eth0"
+  - name: "eth0"
+`,
+			errorMsg: "eth0 is listed more than once",
+		},
+		{
+			name: "Two auto-selected interfaces",
+			content: `
+interfaces:
+  - threshold_mbps: 10
+  - threshold_mbps: 20
+`,
+			errorMsg: "only one entry may omit the name",
+		},
+		{
+			name: "Negative per-interface threshold",
+			content: `
+interfaces:
+  - name: "eth0"
+    threshold_mbps: -1
+`,
+			errorMsg: "interfaces[0].threshold_mbps must not be negative",
+		},
+		{
+			name: "Replay with interfaces",
+			content: `
+read_file: "capture.pcap"
+interfaces:
+  - name: "eth0"
+`,
+			errorMsg: "read_file cannot be combined with interfaces",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resetViper()
+			pflag.Set("config", createTempConfigFile(t, tc.content))
+
+			_, err := LoadConfig()
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.errorMsg)
+		})
+	}
+}
+
+func TestLoadConfigCaptureOptions(t *testing.T) {
+	resetViper()
+
+	cfg, err := LoadConfig()
+	require.NoError(t, err)
+	assert.Equal(t, "ip or ip6", cfg.BPFFilter)
+	assert.Equal(t, 1024, cfg.SnapshotLen)
+	assert.True(t, cfg.Promiscuous)
+
+	resetViper()
+	t.Setenv("NM_BPF_FILTER", "net 10.0.0.0/8 and not port 873")
+	pflag.Set("snapshot_len", "256")
+	pflag.Set("promiscuous", "false")
+
+	cfg, err = LoadConfig()
+	require.NoError(t, err)
+	assert.Equal(t, "net 10.0.0.0/8 and not port 873", cfg.BPFFilter)
+	assert.Equal(t, 256, cfg.SnapshotLen)
+	assert.False(t, cfg.Promiscuous)
+
+	ifaces := cfg.InterfaceConfigs()
+	require.Len(t, ifaces, 1)
+	assert.Equal(t, cfg.BPFFilter, ifaces[0].BPFFilter)
+	assert.Equal(t, 256, ifaces[0].SnapshotLen)
+	require.NotNil(t, ifaces[0].Promiscuous)
+	assert.False(t, *ifaces[0].Promiscuous)
+}
+
+func TestLoadConfigCaptureOptionOverrides(t *testing.T) {
+	resetViper()
+	configFileContent := `
+bpf_filter: "ip"
+snapshot_len: 512
+interfaces:
+  - name: "wan0"
+    bpf_filter: "not port 22"
+    promiscuous: false
+  - name: "lan0"
+    snapshot_len: 2048
+`
+	pflag.Set("config", createTempConfigFile(t, configFileContent))
+
+	cfg, err := LoadConfig()
+	require.NoError(t, err)
+
+	ifaces := cfg.InterfaceConfigs()
+	require.Len(t, ifaces, 2)
+	assert.Equal(t, "not port 22", ifaces[0].BPFFilter)
+	assert.Equal(t, 512, ifaces[0].SnapshotLen)
+	assert.False(t, *ifaces[0].Promiscuous)
+	assert.Equal(t, "ip", ifaces[1].BPFFilter)
+	assert.Equal(t, 2048, ifaces[1].SnapshotLen)
+	assert.True(t, *ifaces[1].Promiscuous)
+}
+
+func TestLoadConfigInvalidSnapshotLen(t *testing.T) {
+	resetViper()
+
+	t.Setenv("NM_SNAPSHOT_LEN", "0")
+
+	_, err := LoadConfig()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "snapshot_len must be between")
+}
+
+func TestLoadConfigNotifiers(t *testing.T) {
+	resetViper()
+	configFileContent := `
+notifiers:
+  - type: discord
+    name: ops
+    webhook_url: "http://ops.hook"
+`
+	pflag.Set("config", createTempConfigFile(t, configFileContent))
+
+	cfg, err := LoadConfig()
+	require.NoError(t, err)
+	require.Len(t, cfg.Notifiers, 1)
+	assert.Equal(t, NotifierConfig{Type: NotifierDiscord, Name: "ops", WebhookURL: "http://ops.hook"}, cfg.Notifiers[0])
+
+	resetViper()
+	pflag.Set("config", createTempConfigFile(t, `
+notifiers:
+  - type: discord
+`))
+	_, err = LoadConfig()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "notifiers[0].webhook_url is required")
+
+	resetViper()
+	pflag.Set("config", createTempConfigFile(t, `
+notifiers:
+  - {type: slack, webhook_url: "https://hooks.slack.com/services/T/B/X"}
+  - {type: teams, webhook_url: "https://example.webhook.office.com/x"}
+`))
+	cfg, err = LoadConfig()
+	require.NoError(t, err)
+	assert.Equal(t, "slack-0", cfg.NotifierName(0))
+	assert.Equal(t, "teams-1", cfg.NotifierName(1))
+
+	resetViper()
+	pflag.Set("config", createTempConfigFile(t, `
+notifiers:
+  - type: webhook
+    webhook_url: "https://alerts.example.com/hook"
+    headers: {X-Team: netops}
+    bearer_token: tok
+    secret: s3cret
+`))
+	cfg, err = LoadConfig()
+	require.NoError(t, err)
+	assert.Equal(t, NotifierConfig{
+		Type: NotifierWebhook, WebhookURL: "https://alerts.example.com/hook",
+		Headers: map[string]string{"x-team": "netops"}, BearerToken: "tok", Secret: "s3cret",
+	}, cfg.Notifiers[0], "header names are case-insensitive and read in lower case")
+
+	for _, tc := range []struct{ notifier, err string }{
+		{"{type: webhook, webhook_url: \"alerts.example.com/hook\"}", "notifiers[0].webhook_url must be an http or https URL"},
+		{"{type: discord, webhook_url: \"http://a.hook\", secret: s}", "notifiers[0]: headers, bearer_token and secret are only supported for webhook notifiers"},
+		{"{type: email, from: nm@example.com, to: [ops@example.com]}", "notifiers[0].smtp_host is required for email notifiers"},
+		{"{type: email, smtp_host: mail, to: [ops@example.com]}", "notifiers[0].from is required for email notifiers"},
+		{"{type: email, smtp_host: mail, from: nm@example.com}", "notifiers[0]: email notifiers need at least one address in to or recipients"},
+		{"{type: email, smtp_host: mail, from: nm@example.com, to: [ops]}", `notifiers[0].to: invalid address "ops"`},
+		{"{type: email, smtp_host: mail, from: nm@example.com, recipients: {urgent: [ops@example.com]}}", `notifiers[0].recipients: unknown severity "urgent"`},
+		{"{type: email, smtp_host: mail, smtp_tls: ssl, from: nm@example.com, to: [ops@example.com]}", "notifiers[0].smtp_tls must be one of starttls, tls or none"},
+		{"{type: slack, webhook_url: \"http://a.hook\", to: [ops@example.com]}", "notifiers[0]: smtp_host, from, to and recipients are only supported for email notifiers"},
+	} {
+		resetViper()
+		pflag.Set("config", createTempConfigFile(t, "notifiers:\n  - "+tc.notifier+"\n"))
+		_, err = LoadConfig()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), tc.err)
+	}
+
+	resetViper()
+	pflag.Set("config", createTempConfigFile(t, `
+notifiers:
+  - type: email
+    smtp_host: smtp.example.com
+    username: monitor
+    password: hunter2
+    from: "Network Monitor <monitor@example.com>"
+    to: [ops@example.com]
+    recipients:
+      critical: [oncall@example.com]
+`))
+	cfg, err = LoadConfig()
+	require.NoError(t, err)
+	assert.Equal(t, NotifierConfig{
+		Type: NotifierEmail, SMTPHost: "smtp.example.com", Username: "monitor", Password: "hunter2",
+		From: "Network Monitor <monitor@example.com>", To: []string{"ops@example.com"},
+		Recipients: map[string][]string{"critical": {"oncall@example.com"}},
+	}, cfg.Notifiers[0])
+
+	resetViper()
+	pflag.Set("config", createTempConfigFile(t, `
+notifiers:
+  - type: teams
+`))
+	_, err = LoadConfig()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "notifiers[0].webhook_url is required for teams notifiers")
+
+	resetViper()
+	pflag.Set("config", createTempConfigFile(t, `
+notifiers:
+  - type: carrier-pigeon
+`))
+	_, err = LoadConfig()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "is not supported")
+
+	resetViper()
+	pflag.Set("config", createTempConfigFile(t, `
+webhook_url: "http://main.hook"
+notifiers:
+  - {type: discord, webhook_url: "http://a.hook"}
+  - {type: discord, name: discord, webhook_url: "http://b.hook"}
+`))
+	_, err = LoadConfig()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `notifiers[1]: notifier name "discord" is used more than once`)
+}
+
+func TestLoadConfigTemplates(t *testing.T) {
+	resetViper()
+	pflag.Set("config", createTempConfigFile(t, `
+templates:
+  threshold_exceeded: /etc/nm/threshold.tmpl
+  resolved: /etc/nm/resolved.tmpl
+notifiers:
+  - {type: discord, webhook_url: "http://a.hook"}
+  - type: discord
+    webhook_url: "http://b.hook"
+    templates:
+      resolved: /etc/nm/resolved-de.tmpl
+`))
+	cfg, err := LoadConfig()
+	require.NoError(t, err)
+	assert.Equal(t, cfg.Templates, cfg.NotifierTemplates(0))
+	assert.Equal(t, map[string]string{
+		"threshold_exceeded": "/etc/nm/threshold.tmpl",
+		"resolved":           "/etc/nm/resolved-de.tmpl",
+	}, cfg.NotifierTemplates(1))
+
+	resetViper()
+	pflag.Set("config", createTempConfigFile(t, "templates:\n  resolved: \"\"\n"))
+	_, err = LoadConfig()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "templates.resolved: path is required")
+}
+
+func TestLoadConfigNotifyQueue(t *testing.T) {
+	resetViper()
+	cfg, err := LoadConfig()
+	require.NoError(t, err)
+	assert.Empty(t, cfg.NotifyQueuePath)
+	assert.Equal(t, 20, cfg.NotifyMaxAttempts)
+	assert.Equal(t, 10*time.Second, cfg.GetNotifyDrainTimeout())
+
+	resetViper()
+	t.Setenv("NM_NOTIFY_MAX_ATTEMPTS", "0")
+	_, err = LoadConfig()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "notify_max_attempts must be at least 1")
+}
+
+func TestLoadConfigSummaryInterval(t *testing.T) {
+	resetViper()
+	cfg, err := LoadConfig()
+	require.NoError(t, err)
+	assert.Zero(t, cfg.GetSummaryInterval(), "summaries are off by default")
+
+	resetViper()
+	t.Setenv("NM_SUMMARY_INTERVAL_HOURS", "24")
+	cfg, err = LoadConfig()
+	require.NoError(t, err)
+	assert.Equal(t, 24*time.Hour, cfg.GetSummaryInterval())
+
+	resetViper()
+	t.Setenv("NM_SUMMARY_INTERVAL_HOURS", "-1")
+	_, err = LoadConfig()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "summary_interval_hours must not be negative")
+}
+
+func TestLoadConfigAlertPolicy(t *testing.T) {
+	resetViper()
+	cfg, err := LoadConfig()
+	require.NoError(t, err)
+	assert.Equal(t, 1, cfg.AlertForIntervals)
+	assert.Equal(t, time.Hour, cfg.GetAlertCooldown())
+
+	resetViper()
+	configFileContent := `
+threshold_mbps: 100
+clear_threshold_mbps: 80
+alert_for_intervals: 3
+alert_cooldown_seconds: 600
+interfaces:
+  - name: "wan0"
+  - name: "vlan10"
+    threshold_mbps: 10
+`
+	pflag.Set("config", createTempConfigFile(t, configFileContent))
+
+	cfg, err = LoadConfig()
+	require.NoError(t, err)
+	assert.Equal(t, 3, cfg.AlertForIntervals)
+	assert.Equal(t, 10*time.Minute, cfg.GetAlertCooldown())
+
+	ifaces := cfg.InterfaceConfigs()
+	require.Len(t, ifaces, 2)
+	assert.Equal(t, 80.0, ifaces[0].ClearThresholdMbps)
+	assert.Equal(t, 0.0, ifaces[1].ClearThresholdMbps, "overridden threshold must not inherit the top-level clear threshold")
+
+	resetViper()
+	t.Setenv("NM_CLEAR_THRESHOLD_MBPS", "150")
+	_, err = LoadConfig()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "clear_threshold_mbps must not be above its threshold")
+}
+
+func TestLoadConfigLowTraffic(t *testing.T) {
+	resetViper()
+	configFileContent := `
+threshold_mbps: 100
+min_threshold_mbps: 1
+no_traffic_intervals: 3
+interfaces:
+  - name: "wan0"
+  - name: "vlan10"
+    min_threshold_mbps: 0.5
+`
+	pflag.Set("config", createTempConfigFile(t, configFileContent))
+
+	cfg, err := LoadConfig()
+	require.NoError(t, err)
+
+	ifaces := cfg.InterfaceConfigs()
+	require.Len(t, ifaces, 2)
+	assert.Equal(t, 1.0, ifaces[0].MinThresholdMbps)
+	assert.Equal(t, 3, ifaces[0].NoTrafficIntervals)
+	assert.Equal(t, 0.5, ifaces[1].MinThresholdMbps)
+
+	resetViper()
+	t.Setenv("NM_MIN_THRESHOLD_MBPS", "100")
+	_, err = LoadConfig()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "min_threshold_mbps must be below threshold_mbps")
+}
+
+func TestLoadConfigRules(t *testing.T) {
+	resetViper()
+	configFileContent := `
+interval_seconds: 30
+geoip_country_db: /var/lib/GeoIP/GeoLite2-Country.mmdb
+geoip_asn_db: /var/lib/GeoIP/GeoLite2-ASN.mmdb
+rules:
+  - name: nas
+    match:
+      cidr: "192.168.1.10"
+    metric: mbps
+    comparison: ">"
+    threshold: 500
+    for_seconds: 90
+  - name: printer
+    interface: lan0
+    match:
+      cidr: "192.168.1.50/32"
+      port: 9100
+      protocol: tcp
+      direction: tx
+    metric: pps
+    comparison: ">"
+    threshold: 100
+  - name: offshore
+    match:
+      direction: tx
+      exclude_countries: [US, CA]
+      asns: [64500]
+    metric: mbps
+    comparison: ">"
+    threshold: 50
+`
+	pflag.Set("config", createTempConfigFile(t, configFileContent))
+
+	cfg, err := LoadConfig()
+	require.NoError(t, err)
+	require.Len(t, cfg.Rules, 3)
+	assert.Equal(t, "nas", cfg.Rules[0].Name)
+	assert.Equal(t, 500.0, cfg.Rules[0].Threshold)
+	assert.Equal(t, 3, cfg.Rules[0].ForIntervals(cfg.IntervalSeconds))
+	assert.Equal(t, RuleMatch{CIDR: "192.168.1.50/32", Port: 9100, Protocol: "tcp", Direction: "tx"}, cfg.Rules[1].Match)
+	assert.Equal(t, 1, cfg.Rules[1].ForIntervals(cfg.IntervalSeconds))
+	assert.Equal(t, RuleMatch{Direction: "tx", ExcludeCountries: []string{"US", "CA"}, ASNs: []uint{64500}}, cfg.Rules[2].Match)
+
+	testCases := []struct {
+		name     string
+		content  string
+		errorMsg string
+	}{
+		{"Missing name", "rules:\n  - metric: mbps\n    comparison: \">\"\n", "rules[0].name is required"},
+		{"Duplicate name", "rules:\n  - {name: a, metric: mbps, comparison: \">\"}\n  - {name: a, metric: mbps, comparison: \">\"}\n", `rule name "a" is used more than once`},
+		{"Bad metric", "rules:\n  - {name: a, metric: furlongs, comparison: \">\"}\n", "rules[0].metric must be one of"},
+		{"Bad comparison", "rules:\n  - {name: a, metric: mbps, comparison: \"==\"}\n", "rules[0].comparison must be"},
+		{"Bad CIDR", "rules:\n  - {name: a, metric: mbps, comparison: \">\", match: {cidr: nope}}\n", "rules[0].match.cidr entry"},
+		{"Bad direction", "rules:\n  - {name: a, metric: mbps, comparison: \">\", match: {direction: up}}\n", "rules[0].match.direction must be"},
+		{"Countries without database", "rules:\n  - {name: a, metric: mbps, comparison: \">\", match: {countries: [DE]}}\n", "require geoip_country_db"},
+		{"Bad country", "geoip_country_db: c.mmdb\nrules:\n  - {name: a, metric: mbps, comparison: \">\", match: {exclude_countries: [Germany]}}\n", `"Germany" is not a two-letter country code`},
+		{"ASNs without database", "rules:\n  - {name: a, metric: mbps, comparison: \">\", match: {asns: [3320]}}\n", "rules[0].match.asns requires geoip_asn_db"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resetViper()
+			pflag.Set("config", createTempConfigFile(t, tc.content))
+			_, err := LoadConfig()
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.errorMsg)
+		})
+	}
+}
+
+func TestReload(t *testing.T) {
+	resetViper()
+	configFile := createTempConfigFile(t, "threshold_mbps: 100\ntop_n: 3\n")
+	pflag.Set("config", configFile)
+
+	cfg, err := LoadConfig()
+	require.NoError(t, err)
+	assert.Equal(t, 100.0, cfg.ThresholdMbps)
+
+	require.NoError(t, os.WriteFile(configFile, []byte("threshold_mbps: 250\ntop_n: 7\n"), 0644))
+	cfg, err = Reload()
+	require.NoError(t, err)
+	assert.Equal(t, 250.0, cfg.ThresholdMbps)
+	assert.Equal(t, 7, cfg.TopN)
+	assert.Equal(t, configFile, cfg.ConfigFile)
+
+	require.NoError(t, os.WriteFile(configFile, []byte("threshold_mbps: -1\n"), 0644))
+	_, err = Reload()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "threshold_mbps must be positive")
+}
+
+func TestConfigRedacted(t *testing.T) {
+	cfg := &Config{
+		InterfaceName: "eth0",
+		WebhookURL:    "https://discord.com/api/webhooks/1/secret",
+		Notifiers: []NotifierConfig{
+			{Type: NotifierDiscord, Name: "ops", WebhookURL: "https://discord.com/api/webhooks/2/secret"},
+			{Type: NotifierDiscord, Name: "empty"},
+			{Type: NotifierWebhook, Name: "receiver", Headers: map[string]string{"x-api-key": "key"}, BearerToken: "tok", Secret: "s3cret"},
+			{Type: NotifierEmail, Name: "mail", Username: "monitor", Password: "hunter2", Recipients: map[string][]string{"critical": {"oncall@example.com"}}},
+		},
+		Interfaces: []InterfaceConfig{{Name: "eth0", Promiscuous: boolPtr(false)}},
+	}
+
+	redacted := cfg.Redacted()
+	assert.Equal(t, "eth0", redacted["interface"])
+	assert.Equal(t, "REDACTED", redacted["webhook_url"])
+
+	notifiers := redacted["notifiers"].([]any)
+	require.Len(t, notifiers, 4)
+	assert.Equal(t, "REDACTED", notifiers[0].(map[string]any)["webhook_url"])
+	assert.Equal(t, "ops", notifiers[0].(map[string]any)["name"])
+	assert.Equal(t, "", notifiers[1].(map[string]any)["webhook_url"])
+	receiver := notifiers[2].(map[string]any)
+	assert.Equal(t, map[string]any{"x-api-key": "REDACTED"}, receiver["headers"])
+	assert.Equal(t, "REDACTED", receiver["bearer_token"])
+	assert.Equal(t, "REDACTED", receiver["secret"])
+	mail := notifiers[3].(map[string]any)
+	assert.Equal(t, "monitor", mail["username"])
+	assert.Equal(t, "REDACTED", mail["password"])
+	assert.Equal(t, map[string]any{"critical": []any{"oncall@example.com"}}, mail["recipients"])
+
+	interfaces := redacted["interfaces"].([]any)
+	assert.Equal(t, false, interfaces[0].(map[string]any)["promiscuous"])
+
+	assert.Equal(t, "https://discord.com/api/webhooks/1/secret", cfg.WebhookURL, "the config itself is not modified")
+}
+
+func TestConfigSettings(t *testing.T) {
+	resetViper()
+
+	configFile := createTempConfigFile(t, `
+interface: "file_iface"
+threshold_mbps: 50.0
+webhook_url: "http://file.hook"
+`)
+	pflag.Set("config", configFile)
+	t.Setenv("NM_THRESHOLD_MBPS", "123.4")
+	pflag.Set("top_n", "3")
+
+	cfg, err := LoadConfig()
+	require.NoError(t, err)
+
+	settings := make(map[string]Setting)
+	for _, s := range cfg.Settings() {
+		settings[s.Key] = s
+	}
+	assert.Equal(t, "interface", cfg.Settings()[0].Key, "settings keep the declaration order")
+
+	assert.Equal(t, Setting{Key: "interface", Value: "file_iface", Source: SourceFile}, settings["interface"])
+	assert.Equal(t, Setting{Key: "threshold_mbps", Value: 123.4, Source: SourceEnv}, settings["threshold_mbps"])
+	assert.Equal(t, Setting{Key: "top_n", Value: 3, Source: SourceFlag}, settings["top_n"])
+	assert.Equal(t, Setting{Key: "interval_seconds", Value: 60, Source: SourceDefault}, settings["interval_seconds"])
+	assert.Equal(t, "REDACTED", settings["webhook_url"].Value)
+	assert.NotContains(t, settings, "", "fields without a config key are skipped")
+}
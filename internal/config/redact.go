@@ -0,0 +1,82 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// Keys ending in one of these hold credentials. Webhook URLs embed their
+// token, so the whole URL is hidden.
+var secretSuffixes = []string{"webhook_url", "password", "secret", "token"}
+
+// Keys holding maps whose values are all hidden: headers often carry API
+// keys.
+var secretMaps = []string{"headers"}
+
+const redactedValue = "REDACTED"
+
+// Redacted returns the configuration keyed like the config file, with every
+// secret replaced by "REDACTED". Empty secrets are left empty so it is still
+// visible whether they are set.
+func (c *Config) Redacted() map[string]any {
+	return redact(reflect.ValueOf(*c)).(map[string]any)
+}
+
+func redact(v reflect.Value) any {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return nil
+		}
+		return redact(v.Elem())
+	case reflect.Struct:
+		m := make(map[string]any)
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			key := field.Tag.Get("mapstructure")
+			if key == "" || key == "-" || !field.IsExported() {
+				continue
+			}
+			value := redact(v.Field(i))
+			if s, ok := value.(string); ok && s != "" && isSecret(key) {
+				value = redactedValue
+			}
+			if m, ok := value.(map[string]any); ok && slices.Contains(secretMaps, key) {
+				for k := range m {
+					m[k] = redactedValue
+				}
+			}
+			m[key] = value
+		}
+		return m
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		m := make(map[string]any, v.Len())
+		for iter := v.MapRange(); iter.Next(); {
+			m[fmt.Sprint(iter.Key().Interface())] = redact(iter.Value())
+		}
+		return m
+	case reflect.Slice:
+		items := make([]any, v.Len())
+		for i := range items {
+			items[i] = redact(v.Index(i))
+		}
+		return items
+	default:
+		return v.Interface()
+	}
+}
+
+func isSecret(key string) bool {
+	for _, suffix := range secretSuffixes {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// Setting is one top-level configuration key with its effective value and
+// where that value came from.
+type Setting struct {
+	Key    string
+	Value  any
+	Source string
+}
+
+// Settings lists the top-level keys in declaration order. Values are
+// redacted like Redacted and sources follow the precedence LoadConfig uses:
+// flag, environment variable, config file, default.
+func (c *Config) Settings() []Setting {
+	values := c.Redacted()
+
+	var settings []Setting
+	t := reflect.TypeOf(*c)
+	for i := 0; i < t.NumField(); i++ {
+		key := t.Field(i).Tag.Get("mapstructure")
+		if key == "" || key == "-" {
+			continue
+		}
+		settings = append(settings, Setting{Key: key, Value: values[key], Source: source(key)})
+	}
+	return settings
+}
+
+func source(key string) string {
+	if f := pflag.CommandLine.Lookup(key); f != nil && f.Changed {
+		return SourceFlag
+	}
+	if value, ok := os.LookupEnv("NM_" + strings.ToUpper(key)); ok && value != "" {
+		return SourceEnv
+	}
+	if viper.InConfig(key) {
+		return SourceFile
+	}
+	return SourceDefault
+}
@@ -0,0 +1,402 @@
+"use strict";
+
+const MAX_POINTS = 120;
+const SERIES = [
+  { key: "speed_mbps", label: "Total", color: "#3498db" },
+  { key: "rx_mbps", label: "Rx", color: "#2ecc71" },
+  { key: "tx_mbps", label: "Tx", color: "#e67e22" },
+];
+
+const state = {
+  // Snapshots per interface, oldest first.
+  history: new Map(),
+  talkerInterface: "",
+  sortKey: "speed_mbps",
+  sortDesc: true,
+};
+
+async function getJSON(path) {
+  const resp = await fetch(path);
+  if (!resp.ok) {
+    throw new Error(`${path}: ${resp.status}`);
+  }
+  return resp.json();
+}
+
+function el(tag, text, className) {
+  const node = document.createElement(tag);
+  if (text !== undefined) node.textContent = text;
+  if (className) node.className = className;
+  return node;
+}
+
+function row(cells) {
+  const tr = document.createElement("tr");
+  for (const cell of cells) {
+    tr.appendChild(cell instanceof Node ? wrap(cell) : el("td", String(cell)));
+  }
+  return tr;
+}
+
+function wrap(node) {
+  const td = document.createElement("td");
+  td.appendChild(node);
+  return td;
+}
+
+function num(value, digits = 2) {
+  return el("td", Number(value || 0).toFixed(digits), "num");
+}
+
+function fillTable(table, rows, columns, emptyText) {
+  const tbody = table.querySelector("tbody");
+  tbody.replaceChildren();
+  if (rows.length === 0) {
+    const tr = document.createElement("tr");
+    const td = el("td", emptyText, "empty");
+    td.colSpan = columns;
+    tr.appendChild(td);
+    tbody.appendChild(tr);
+    return;
+  }
+  for (const r of rows) tbody.appendChild(r);
+}
+
+function formatTime(value) {
+  if (!value) return "–";
+  return new Date(value).toLocaleString();
+}
+
+function formatDuration(ns) {
+  let seconds = Math.round((ns || 0) / 1e9);
+  const parts = [];
+  for (const [unit, size] of [["d", 86400], ["h", 3600], ["m", 60]]) {
+    if (seconds >= size) {
+      parts.push(Math.floor(seconds / size) + unit);
+      seconds %= size;
+    }
+  }
+  if (seconds > 0 || parts.length === 0) parts.push(seconds + "s");
+  return parts.join(" ");
+}
+
+function badge(text, kind) {
+  return el("span", text, "badge badge-" + kind);
+}
+
+// --- Throughput charts -----------------------------------------------------
+
+function addSnapshot(snapshot) {
+  let points = state.history.get(snapshot.interface);
+  if (!points) {
+    points = [];
+    state.history.set(snapshot.interface, points);
+  }
+  const last = points[points.length - 1];
+  if (last && last.start === snapshot.start) {
+    points[points.length - 1] = snapshot;
+  } else {
+    points.push(snapshot);
+  }
+  if (points.length > MAX_POINTS) points.splice(0, points.length - MAX_POINTS);
+}
+
+function chartFor(name) {
+  const id = "chart-" + name;
+  let container = document.getElementById(id);
+  if (container) return container;
+
+  container = el("div", undefined, "chart");
+  container.id = id;
+  const title = el("div", undefined, "chart-title");
+  title.appendChild(el("strong", name));
+  for (const series of SERIES) {
+    const label = el("span");
+    const swatch = el("span", undefined, "legend");
+    swatch.style.background = series.color;
+    label.appendChild(swatch);
+    label.appendChild(document.createTextNode(series.label + ": "));
+    label.appendChild(el("b", "–"));
+    label.dataset.key = series.key;
+    title.appendChild(label);
+  }
+  container.appendChild(title);
+  container.appendChild(document.createElement("canvas"));
+  document.getElementById("charts").appendChild(container);
+  return container;
+}
+
+function drawChart(name) {
+  const points = state.history.get(name) || [];
+  const container = chartFor(name);
+  const latest = points[points.length - 1];
+  for (const label of container.querySelectorAll(".chart-title span[data-key]")) {
+    label.querySelector("b").textContent = latest ? latest[label.dataset.key].toFixed(2) + " Mbps" : "–";
+  }
+
+  const canvas = container.querySelector("canvas");
+  const ratio = window.devicePixelRatio || 1;
+  const width = canvas.clientWidth;
+  const height = canvas.clientHeight;
+  canvas.width = width * ratio;
+  canvas.height = height * ratio;
+  const ctx = canvas.getContext("2d");
+  ctx.scale(ratio, ratio);
+  ctx.clearRect(0, 0, width, height);
+
+  const left = 56, right = 8, top = 8, bottom = 20;
+  const plotWidth = width - left - right;
+  const plotHeight = height - top - bottom;
+
+  let max = 0;
+  for (const p of points) {
+    for (const series of SERIES) max = Math.max(max, p[series.key]);
+  }
+  max = niceMax(max);
+
+  ctx.font = "11px sans-serif";
+  ctx.fillStyle = "#6b7280";
+  ctx.strokeStyle = "#e5e7eb";
+  ctx.lineWidth = 1;
+  ctx.textAlign = "right";
+  ctx.textBaseline = "middle";
+  for (let i = 0; i <= 4; i++) {
+    const y = top + plotHeight - (plotHeight * i) / 4;
+    ctx.beginPath();
+    ctx.moveTo(left, y);
+    ctx.lineTo(left + plotWidth, y);
+    ctx.stroke();
+    ctx.fillText(((max * i) / 4).toFixed(1), left - 6, y);
+  }
+
+  if (points.length === 0) return;
+
+  const first = Date.parse(points[0].start);
+  const last = Date.parse(latest.start);
+  const span = Math.max(last - first, 1);
+  const x = (p) => points.length === 1 ? left + plotWidth : left + ((Date.parse(p.start) - first) / span) * plotWidth;
+  const y = (v) => top + plotHeight - (v / max) * plotHeight;
+
+  ctx.textAlign = "left";
+  ctx.textBaseline = "top";
+  ctx.fillText(new Date(first).toLocaleTimeString(), left, top + plotHeight + 4);
+  ctx.textAlign = "right";
+  ctx.fillText(new Date(last).toLocaleTimeString(), left + plotWidth, top + plotHeight + 4);
+
+  ctx.lineWidth = 2;
+  for (const series of SERIES) {
+    ctx.strokeStyle = series.color;
+    ctx.beginPath();
+    points.forEach((p, i) => {
+      if (i === 0) ctx.moveTo(x(p), y(p[series.key]));
+      else ctx.lineTo(x(p), y(p[series.key]));
+    });
+    ctx.stroke();
+  }
+}
+
+// niceMax rounds the axis maximum up to 1, 2 or 5 times a power of ten.
+function niceMax(value) {
+  if (value <= 0) return 1;
+  const magnitude = Math.pow(10, Math.floor(Math.log10(value)));
+  for (const step of [1, 2, 5, 10]) {
+    if (value <= step * magnitude) return step * magnitude;
+  }
+  return 10 * magnitude;
+}
+
+function drawCharts() {
+  for (const name of [...state.history.keys()].sort()) drawChart(name);
+}
+
+// --- Top talkers -----------------------------------------------------------
+
+function updateTalkerSelect() {
+  const select = document.getElementById("talker-interface");
+  const names = [...state.history.keys()].sort();
+  if (!state.talkerInterface && names.length > 0) state.talkerInterface = names[0];
+  if (select.options.length !== names.length) {
+    select.replaceChildren(...names.map((name) => new Option(name, name)));
+  }
+  select.value = state.talkerInterface;
+}
+
+function renderTalkers() {
+  updateTalkerSelect();
+  const points = state.history.get(state.talkerInterface) || [];
+  const latest = points[points.length - 1];
+  const talkers = latest ? [...(latest.top_talkers || [])] : [];
+
+  const key = state.sortKey;
+  talkers.sort((a, b) => {
+    const order = key === "ip" ? compareIPs(a.ip, b.ip) : a[key] - b[key];
+    return state.sortDesc ? -order : order;
+  });
+
+  for (const th of document.querySelectorAll("#talkers th")) {
+    th.classList.toggle("asc", th.dataset.key === key && !state.sortDesc);
+    th.classList.toggle("desc", th.dataset.key === key && state.sortDesc);
+  }
+
+  fillTable(document.getElementById("talkers"),
+    talkers.map((t) => {
+      const tr = document.createElement("tr");
+      const host = el("td", t.ip);
+      if (t.hostname) host.appendChild(el("div", t.hostname, "hostname"));
+      if (t.processes && t.processes.length > 0) {
+        host.appendChild(el("div", t.processes.join(", "), "processes"));
+      }
+      const geo = [t.country, t.asn ? `AS${t.asn} ${t.as_organization || ""}`.trim() : ""]
+        .filter(Boolean).join(" · ");
+      if (geo) host.appendChild(el("div", geo, "geo"));
+      tr.appendChild(host);
+      tr.appendChild(num(t.speed_mbps));
+      tr.appendChild(num(t.rx_mbps));
+      tr.appendChild(num(t.tx_mbps));
+      return tr;
+    }), 4, "No traffic in the last interval.");
+}
+
+function ipParts(ip) {
+  return ip.includes(":")
+    ? ip.split(":").map((p) => parseInt(p, 16) || 0)
+    : ip.split(".").map((p) => parseInt(p, 10) || 0);
+}
+
+function compareIPs(a, b) {
+  // IPv4 sorts before IPv6.
+  if (a.includes(":") !== b.includes(":")) return a.includes(":") ? 1 : -1;
+  const pa = ipParts(a);
+  const pb = ipParts(b);
+  for (let i = 0; i < Math.max(pa.length, pb.length); i++) {
+    if ((pa[i] || 0) !== (pb[i] || 0)) return (pa[i] || 0) - (pb[i] || 0);
+  }
+  return 0;
+}
+
+function setupTalkerTable() {
+  for (const th of document.querySelectorAll("#talkers th")) {
+    th.addEventListener("click", () => {
+      if (state.sortKey === th.dataset.key) {
+        state.sortDesc = !state.sortDesc;
+      } else {
+        state.sortKey = th.dataset.key;
+        state.sortDesc = th.dataset.key !== "ip";
+      }
+      renderTalkers();
+    });
+  }
+  document.getElementById("talker-interface").addEventListener("change", (e) => {
+    state.talkerInterface = e.target.value;
+    renderTalkers();
+  });
+}
+
+// --- Alerts ----------------------------------------------------------------
+
+function describeEvent(event) {
+  if (event.rule) {
+    return `${event.rule.name} (${event.rule.match}): ${event.rule.value.toFixed(2)} ${event.rule.metric} ${event.rule.comparison} ${event.rule.threshold}`;
+  }
+  const parts = [];
+  for (const b of event.breaches || []) {
+    parts.push(`${b.direction} ${b.speed_mbps.toFixed(2)} Mbps (threshold ${b.threshold_mbps.toFixed(2)})`);
+  }
+  if (event.duration) parts.push("for " + formatDuration(event.duration));
+  return parts.join(", ");
+}
+
+function eventLabel(event) {
+  if (event.kind === "resolved") {
+    return badge("resolved " + (event.resolved_kind || "").replace(/_/g, " "), "good");
+  }
+  return badge(event.kind.replace(/_/g, " "), "bad");
+}
+
+async function refreshAlerts() {
+  const data = await getJSON("api/v1/alerts");
+
+  fillTable(document.getElementById("active-alerts"),
+    data.alerts.map((a) => {
+      const tr = document.createElement("tr");
+      tr.appendChild(el("td", a.key));
+      tr.appendChild(wrap(badge(a.state, a.state === "firing" ? "bad" : "warn")));
+      tr.appendChild(el("td", formatTime(a.since)));
+      tr.appendChild(num(a.last_value));
+      tr.appendChild(num(a.peak_value));
+      tr.appendChild(num(a.threshold));
+      return tr;
+    }), 6, "No active alerts.");
+
+  fillTable(document.getElementById("recent-alerts"),
+    data.recent.map((e) => row([formatTime(e.time), e.interface, eventLabel(e), describeEvent(e)])),
+    4, "No alerts yet.");
+}
+
+// --- Capture health --------------------------------------------------------
+
+async function refreshHealth() {
+  const data = await getJSON("api/v1/health");
+  fillTable(document.getElementById("health"),
+    data.interfaces.map((h) => {
+      const tr = document.createElement("tr");
+      tr.appendChild(el("td", h.interface));
+      const status = h.error ? badge("stats error", "warn") : badge(h.healthy ? "healthy" : "stalled", h.healthy ? "good" : "bad");
+      if (h.error) status.title = h.error;
+      tr.appendChild(wrap(status));
+      tr.appendChild(el("td", h.mode));
+      tr.appendChild(el("td", h.bpf_filter || "–"));
+      tr.appendChild(el("td", formatTime(h.last_update)));
+      tr.appendChild(num(h.packets_received, 0));
+      tr.appendChild(num(h.packets_dropped, 0));
+      tr.appendChild(num(h.packets_if_dropped, 0));
+      return tr;
+    }), 8, "No capture pipelines running.");
+}
+
+// --- Wiring ----------------------------------------------------------------
+
+function render() {
+  drawCharts();
+  renderTalkers();
+}
+
+function connect() {
+  const connection = document.getElementById("connection");
+  const source = new EventSource("api/v1/stream");
+  source.onopen = () => {
+    connection.textContent = "live";
+    connection.className = "badge badge-good";
+  };
+  source.onerror = () => {
+    connection.textContent = "disconnected, retrying…";
+    connection.className = "badge badge-bad";
+  };
+  source.addEventListener("interval", (e) => {
+    addSnapshot(JSON.parse(e.data));
+    render();
+    refreshAlerts().catch(console.error);
+  });
+}
+
+async function main() {
+  setupTalkerTable();
+  try {
+    const data = await getJSON("api/v1/recent");
+    for (const snapshot of data.snapshots) addSnapshot(snapshot);
+  } catch (err) {
+    console.error(err);
+  }
+  render();
+  connect();
+
+  const poll = () => {
+    refreshAlerts().catch(console.error);
+    refreshHealth().catch(console.error);
+  };
+  poll();
+  setInterval(poll, 10000);
+  window.addEventListener("resize", drawCharts);
+}
+
+main();
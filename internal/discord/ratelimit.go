@@ -0,0 +1,82 @@
+package discord
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// StatusError is a non-2xx response from Discord other than a rate limit.
+type StatusError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("received non-2xx status code from discord: %d %s - %s", e.StatusCode, e.Status, e.Body)
+}
+
+// Permanent reports whether retrying cannot help: the request was rejected,
+// e.g. because the webhook was deleted.
+func (e *StatusError) Permanent() bool {
+	return e.StatusCode >= 400 && e.StatusCode < 500 && e.StatusCode != http.StatusRequestTimeout
+}
+
+// RateLimitError means Discord asked to wait before the next request, or the
+// notifier knows the webhook's rate limit bucket is empty and did not send.
+type RateLimitError struct {
+	Wait   time.Duration
+	Global bool
+}
+
+func (e *RateLimitError) Error() string {
+	scope := "webhook"
+	if e.Global {
+		scope = "global"
+	}
+	return fmt.Sprintf("discord %s rate limit reached, retry in %s", scope, e.Wait.Round(time.Millisecond))
+}
+
+func (e *RateLimitError) RetryAfter() time.Duration {
+	return e.Wait
+}
+
+// rateLimit reads how long to wait from a 429 response: the body's
+// retry_after, falling back to the Retry-After header.
+func rateLimit(resp *http.Response, body []byte) *RateLimitError {
+	var limited struct {
+		RetryAfter float64 `json:"retry_after"`
+		Global     bool    `json:"global"`
+	}
+	_ = json.Unmarshal(body, &limited)
+	wait := seconds(limited.RetryAfter)
+	if wait <= 0 {
+		if v, err := strconv.ParseFloat(resp.Header.Get("Retry-After"), 64); err == nil {
+			wait = seconds(v)
+		}
+	}
+	if wait <= 0 {
+		wait = time.Second
+	}
+	return &RateLimitError{Wait: wait, Global: limited.Global || resp.Header.Get("X-RateLimit-Global") == "true"}
+}
+
+// bucketReset returns how long until the webhook's rate limit bucket refills
+// if the response says it is empty, or 0.
+func bucketReset(header http.Header) time.Duration {
+	if header.Get("X-RateLimit-Remaining") != "0" {
+		return 0
+	}
+	v, err := strconv.ParseFloat(header.Get("X-RateLimit-Reset-After"), 64)
+	if err != nil {
+		return 0
+	}
+	return seconds(v)
+}
+
+func seconds(v float64) time.Duration {
+	return time.Duration(v * float64(time.Second))
+}
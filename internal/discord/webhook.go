@@ -2,12 +2,15 @@ package discord
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"sort"
+	"network-monitor/internal/alert"
+	"network-monitor/internal/message"
+	"sync"
 	"time"
 )
 
@@ -32,41 +35,49 @@ type discordWebhookPayload struct {
 	Embeds    []discordEmbed `json:"embeds"`
 }
 
-func SendDiscordNotification(webhookURL string, topTalkers map[string]float64, thresholdMbps float64, intervalSeconds int) error {
-	if webhookURL == "" {
-		return fmt.Errorf("webhook URL is empty, skipping notification")
-	}
+type Notifier struct {
+	name       string
+	webhookURL string
+	templates  *message.Templates
+	client     *http.Client
 
-	type ipSpeed struct {
-		IP    string
-		Speed float64
-	}
-	var sortedTalkers []ipSpeed
-	for ip, speed := range topTalkers {
-		sortedTalkers = append(sortedTalkers, ipSpeed{IP: ip, Speed: speed})
+	mu sync.Mutex
+	// blockedUntil is when the webhook's rate limit allows the next request.
+	blockedUntil time.Time
+}
+
+// NewNotifier returns a notifier posting to webhookURL. templates may be nil
+// to send the built-in messages.
+func NewNotifier(name, webhookURL string, templates *message.Templates) *Notifier {
+	return &Notifier{
+		name:       name,
+		webhookURL: webhookURL,
+		templates:  templates,
+		client:     &http.Client{Timeout: 10 * time.Second},
 	}
-	sort.Slice(sortedTalkers, func(i, j int) bool {
-		return sortedTalkers[i].Speed > sortedTalkers[j].Speed
-	})
-
-	var fields []discordEmbedField
-	totalSpeed := 0.0
-	for _, talker := range sortedTalkers {
-		fields = append(fields, discordEmbedField{
-			Name:   talker.IP,
-			Value:  fmt.Sprintf("%.2f Mbps", talker.Speed),
-			Inline: true,
-		})
-		totalSpeed += talker.Speed
+}
+
+func (n *Notifier) Name() string {
+	return n.name
+}
+
+func (n *Notifier) Notify(ctx context.Context, event alert.Event) error {
+	if n.webhookURL == "" {
+		return fmt.Errorf("webhook URL is empty, skipping notification")
 	}
 
+	msg, err := n.templates.Render(event)
+	if err != nil {
+		return err
+	}
 	embed := discordEmbed{
-		Title: "🚨 Network Threshold Exceeded!",
-		Description: fmt.Sprintf("Overall speed exceeded %.2f Mbps threshold (Total: %.2f Mbps) in the last %d seconds.\nTop %d talkers:",
-			thresholdMbps, totalSpeed, intervalSeconds, len(sortedTalkers)),
-		Color:     15158332,
-		Fields:    fields,
-		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		Title:       msg.Title,
+		Description: msg.Description,
+		Color:       msg.Color,
+		Timestamp:   event.Time.UTC().Format(time.RFC3339),
+	}
+	for _, field := range msg.Fields {
+		embed.Fields = append(embed.Fields, discordEmbedField{Name: field.Name, Value: field.Value, Inline: field.Inline})
 	}
 
 	payload := discordWebhookPayload{
@@ -74,87 +85,59 @@ func SendDiscordNotification(webhookURL string, topTalkers map[string]float64, t
 		Embeds:   []discordEmbed{embed},
 	}
 
+	if err := n.send(ctx, payload); err != nil {
+		return err
+	}
+
+	log.Printf("Successfully sent %s notification to Discord (%s).", event.Kind, n.name)
+	return nil
+}
+
+func (n *Notifier) send(ctx context.Context, payload discordWebhookPayload) error {
 	jsonPayload, err := json.Marshal(payload)
 	if err != nil {
 		return fmt.Errorf("failed to marshal discord payload: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", webhookURL, bytes.NewBuffer(jsonPayload))
+	req, err := http.NewRequestWithContext(ctx, "POST", n.webhookURL, bytes.NewBuffer(jsonPayload))
 	if err != nil {
 		return fmt.Errorf("failed to create http request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+	n.mu.Lock()
+	wait := time.Until(n.blockedUntil)
+	n.mu.Unlock()
+	if wait > 0 {
+		return &RateLimitError{Wait: wait}
+	}
+
+	resp, err := n.client.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to send discord notification: %w", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-
+	if resp.StatusCode == http.StatusTooManyRequests {
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("received non-2xx status code from discord: %d %s - %s", resp.StatusCode, resp.Status, string(bodyBytes))
-
-	}
-
-	fmt.Println("Successfully sent notification to Discord.")
-	return nil
-}
-
-func SendInitNotification(webhookURL, interfaceName string, thresholdMbps float64, intervalSeconds int) error {
-	if webhookURL == "" {
-		log.Println("Webhook URL is empty, skipping initialization notification.")
-		return nil
-	}
-
-	description := fmt.Sprintf(
-		"Network Monitor started.\nMonitoring Interface: **%s**\nThreshold: **%.2f Mbps**\nCheck Interval: **%ds**",
-		interfaceName, thresholdMbps, intervalSeconds,
-	)
-	if interfaceName == "" {
-		description = fmt.Sprintf(
-			"Network Monitor started.\nMonitoring Interface: **Auto-Selected**\nThreshold: **%.2f Mbps**\nCheck Interval: **%ds**",
-			thresholdMbps, intervalSeconds,
-		)
-	}
-
-	embed := discordEmbed{
-		Title:       "🚀 Monitor Initialized",
-		Description: description,
-		Color:       3447003,
-		Timestamp:   time.Now().UTC().Format(time.RFC3339),
-	}
-
-	payload := discordWebhookPayload{
-		Username: "Network Monitor",
-		Embeds:   []discordEmbed{embed},
+		limited := rateLimit(resp, bodyBytes)
+		n.block(limited.Wait)
+		return limited
 	}
-
-	jsonPayload, err := json.Marshal(payload)
-	if err != nil {
-		return fmt.Errorf("failed to marshal init discord payload: %w", err)
-	}
-
-	req, err := http.NewRequest("POST", webhookURL, bytes.NewBuffer(jsonPayload))
-	if err != nil {
-		return fmt.Errorf("failed to create init http request: %w", err)
-	}
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to send init discord notification: %w", err)
-	}
-	defer resp.Body.Close()
+	n.block(bucketReset(resp.Header))
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("received non-2xx status code from discord on init: %d %s - %s", resp.StatusCode, resp.Status, string(bodyBytes))
+		return &StatusError{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(bodyBytes)}
 	}
-
-	log.Println("Successfully sent initialization notification to Discord.")
 	return nil
 }
+
+func (n *Notifier) block(wait time.Duration) {
+	if wait <= 0 {
+		return
+	}
+	n.mu.Lock()
+	n.blockedUntil = time.Now().Add(wait)
+	n.mu.Unlock()
+}
@@ -0,0 +1,232 @@
+package discord
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"network-monitor/internal/alert"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotifierSendsThresholdEmbed(t *testing.T) {
+	var received discordWebhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	event := alert.Event{
+		Kind:            alert.KindThresholdExceeded,
+		Interface:       "eth0",
+		Time:            time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+		IntervalSeconds: 60,
+		SpeedMbps:       150,
+		Breaches:        []alert.Breach{{Direction: "total", SpeedMbps: 150, ThresholdMbps: 100}},
+		TopTalkers: []alert.Talker{
+			{IP: "10.0.0.2", SpeedMbps: 10, Hostname: "printer.lan"},
+			{IP: "1.2.3.4", SpeedMbps: 5, Country: "US", ASN: 15169, ASOrganization: "Google LLC"},
+			{IP: "10.0.0.1", SpeedMbps: 90, RxMbps: 80, TxMbps: 10, Processes: []string{"web/nginx", "sshd"}},
+		},
+		TopFlows: []alert.Flow{{
+			Description: "10.0.0.1:5000 → 1.2.3.4:443 TCP", SpeedMbps: 80, SrcIP: "10.0.0.1", DstIP: "1.2.3.4",
+			DstHost: "video.example.com", ServerName: "video.example.com", Process: "web/nginx (pid 42)",
+			Country: "US", ASN: 15169,
+		}},
+	}
+
+	err := NewNotifier("test", server.URL, nil).Notify(context.Background(), event)
+	require.NoError(t, err)
+
+	require.Len(t, received.Embeds, 1)
+	embed := received.Embeds[0]
+	assert.Equal(t, "🚨 Network Threshold Exceeded!", embed.Title)
+	assert.Contains(t, embed.Description, "Overall speed of 150.00 Mbps exceeded the 100.00 Mbps threshold.")
+	assert.Equal(t, "2024-01-01T12:00:00Z", embed.Timestamp)
+
+	var names []string
+	for _, field := range embed.Fields {
+		names = append(names, field.Name)
+	}
+	assert.Equal(t, []string{"Interface", "⬇️ Download (rx)", "⬆️ Upload (tx)", "Total", "10.0.0.1", "10.0.0.2 (printer.lan)", "1.2.3.4", "Top flows"}, names)
+	assert.Contains(t, embed.Fields[4].Value, "web/nginx, sshd")
+	assert.Contains(t, embed.Fields[6].Value, "\nUS · AS15169 Google LLC")
+	assert.Equal(t, "`10.0.0.1:5000 → 1.2.3.4:443 TCP` 80.00 Mbps (10.0.0.1 → video.example.com) [US · AS15169] — web/nginx (pid 42)", embed.Fields[7].Value)
+}
+
+func TestNotifierReportsNon2xx(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	err := NewNotifier("test", server.URL, nil).Notify(context.Background(), alert.Event{Kind: alert.KindInit})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "400")
+	var statusErr *StatusError
+	require.ErrorAs(t, err, &statusErr)
+	assert.True(t, statusErr.Permanent())
+}
+
+func TestNotifierRateLimits(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch requests.Add(1) {
+		case 1:
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, `{"message": "You are being rate limited.", "retry_after": 0.25, "global": false}`)
+		case 2:
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset-After", "0.2")
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+	notifier := NewNotifier("test", server.URL, nil)
+	event := alert.Event{Kind: alert.KindInit}
+
+	err := notifier.Notify(context.Background(), event)
+	var limited *RateLimitError
+	require.ErrorAs(t, err, &limited)
+	assert.Equal(t, 250*time.Millisecond, limited.RetryAfter())
+	assert.False(t, limited.Global)
+
+	err = notifier.Notify(context.Background(), event)
+	require.ErrorAs(t, err, &limited, "blocked until retry_after has passed")
+	assert.Equal(t, int32(1), requests.Load())
+
+	time.Sleep(limited.RetryAfter())
+	require.NoError(t, notifier.Notify(context.Background(), event))
+	err = notifier.Notify(context.Background(), event)
+	require.ErrorAs(t, err, &limited, "the bucket is empty")
+	assert.InDelta(t, 200*time.Millisecond, limited.RetryAfter(), float64(100*time.Millisecond))
+	assert.Equal(t, int32(2), requests.Load())
+
+	time.Sleep(limited.RetryAfter())
+	require.NoError(t, notifier.Notify(context.Background(), event))
+	assert.Equal(t, int32(3), requests.Load())
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	resp := &http.Response{Header: http.Header{}}
+	resp.Header.Set("Retry-After", "3")
+	resp.Header.Set("X-RateLimit-Global", "true")
+	limited := rateLimit(resp, []byte("not json"))
+	assert.Equal(t, 3*time.Second, limited.Wait)
+	assert.True(t, limited.Global)
+
+	assert.Equal(t, time.Second, rateLimit(&http.Response{Header: http.Header{}}, nil).Wait, "a 429 without a delay still waits")
+	assert.Zero(t, bucketReset(http.Header{"X-Ratelimit-Remaining": {"4"}, "X-Ratelimit-Reset-After": {"1"}}))
+}
+
+func TestNotifierSendsResolvedEmbed(t *testing.T) {
+	var received discordWebhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	event := alert.Event{
+		Kind:      alert.KindResolved,
+		Interface: "eth0",
+		Time:      time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+		Breaches:  []alert.Breach{{Direction: "rx", SpeedMbps: 20, ThresholdMbps: 100}},
+		Duration:  5 * time.Minute,
+		PeakMbps:  180,
+	}
+
+	require.NoError(t, NewNotifier("test", server.URL, nil).Notify(context.Background(), event))
+
+	require.Len(t, received.Embeds, 1)
+	embed := received.Embeds[0]
+	assert.Equal(t, "✅ Network Threshold Resolved", embed.Title)
+	assert.Equal(t, 3066993, embed.Color)
+	assert.Equal(t, "Download (rx) speed is back to 20.00 Mbps, within the 100.00 Mbps threshold.", embed.Description)
+	require.Len(t, embed.Fields, 3)
+	assert.Equal(t, "5m0s", embed.Fields[1].Value)
+	assert.Equal(t, "180.00 Mbps", embed.Fields[2].Value)
+}
+
+func TestNotifierSendsLowTrafficEmbeds(t *testing.T) {
+	var received discordWebhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	notifier := NewNotifier("test", server.URL, nil)
+
+	require.NoError(t, notifier.Notify(context.Background(), alert.Event{
+		Kind:          alert.KindBelowThreshold,
+		Interface:     "wan0",
+		SpeedMbps:     0.5,
+		ThresholdMbps: 5,
+		PeakMbps:      0.2,
+		Duration:      3 * time.Minute,
+	}))
+	require.Len(t, received.Embeds, 1)
+	assert.Equal(t, "⚠️ Network Speed Below Minimum", received.Embeds[0].Title)
+	assert.Contains(t, received.Embeds[0].Description, "0.50 Mbps is below the 5.00 Mbps minimum")
+
+	require.NoError(t, notifier.Notify(context.Background(), alert.Event{
+		Kind:      alert.KindNoTraffic,
+		Interface: "wan0",
+		Duration:  2 * time.Minute,
+	}))
+	require.Len(t, received.Embeds, 1)
+	assert.Equal(t, "🔌 No Network Traffic", received.Embeds[0].Title)
+	assert.Contains(t, received.Embeds[0].Description, "for 2m0s")
+
+	require.NoError(t, notifier.Notify(context.Background(), alert.Event{
+		Kind:         alert.KindResolved,
+		ResolvedKind: alert.KindNoTraffic,
+		Interface:    "wan0",
+		Duration:     2 * time.Minute,
+	}))
+	assert.Equal(t, "Packets are being captured again.", received.Embeds[0].Description)
+	assert.Len(t, received.Embeds[0].Fields, 2)
+}
+
+func TestNotifierSendsRuleEmbed(t *testing.T) {
+	var received discordWebhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	event := alert.Event{
+		Kind:      alert.KindRule,
+		Interface: "lan0",
+		Duration:  2 * time.Minute,
+		Rule: &alert.RuleBreach{
+			Name:       "printer",
+			Match:      "192.168.1.50/32",
+			Metric:     "mbps",
+			Comparison: ">",
+			Value:      7.5,
+			Threshold:  5,
+		},
+	}
+	require.NoError(t, NewNotifier("test", server.URL, nil).Notify(context.Background(), event))
+
+	require.Len(t, received.Embeds, 1)
+	embed := received.Embeds[0]
+	assert.Equal(t, "🚨 Rule Triggered: printer", embed.Title)
+	assert.Equal(t, "Traffic matching 192.168.1.50/32 has been above its threshold for 2m0s.", embed.Description)
+	require.Len(t, embed.Fields, 4)
+	assert.Equal(t, "7.50 Mbps", embed.Fields[2].Value)
+	assert.Equal(t, "> 5.00 Mbps", embed.Fields[3].Value)
+}
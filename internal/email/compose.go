@@ -0,0 +1,231 @@
+package email
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"network-monitor/internal/alert"
+	"network-monitor/internal/message"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// talkerRow is a line of the top talkers table.
+type talkerRow struct {
+	IP        string
+	Hostname  string
+	Total     string
+	Rx        string
+	Tx        string
+	Geo       string
+	Processes string
+}
+
+func talkerRows(talkers []alert.Talker) []talkerRow {
+	var rows []talkerRow
+	for _, talker := range message.SortedTalkers(talkers) {
+		rows = append(rows, talkerRow{
+			IP:        talker.IP,
+			Hostname:  talker.Hostname,
+			Total:     fmt.Sprintf("%.2f", talker.SpeedMbps),
+			Rx:        fmt.Sprintf("%.2f", talker.RxMbps),
+			Tx:        fmt.Sprintf("%.2f", talker.TxMbps),
+			Geo:       message.GeoLabel(talker.Country, talker.ASN, talker.ASOrganization),
+			Processes: strings.Join(talker.Processes, ", "),
+		})
+	}
+	return rows
+}
+
+// bodyFields drops the per-talker fields of the message, which the top
+// talkers table replaces.
+func bodyFields(event alert.Event, fields []message.Field) []message.Field {
+	talkers := make(map[string]bool)
+	for _, talker := range event.TopTalkers {
+		talkers[message.TalkerName(talker)] = true
+	}
+	var kept []message.Field
+	for _, field := range fields {
+		if !talkers[field.Name] {
+			kept = append(kept, field)
+		}
+	}
+	return kept
+}
+
+// compose builds the mail: headers and a multipart/alternative body with a
+// plain-text and an HTML part.
+func compose(from string, to []string, event alert.Event, msg message.Message, now time.Time) ([]byte, error) {
+	fields := bodyFields(event, msg.Fields)
+	rows := talkerRows(event.TopTalkers)
+
+	subject := msg.Title
+	if event.Interface != "" {
+		subject += " [" + event.Interface + "]"
+	}
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	var toHeader []string
+	for _, addr := range to {
+		toHeader = append(toHeader, headerAddress(addr))
+	}
+	fmt.Fprintf(&buf, "From: %s\r\n", headerAddress(from))
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(toHeader, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: %s\r\n", messageID(from))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", w.Boundary())
+
+	html, err := htmlBody(msg, fields, rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain", textBody(msg, fields, rows)},
+		{"text/html", html},
+	} {
+		pw, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType + "; charset=utf-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qw := quotedprintable.NewWriter(pw)
+		if _, err := qw.Write([]byte(part.body)); err != nil {
+			return nil, err
+		}
+		if err := qw.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// headerAddress formats addr for a header, encoding a non-ASCII name.
+func headerAddress(addr string) string {
+	if parsed, err := mail.ParseAddress(addr); err == nil {
+		return parsed.String()
+	}
+	return addr
+}
+
+// messageID returns a unique Message-ID in the sender's domain.
+func messageID(from string) string {
+	domain := "localhost"
+	if addr, err := mail.ParseAddress(from); err == nil {
+		if i := strings.LastIndex(addr.Address, "@"); i >= 0 {
+			domain = addr.Address[i+1:]
+		}
+	}
+	b := make([]byte, 16)
+	rand.Read(b)
+	return "<" + hex.EncodeToString(b) + "@" + domain + ">"
+}
+
+var (
+	boldPattern = regexp.MustCompile(`\*\*(.+?)\*\*`)
+	codePattern = regexp.MustCompile("`([^`]+)`")
+)
+
+// plain strips the Markdown of the built-in messages.
+func plain(s string) string {
+	return codePattern.ReplaceAllString(boldPattern.ReplaceAllString(s, "$1"), "$1")
+}
+
+func textBody(msg message.Message, fields []message.Field, rows []talkerRow) string {
+	var b strings.Builder
+	b.WriteString(plain(msg.Title) + "\n\n")
+	if msg.Description != "" {
+		b.WriteString(plain(msg.Description) + "\n\n")
+	}
+	for _, field := range fields {
+		value := strings.ReplaceAll(plain(field.Value), "\n", "\n  ")
+		if strings.Contains(field.Value, "\n") {
+			fmt.Fprintf(&b, "%s:\n  %s\n", plain(field.Name), value)
+		} else {
+			fmt.Fprintf(&b, "%s: %s\n", plain(field.Name), value)
+		}
+	}
+	if len(rows) > 0 {
+		b.WriteString("\nTop talkers (Mbps):\n")
+		tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "IP\tHOSTNAME\tTOTAL\tRX\tTX\tCOUNTRY/AS\tPROCESSES")
+		for _, row := range rows {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				row.IP, dash(row.Hostname), row.Total, row.Rx, row.Tx, dash(row.Geo), dash(row.Processes))
+		}
+		tw.Flush()
+	}
+	return b.String()
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// markup renders the Markdown of the built-in messages as HTML, after
+// escaping the text.
+func markup(s string) template.HTML {
+	s = template.HTMLEscapeString(s)
+	s = boldPattern.ReplaceAllString(s, "<strong>$1</strong>")
+	s = codePattern.ReplaceAllString(s, "<code>$1</code>")
+	return template.HTML(strings.ReplaceAll(s, "\n", "<br>\n"))
+}
+
+var htmlTemplate = template.Must(template.New("email").Funcs(template.FuncMap{"markup": markup}).Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif; font-size: 14px; color: #222;">
+<div style="border-left: 6px solid {{.Color}}; padding: 4px 12px;">
+<h2 style="margin: 0 0 8px;">{{.Title}}</h2>
+{{with .Description}}<p>{{markup .}}</p>{{end}}
+</div>
+{{with .Fields}}<table cellpadding="4" style="border-collapse: collapse; margin-top: 12px;">
+{{range .}}<tr><th align="left" valign="top">{{markup .Name}}</th><td>{{markup .Value}}</td></tr>
+{{end}}</table>{{end}}
+{{with .Talkers}}<h3>Top talkers</h3>
+<table cellpadding="4" border="1" style="border-collapse: collapse;">
+<tr><th>IP</th><th>Hostname</th><th>Total (Mbps)</th><th>Rx (Mbps)</th><th>Tx (Mbps)</th><th>Country / AS</th><th>Processes</th></tr>
+{{range .}}<tr><td><code>{{.IP}}</code></td><td>{{.Hostname}}</td><td align="right">{{.Total}}</td><td align="right">{{.Rx}}</td><td align="right">{{.Tx}}</td><td>{{.Geo}}</td><td>{{.Processes}}</td></tr>
+{{end}}</table>{{end}}
+</body>
+</html>
+`))
+
+func htmlBody(msg message.Message, fields []message.Field, rows []talkerRow) (string, error) {
+	var b strings.Builder
+	err := htmlTemplate.Execute(&b, struct {
+		Title       string
+		Description string
+		Color       template.CSS
+		Fields      []message.Field
+		Talkers     []talkerRow
+	}{
+		Title:       msg.Title,
+		Description: msg.Description,
+		Color:       template.CSS(fmt.Sprintf("#%06x", msg.Color)),
+		Fields:      fields,
+		Talkers:     rows,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to render email: %w", err)
+	}
+	return b.String(), nil
+}
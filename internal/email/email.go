@@ -0,0 +1,219 @@
+// Package email sends notifications over SMTP as multipart plain-text and
+// HTML mails.
+package email
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"network-monitor/internal/alert"
+	"network-monitor/internal/message"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Ways of securing the connection to the server.
+const (
+	// TLSStartTLS upgrades a plain connection, usually on port 587. The
+	// server must support it.
+	TLSStartTLS = "starttls"
+	// TLSImplicit connects with TLS, usually on port 465.
+	TLSImplicit = "tls"
+	// TLSNone sends in the clear, e.g. to a relay on localhost.
+	TLSNone = "none"
+)
+
+// Options configure the SMTP server, sender and recipients.
+type Options struct {
+	Host string
+	// Port defaults to 465 for implicit TLS and 587 otherwise.
+	Port int
+	// TLS is TLSStartTLS (the default), TLSImplicit or TLSNone.
+	TLS string
+	// Username and Password, if set, log in with AUTH PLAIN. The password
+	// is only sent over TLS or to localhost.
+	Username string
+	Password string
+
+	From string
+	// To receive every notification, Recipients those of their severity.
+	To         []string
+	Recipients map[alert.Severity][]string
+}
+
+// Notifier mails events to the recipients of their severity.
+type Notifier struct {
+	name      string
+	opts      Options
+	templates *message.Templates
+	// tlsConfig verifies the server; tests replace it to trust their own.
+	tlsConfig *tls.Config
+	now       func() time.Time
+}
+
+// NewNotifier returns an email notifier. templates may be nil to send the
+// built-in messages.
+func NewNotifier(name string, opts Options, templates *message.Templates) *Notifier {
+	if opts.TLS == "" {
+		opts.TLS = TLSStartTLS
+	}
+	if opts.Port == 0 {
+		opts.Port = 587
+		if opts.TLS == TLSImplicit {
+			opts.Port = 465
+		}
+	}
+	return &Notifier{
+		name:      name,
+		opts:      opts,
+		templates: templates,
+		tlsConfig: &tls.Config{ServerName: opts.Host},
+		now:       time.Now,
+	}
+}
+
+func (n *Notifier) Name() string {
+	return n.name
+}
+
+// recipients returns who gets the event: everyone in To and the recipients
+// of its severity, without duplicates.
+func (n *Notifier) recipients(event alert.Event) []string {
+	var to []string
+	for _, addr := range append(slices.Clone(n.opts.To), n.opts.Recipients[event.Severity()]...) {
+		if !slices.Contains(to, addr) {
+			to = append(to, addr)
+		}
+	}
+	return to
+}
+
+func (n *Notifier) Notify(ctx context.Context, event alert.Event) error {
+	to := n.recipients(event)
+	if len(to) == 0 {
+		// Nobody wants this severity.
+		return nil
+	}
+
+	msg, err := n.templates.Render(event)
+	if err != nil {
+		return err
+	}
+	mail, err := compose(n.opts.From, to, event, msg, n.now())
+	if err != nil {
+		return &permanentError{err}
+	}
+	if err := n.send(ctx, to, mail); err != nil {
+		return err
+	}
+
+	log.Printf("Successfully sent %s notification by email to %d recipients (%s).", event.Kind, len(to), n.name)
+	return nil
+}
+
+func (n *Notifier) send(ctx context.Context, to []string, mail []byte) error {
+	addr := net.JoinHostPort(n.opts.Host, strconv.Itoa(n.opts.Port))
+	// net/smtp refuses to send a password in the clear to anything but
+	// localhost. Find out before connecting, and do not retry it.
+	if n.opts.TLS == TLSNone && n.opts.Username != "" && !isLocalhost(n.opts.Host) {
+		return &permanentError{fmt.Errorf("SMTP authentication to %s needs TLS, the password would be sent unencrypted", addr)}
+	}
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	var conn net.Conn
+	var err error
+	if n.opts.TLS == TLSImplicit {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: n.tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("could not connect to SMTP server %s: %w", addr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	c, err := smtp.NewClient(conn, n.opts.Host)
+	if err != nil {
+		conn.Close()
+		return smtpError("connect", err)
+	}
+	defer c.Close()
+
+	if n.opts.TLS == TLSStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return &permanentError{fmt.Errorf("SMTP server %s does not support STARTTLS", addr)}
+		}
+		if err := c.StartTLS(n.tlsConfig); err != nil {
+			return smtpError("STARTTLS", err)
+		}
+	}
+	if n.opts.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", n.opts.Username, n.opts.Password, n.opts.Host)); err != nil {
+			return smtpError("authentication", err)
+		}
+	}
+
+	if err := c.Mail(bareAddress(n.opts.From)); err != nil {
+		return smtpError("MAIL FROM", err)
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(bareAddress(rcpt)); err != nil {
+			return smtpError("RCPT TO "+rcpt, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return smtpError("DATA", err)
+	}
+	if _, err := w.Write(mail); err != nil {
+		return smtpError("DATA", err)
+	}
+	if err := w.Close(); err != nil {
+		return smtpError("DATA", err)
+	}
+	return c.Quit()
+}
+
+// isLocalhost reports whether net/smtp allows plain authentication to host
+// without TLS.
+func isLocalhost(host string) bool {
+	return host == "localhost" || host == "127.0.0.1" || host == "::1"
+}
+
+// bareAddress returns the address of "Name <user@example.com>", as the
+// SMTP envelope wants it.
+func bareAddress(addr string) string {
+	if parsed, err := mail.ParseAddress(addr); err == nil {
+		return parsed.Address
+	}
+	return addr
+}
+
+// permanentError is an error that retrying cannot fix, such as a rejected
+// recipient or failed login.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string   { return e.err.Error() }
+func (e *permanentError) Unwrap() error   { return e.err }
+func (e *permanentError) Permanent() bool { return true }
+
+// smtpError wraps the server's reply to a step. 5xx replies are permanent;
+// 4xx replies and connection errors are retried.
+func smtpError(step string, err error) error {
+	err = fmt.Errorf("SMTP %s failed: %w", step, err)
+	var reply *textproto.Error
+	if errors.As(err, &reply) && reply.Code >= 500 {
+		return &permanentError{err}
+	}
+	return err
+}
@@ -0,0 +1,358 @@
+package email
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"network-monitor/internal/alert"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// received is a mail accepted by the fake server.
+type received struct {
+	TLS  bool
+	Auth string
+	From string
+	To   []string
+	Data string
+}
+
+// smtpServer is a minimal SMTP server on localhost.
+type smtpServer struct {
+	ln        net.Listener
+	tlsConfig *tls.Config
+	// implicit makes clients speak TLS right away; startTLS offers STARTTLS.
+	implicit bool
+	startTLS bool
+	// reject is a recipient answered with 550.
+	reject string
+
+	mu    sync.Mutex
+	mails []received
+}
+
+func newSMTPServer(t *testing.T, implicit, startTLS bool) (*smtpServer, *tls.Config) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &smtpServer{
+		ln:        ln,
+		tlsConfig: &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}},
+		implicit:  implicit,
+		startTLS:  startTLS,
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s, &tls.Config{RootCAs: roots, ServerName: "127.0.0.1"}
+}
+
+func (s *smtpServer) port() int {
+	return s.ln.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpServer) received() []received {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]received(nil), s.mails...)
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+	secure := s.implicit
+	if s.implicit {
+		conn = tls.Server(conn, s.tlsConfig)
+	}
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 localhost ESMTP fake")
+
+	var mail received
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			tp.PrintfLine("250-localhost")
+			if s.startTLS && !secure {
+				tp.PrintfLine("250-STARTTLS")
+			}
+			tp.PrintfLine("250 AUTH PLAIN")
+		case "STARTTLS":
+			tp.PrintfLine("220 ready")
+			conn = tls.Server(conn, s.tlsConfig)
+			tp = textproto.NewConn(conn)
+			secure = true
+		case "AUTH":
+			credentials, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(arg, "PLAIN "))
+			mail.Auth = string(credentials)
+			tp.PrintfLine("235 accepted")
+		case "MAIL":
+			mail.TLS = secure
+			mail.From = strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")
+			tp.PrintfLine("250 ok")
+		case "RCPT":
+			rcpt := strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>")
+			if rcpt == s.reject {
+				tp.PrintfLine("550 no such user")
+				continue
+			}
+			mail.To = append(mail.To, rcpt)
+			tp.PrintfLine("250 ok")
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			data, err := io.ReadAll(tp.DotReader())
+			if err != nil {
+				return
+			}
+			mail.Data = string(data)
+			s.mu.Lock()
+			s.mails = append(s.mails, mail)
+			s.mu.Unlock()
+			tp.PrintfLine("250 queued")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("250 ok")
+		}
+	}
+}
+
+func thresholdEvent() alert.Event {
+	return alert.Event{
+		Kind:            alert.KindThresholdExceeded,
+		Interface:       "eth0",
+		Time:            time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+		IntervalSeconds: 60,
+		SpeedMbps:       150,
+		RxMbps:          140,
+		TxMbps:          10,
+		Breaches:        []alert.Breach{{Direction: "total", SpeedMbps: 150, ThresholdMbps: 100}},
+		TopTalkers: []alert.Talker{
+			{IP: "10.0.0.2", SpeedMbps: 10, Hostname: "printer.lan"},
+			{IP: "10.0.0.1", SpeedMbps: 90, RxMbps: 80, TxMbps: 10, Processes: []string{"curl"}, Country: "DE"},
+		},
+	}
+}
+
+// parts returns the decoded plain-text and HTML parts of a mail.
+func parts(t *testing.T, msg *mail.Message) (text, html string) {
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	require.Equal(t, "multipart/alternative", mediaType)
+	r := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := r.NextPart()
+		if err == io.EOF {
+			return text, html
+		}
+		require.NoError(t, err)
+		body, err := io.ReadAll(part)
+		require.NoError(t, err)
+		switch part.Header.Get("Content-Type") {
+		case "text/plain; charset=utf-8":
+			text = string(body)
+		case "text/html; charset=utf-8":
+			html = string(body)
+		default:
+			t.Fatalf("unexpected part %q", part.Header.Get("Content-Type"))
+		}
+	}
+}
+
+func TestNotifierSendsMultipartMail(t *testing.T) {
+	server, clientTLS := newSMTPServer(t, false, true)
+	notifier := NewNotifier("mail", Options{
+		Host:     "127.0.0.1",
+		Port:     server.port(),
+		Username: "monitor",
+		Password: "hunter2",
+		From:     "Network Monitor <monitor@example.com>",
+		To:       []string{"ops@example.com"},
+		Recipients: map[alert.Severity][]string{
+			alert.SeverityCritical: {"oncall@example.com", "ops@example.com"},
+			alert.SeverityWarning:  {"capacity@example.com"},
+		},
+	}, nil)
+	notifier.tlsConfig = clientTLS
+	notifier.now = func() time.Time { return time.Date(2024, 1, 1, 12, 0, 5, 0, time.UTC) }
+
+	require.NoError(t, notifier.Notify(context.Background(), thresholdEvent()))
+	mails := server.received()
+	require.Len(t, mails, 1)
+	got := mails[0]
+	assert.True(t, got.TLS, "upgraded with STARTTLS before sending")
+	assert.Equal(t, "\x00monitor\x00hunter2", got.Auth)
+	assert.Equal(t, "monitor@example.com", got.From)
+	assert.Equal(t, []string{"ops@example.com", "oncall@example.com"}, got.To)
+
+	msg, err := mail.ReadMessage(strings.NewReader(got.Data))
+	require.NoError(t, err)
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	require.NoError(t, err)
+	assert.Equal(t, "🚨 Network Threshold Exceeded! [eth0]", subject)
+	assert.Equal(t, `"Network Monitor" <monitor@example.com>`, msg.Header.Get("From"))
+	assert.Equal(t, "<ops@example.com>, <oncall@example.com>", msg.Header.Get("To"))
+	assert.Equal(t, "Mon, 01 Jan 2024 12:00:05 +0000", msg.Header.Get("Date"))
+	assert.Regexp(t, `^<[0-9a-f]{32}@example\.com>$`, msg.Header.Get("Message-ID"))
+
+	text, html := parts(t, msg)
+	assert.Contains(t, text, "Overall speed of 150.00 Mbps exceeded the 100.00 Mbps threshold.")
+	assert.Contains(t, text, "Interface: eth0\n")
+	assert.Regexp(t, `IP +HOSTNAME +TOTAL +RX +TX +COUNTRY/AS +PROCESSES\n10\.0\.0\.1 +- +90\.00 +80\.00 +10\.00 +DE +curl\n10\.0\.0\.2 +printer\.lan +10\.00`, text)
+	assert.NotContains(t, text, "10.0.0.2 (printer.lan)", "talker fields give way to the table")
+
+	assert.Contains(t, html, "border-left: 6px solid #e74c3c")
+	assert.Contains(t, html, "<td><code>10.0.0.1</code></td><td></td><td align=\"right\">90.00</td>")
+	assert.Contains(t, html, "<td>printer.lan</td>")
+}
+
+func TestNotifierRoutesBySeverity(t *testing.T) {
+	server, _ := newSMTPServer(t, false, false)
+	notifier := NewNotifier("mail", Options{
+		Host: "127.0.0.1",
+		Port: server.port(),
+		TLS:  TLSNone,
+		From: "monitor@example.com",
+		Recipients: map[alert.Severity][]string{
+			alert.SeverityCritical: {"oncall@example.com"},
+			alert.SeverityWarning:  {"capacity@example.com"},
+		},
+	}, nil)
+
+	ctx := context.Background()
+	require.NoError(t, notifier.Notify(ctx, alert.Event{Kind: alert.KindBelowThreshold, Interface: "eth0", ThresholdMbps: 1}))
+	require.NoError(t, notifier.Notify(ctx, alert.Event{Kind: alert.KindResolved, ResolvedKind: alert.KindNoTraffic, Interface: "eth0"}))
+	// Nobody receives info events, so no mail is sent.
+	require.NoError(t, notifier.Notify(ctx, alert.Event{Kind: alert.KindInit, Interface: "eth0"}))
+
+	mails := server.received()
+	require.Len(t, mails, 2)
+	assert.False(t, mails[0].TLS)
+	assert.Empty(t, mails[0].Auth)
+	assert.Equal(t, []string{"capacity@example.com"}, mails[0].To)
+	assert.Equal(t, []string{"oncall@example.com"}, mails[1].To, "resolved events reach whoever got the alert")
+}
+
+func TestNotifierImplicitTLS(t *testing.T) {
+	server, clientTLS := newSMTPServer(t, true, false)
+	notifier := NewNotifier("mail", Options{
+		Host: "127.0.0.1",
+		Port: server.port(),
+		TLS:  TLSImplicit,
+		From: "monitor@example.com",
+		To:   []string{"ops@example.com"},
+	}, nil)
+	notifier.tlsConfig = clientTLS
+
+	require.NoError(t, notifier.Notify(context.Background(), thresholdEvent()))
+	mails := server.received()
+	require.Len(t, mails, 1)
+	assert.True(t, mails[0].TLS)
+
+	// The server's certificate is checked.
+	notifier.tlsConfig = &tls.Config{ServerName: "127.0.0.1"}
+	assert.Error(t, notifier.Notify(context.Background(), thresholdEvent()))
+}
+
+func TestNotifierErrors(t *testing.T) {
+	var permanent interface{ Permanent() bool }
+
+	server, clientTLS := newSMTPServer(t, false, true)
+	server.reject = "gone@example.com"
+	notifier := NewNotifier("mail", Options{
+		Host: "127.0.0.1",
+		Port: server.port(),
+		From: "monitor@example.com",
+		To:   []string{"ops@example.com", "gone@example.com"},
+	}, nil)
+	notifier.tlsConfig = clientTLS
+	err := notifier.Notify(context.Background(), thresholdEvent())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "RCPT TO gone@example.com")
+	require.True(t, errors.As(err, &permanent))
+	assert.True(t, permanent.Permanent())
+	assert.Empty(t, server.received())
+
+	// STARTTLS is required unless TLS is "none".
+	plain, _ := newSMTPServer(t, false, false)
+	notifier = NewNotifier("mail", Options{
+		Host: "127.0.0.1",
+		Port: plain.port(),
+		From: "monitor@example.com",
+		To:   []string{"ops@example.com"},
+	}, nil)
+	err = notifier.Notify(context.Background(), thresholdEvent())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "does not support STARTTLS")
+	assert.Empty(t, plain.received())
+
+	// A password is never sent in the clear to a remote server.
+	notifier = NewNotifier("mail", Options{
+		Host:     "mail.example.com",
+		TLS:      TLSNone,
+		Username: "monitor",
+		Password: "secret",
+		From:     "monitor@example.com",
+		To:       []string{"ops@example.com"},
+	}, nil)
+	err = notifier.Notify(context.Background(), thresholdEvent())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "needs TLS")
+	require.True(t, errors.As(err, &permanent))
+	assert.True(t, permanent.Permanent())
+
+	// Connection failures are retried.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+	notifier = NewNotifier("mail", Options{Host: "127.0.0.1", Port: port, From: "monitor@example.com", To: []string{"ops@example.com"}}, nil)
+	err = notifier.Notify(context.Background(), thresholdEvent())
+	require.Error(t, err)
+	assert.False(t, errors.As(err, &permanent))
+}
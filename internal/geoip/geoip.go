@@ -0,0 +1,237 @@
+// Package geoip annotates addresses with their country and autonomous system
+// from local MaxMind-format (.mmdb) databases such as GeoLite2 Country, City
+// and ASN.
+package geoip
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+
+	"network-monitor/internal/analysis"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// Info is what the databases know about an address. Fields are empty when
+// the address is not covered, e.g. private ranges.
+type Info struct {
+	// Country is the ISO 3166-1 alpha-2 code.
+	Country      string
+	ASN          uint
+	Organization string
+}
+
+// AS formats the autonomous system as "AS3320 Deutsche Telekom AG", or ""
+// if it is unknown.
+func (i Info) AS() string {
+	if i.ASN == 0 {
+		return ""
+	}
+	as := "AS" + strconv.FormatUint(uint64(i.ASN), 10)
+	if i.Organization != "" {
+		as += " " + i.Organization
+	}
+	return as
+}
+
+type countryRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	// RegisteredCountry covers networks without a location, such as anycast
+	// ranges.
+	RegisteredCountry struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+}
+
+type asnRecord struct {
+	Number       uint   `maxminddb:"autonomous_system_number"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
+
+// DB holds the opened databases. A nil *DB knows nothing, so callers do not
+// need to check whether GeoIP is configured.
+type DB struct {
+	country *maxminddb.Reader
+	asn     *maxminddb.Reader
+}
+
+// Open reads the country (Country or City) and ASN databases; either path
+// may be empty. It returns nil if both are. The files are read into memory
+// rather than mapped, so a reload can open updated files while intervals
+// still use the old ones.
+func Open(countryPath, asnPath string) (*DB, error) {
+	if countryPath == "" && asnPath == "" {
+		return nil, nil
+	}
+	db := &DB{}
+	var err error
+	if db.country, err = open(countryPath); err != nil {
+		return nil, fmt.Errorf("could not open country database: %w", err)
+	}
+	if db.asn, err = open(asnPath); err != nil {
+		return nil, fmt.Errorf("could not open ASN database: %w", err)
+	}
+	return db, nil
+}
+
+func open(path string) (*maxminddb.Reader, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := maxminddb.FromBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return reader, nil
+}
+
+// HasCountry reports whether a country database is loaded.
+func (db *DB) HasCountry() bool {
+	return db != nil && db.country != nil
+}
+
+// HasASN reports whether an ASN database is loaded.
+func (db *DB) HasASN() bool {
+	return db != nil && db.asn != nil
+}
+
+// Lookup returns what the databases know about ip.
+func (db *DB) Lookup(ip string) Info {
+	var info Info
+	if db == nil {
+		return info
+	}
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return info
+	}
+	if db.country != nil {
+		var record countryRecord
+		if err := db.country.Lookup(addr, &record); err == nil {
+			info.Country = record.Country.ISOCode
+			if info.Country == "" {
+				info.Country = record.RegisteredCountry.ISOCode
+			}
+		}
+	}
+	if db.asn != nil {
+		var record asnRecord
+		if err := db.asn.Lookup(addr, &record); err == nil {
+			info.ASN, info.Organization = record.Number, record.Organization
+		}
+	}
+	return info
+}
+
+// RemoteIPs returns the ends of a flow outside the local networks: the
+// destination of outgoing traffic, the source of incoming traffic and both
+// ends of transit traffic.
+func RemoteIPs(flow analysis.FlowRecord) []string {
+	switch flow.Direction {
+	case analysis.DirectionTx:
+		return []string{flow.Key.DstIP}
+	case analysis.DirectionRx:
+		return []string{flow.Key.SrcIP}
+	case analysis.DirectionTransit:
+		return []string{flow.Key.SrcIP, flow.Key.DstIP}
+	}
+	return nil
+}
+
+// Traffic is the traffic of one interval exchanged with a country or
+// autonomous system. Bytes includes transit traffic, which is neither rx
+// nor tx.
+type Traffic struct {
+	Bytes   int64 `json:"bytes"`
+	RxBytes int64 `json:"rx_bytes"`
+	TxBytes int64 `json:"tx_bytes"`
+}
+
+func (t *Traffic) add(flow analysis.FlowRecord) {
+	t.Bytes += flow.Bytes
+	switch flow.Direction {
+	case analysis.DirectionRx:
+		t.RxBytes += flow.Bytes
+	case analysis.DirectionTx:
+		t.TxBytes += flow.Bytes
+	}
+}
+
+type CountryTraffic struct {
+	Country string `json:"country"`
+	Traffic
+}
+
+type ASNTraffic struct {
+	ASN          uint   `json:"asn"`
+	Organization string `json:"organization,omitempty"`
+	Traffic
+}
+
+// Aggregate sums the flows by the country and autonomous system of their
+// remote ends, largest first. Remote addresses the databases do not cover
+// are left out.
+func (db *DB) Aggregate(flows []analysis.FlowRecord) ([]CountryTraffic, []ASNTraffic) {
+	if db == nil {
+		return nil, nil
+	}
+	infos := make(map[string]Info)
+	countries := make(map[string]*CountryTraffic)
+	asns := make(map[uint]*ASNTraffic)
+	for _, flow := range flows {
+		for _, ip := range RemoteIPs(flow) {
+			info, ok := infos[ip]
+			if !ok {
+				info = db.Lookup(ip)
+				infos[ip] = info
+			}
+			if info.Country != "" {
+				c := countries[info.Country]
+				if c == nil {
+					c = &CountryTraffic{Country: info.Country}
+					countries[info.Country] = c
+				}
+				c.add(flow)
+			}
+			if info.ASN != 0 {
+				a := asns[info.ASN]
+				if a == nil {
+					a = &ASNTraffic{ASN: info.ASN, Organization: info.Organization}
+					asns[info.ASN] = a
+				}
+				a.add(flow)
+			}
+		}
+	}
+
+	var byCountry []CountryTraffic
+	for _, c := range countries {
+		byCountry = append(byCountry, *c)
+	}
+	sort.Slice(byCountry, func(i, j int) bool {
+		if byCountry[i].Bytes != byCountry[j].Bytes {
+			return byCountry[i].Bytes > byCountry[j].Bytes
+		}
+		return byCountry[i].Country < byCountry[j].Country
+	})
+	var byASN []ASNTraffic
+	for _, a := range asns {
+		byASN = append(byASN, *a)
+	}
+	sort.Slice(byASN, func(i, j int) bool {
+		if byASN[i].Bytes != byASN[j].Bytes {
+			return byASN[i].Bytes > byASN[j].Bytes
+		}
+		return byASN[i].ASN < byASN[j].ASN
+	})
+	return byCountry, byASN
+}
@@ -0,0 +1,231 @@
+package geoip
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"network-monitor/internal/analysis"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testNode is a node of the binary search tree of a test database. A side
+// without a child is a leaf holding data, or nothing.
+type testNode struct {
+	child [2]*testNode
+	data  [2][]byte
+}
+
+// writeDB writes a MaxMind DB with IPv6 search tree and 24-bit records,
+// mapping each prefix to its record. IPv4 prefixes live under ::/96 as in
+// the real databases.
+func writeDB(t *testing.T, databaseType string, records map[string]map[string]any) string {
+	t.Helper()
+	root := &testNode{}
+	for cidr, record := range records {
+		prefix := netip.MustParsePrefix(cidr)
+		addr, bits := prefix.Addr().As16(), prefix.Bits()
+		if prefix.Addr().Is4() {
+			addr = [16]byte{}
+			copy(addr[12:], prefix.Addr().AsSlice())
+			bits += 96
+		}
+		node := root
+		for i := 0; i < bits; i++ {
+			bit := addr[i/8] >> (7 - i%8) & 1
+			if i == bits-1 {
+				node.data[bit] = encode(record)
+				break
+			}
+			if node.child[bit] == nil {
+				node.child[bit] = &testNode{}
+			}
+			node = node.child[bit]
+		}
+	}
+
+	var nodes []*testNode
+	index := make(map[*testNode]int)
+	for queue := []*testNode{root}; len(queue) > 0; queue = queue[1:] {
+		index[queue[0]] = len(nodes)
+		nodes = append(nodes, queue[0])
+		for _, child := range queue[0].child {
+			if child != nil {
+				queue = append(queue, child)
+			}
+		}
+	}
+
+	var tree, data []byte
+	for _, node := range nodes {
+		for side := 0; side < 2; side++ {
+			value := len(nodes)
+			switch {
+			case node.child[side] != nil:
+				value = index[node.child[side]]
+			case node.data[side] != nil:
+				value = len(nodes) + 16 + len(data)
+				data = append(data, node.data[side]...)
+			}
+			tree = append(tree, byte(value>>16), byte(value>>8), byte(value))
+		}
+	}
+
+	file := append(tree, make([]byte, 16)...)
+	file = append(file, data...)
+	file = append(file, "\xAB\xCD\xEFMaxMind.com"...)
+	file = append(file, encode(map[string]any{
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(1700000000),
+		"database_type":               databaseType,
+		"description":                 map[string]any{"en": "test"},
+		"ip_version":                  uint16(6),
+		"languages":                   []any{"en"},
+		"node_count":                  uint32(len(nodes)),
+		"record_size":                 uint16(24),
+	})...)
+
+	path := filepath.Join(t.TempDir(), databaseType+".mmdb")
+	require.NoError(t, os.WriteFile(path, file, 0o644))
+	return path
+}
+
+// encode writes a value in the MaxMind DB data format.
+func encode(value any) []byte {
+	header := func(kind, size int) []byte {
+		var extra []byte
+		if size >= 29 {
+			size, extra = 29, []byte{byte(size - 29)}
+		}
+		if kind <= 7 {
+			return append([]byte{byte(kind<<5 | size)}, extra...)
+		}
+		return append([]byte{byte(size), byte(kind - 7)}, extra...)
+	}
+	unsigned := func(kind int, v uint64) []byte {
+		b := binary.BigEndian.AppendUint64(nil, v)
+		for len(b) > 0 && b[0] == 0 {
+			b = b[1:]
+		}
+		return append(header(kind, len(b)), b...)
+	}
+
+	switch v := value.(type) {
+	case string:
+		return append(header(2, len(v)), v...)
+	case uint16:
+		return unsigned(5, uint64(v))
+	case uint32:
+		return unsigned(6, uint64(v))
+	case uint64:
+		return unsigned(9, v)
+	case []any:
+		b := header(11, len(v))
+		for _, item := range v {
+			b = append(b, encode(item)...)
+		}
+		return b
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		b := header(7, len(v))
+		for _, key := range keys {
+			b = append(b, encode(key)...)
+			b = append(b, encode(v[key])...)
+		}
+		return b
+	}
+	panic("unsupported type")
+}
+
+func country(code string) map[string]any {
+	return map[string]any{"iso_code": code}
+}
+
+func testDB(t *testing.T) *DB {
+	countryPath := writeDB(t, "GeoLite2-City", map[string]map[string]any{
+		"203.0.113.0/24":  {"country": country("DE"), "registered_country": country("DE")},
+		"198.51.100.0/24": {"country": country("US")},
+		"192.0.2.0/24":    {"registered_country": country("NL")},
+		"2001:db8::/32":   {"country": country("FR")},
+	})
+	asnPath := writeDB(t, "GeoLite2-ASN", map[string]map[string]any{
+		"203.0.113.0/24":  {"autonomous_system_number": uint32(3320), "autonomous_system_organization": "Deutsche Telekom AG"},
+		"198.51.100.0/25": {"autonomous_system_number": uint32(15169), "autonomous_system_organization": "Google LLC"},
+	})
+	db, err := Open(countryPath, asnPath)
+	require.NoError(t, err)
+	return db
+}
+
+func TestLookup(t *testing.T) {
+	db := testDB(t)
+	assert.True(t, db.HasCountry())
+	assert.True(t, db.HasASN())
+
+	info := db.Lookup("203.0.113.9")
+	assert.Equal(t, Info{Country: "DE", ASN: 3320, Organization: "Deutsche Telekom AG"}, info)
+	assert.Equal(t, "AS3320 Deutsche Telekom AG", info.AS())
+	assert.Equal(t, Info{Country: "US"}, db.Lookup("198.51.100.200"))
+	assert.Equal(t, "NL", db.Lookup("192.0.2.1").Country, "registered country without a location")
+	assert.Equal(t, "FR", db.Lookup("2001:db8::1").Country)
+	assert.Equal(t, Info{}, db.Lookup("10.0.0.1"))
+	assert.Equal(t, Info{}, db.Lookup("not an ip"))
+	assert.Empty(t, Info{}.AS())
+
+	var none *DB
+	assert.Equal(t, Info{}, none.Lookup("203.0.113.9"))
+	assert.False(t, none.HasCountry())
+}
+
+func TestOpen(t *testing.T) {
+	db, err := Open("", "")
+	require.NoError(t, err)
+	assert.Nil(t, db)
+
+	_, err = Open(filepath.Join(t.TempDir(), "missing.mmdb"), "")
+	assert.ErrorContains(t, err, "country database")
+
+	garbage := filepath.Join(t.TempDir(), "garbage.mmdb")
+	require.NoError(t, os.WriteFile(garbage, []byte("not a database"), 0o644))
+	_, err = Open("", garbage)
+	assert.ErrorContains(t, err, "ASN database")
+}
+
+func TestAggregate(t *testing.T) {
+	db := testDB(t)
+	flow := func(src, dst string, direction analysis.Direction, bytes int64) analysis.FlowRecord {
+		return analysis.FlowRecord{Key: analysis.FlowKey{SrcIP: src, DstIP: dst, Protocol: "TCP"}, Direction: direction, Bytes: bytes}
+	}
+	countries, asns := db.Aggregate([]analysis.FlowRecord{
+		flow("10.0.0.5", "203.0.113.7", analysis.DirectionTx, 100),
+		flow("203.0.113.7", "10.0.0.5", analysis.DirectionRx, 1000),
+		flow("198.51.100.1", "10.0.0.6", analysis.DirectionRx, 500),
+		flow("198.51.100.200", "203.0.113.8", analysis.DirectionTransit, 50),
+		flow("10.0.0.5", "10.0.0.6", analysis.DirectionLocal, 5000),
+		flow("10.0.0.5", "172.16.0.1", analysis.DirectionTx, 5000),
+	})
+
+	assert.Equal(t, []CountryTraffic{
+		{Country: "DE", Traffic: Traffic{Bytes: 1150, RxBytes: 1000, TxBytes: 100}},
+		{Country: "US", Traffic: Traffic{Bytes: 550, RxBytes: 500}},
+	}, countries)
+	assert.Equal(t, []ASNTraffic{
+		{ASN: 3320, Organization: "Deutsche Telekom AG", Traffic: Traffic{Bytes: 1150, RxBytes: 1000, TxBytes: 100}},
+		{ASN: 15169, Organization: "Google LLC", Traffic: Traffic{Bytes: 500, RxBytes: 500}},
+	}, asns)
+
+	var none *DB
+	countries, asns = none.Aggregate([]analysis.FlowRecord{flow("10.0.0.5", "203.0.113.7", analysis.DirectionTx, 100)})
+	assert.Nil(t, countries)
+	assert.Nil(t, asns)
+}
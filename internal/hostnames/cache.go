@@ -0,0 +1,75 @@
+package hostnames
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type cacheEntry struct {
+	name    string
+	expires time.Time
+}
+
+// cache holds names until they expire. When it is full, expired entries are
+// dropped first and then the tenth of the entries expiring soonest.
+type cache struct {
+	mu      sync.Mutex
+	max     int
+	entries map[string]cacheEntry
+}
+
+func newCache(max int) *cache {
+	return &cache{max: max, entries: make(map[string]cacheEntry)}
+}
+
+func (c *cache) get(key string, now time.Time) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+	if !now.Before(entry.expires) {
+		delete(c.entries, key)
+		return "", false
+	}
+	return entry.name, true
+}
+
+func (c *cache) set(key, name string, expires, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.max {
+		c.evict(now)
+	}
+	c.entries[key] = cacheEntry{name: name, expires: expires}
+}
+
+func (c *cache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+func (c *cache) evict(now time.Time) {
+	for key, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+	if len(c.entries) < c.max {
+		return
+	}
+
+	keys := make([]string, 0, len(c.entries))
+	for key := range c.entries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return c.entries[keys[i]].expires.Before(c.entries[keys[j]].expires)
+	})
+	for _, key := range keys[:max(1, len(keys)/10)] {
+		delete(c.entries, key)
+	}
+}
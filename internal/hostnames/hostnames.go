@@ -0,0 +1,131 @@
+// Package hostnames names IP addresses, primarily from DNS responses seen on
+// the wire and optionally from reverse (PTR) lookups.
+package hostnames
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	// maxSnoopedNames bounds the names learned from DNS responses.
+	maxSnoopedNames = 100000
+
+	// snoopGrace keeps a snooped name after its record expired, because
+	// connections routinely outlive the DNS record they were made with.
+	snoopGrace = 10 * time.Minute
+)
+
+type Options struct {
+	// Snooping learns names from the DNS responses passed to ObservePacket.
+	Snooping bool
+
+	// Reverse falls back to PTR lookups. At most ReverseRate lookups are
+	// made per second and at most ReverseCacheSize results are kept.
+	Reverse          bool
+	ReverseCacheSize int
+	ReverseRate      float64
+}
+
+// Resolver maps IP addresses to hostnames. A nil Resolver knows no names.
+type Resolver struct {
+	snooped *cache
+	reverse *reverseLookup
+	now     func() time.Time
+}
+
+func New(opts Options) *Resolver {
+	return newResolver(opts, net.DefaultResolver.LookupAddr)
+}
+
+func newResolver(opts Options, lookupAddr func(ctx context.Context, addr string) ([]string, error)) *Resolver {
+	r := &Resolver{now: time.Now}
+	if opts.Snooping {
+		r.snooped = newCache(maxSnoopedNames)
+	}
+	if opts.Reverse {
+		r.reverse = newReverseLookup(lookupAddr, opts.ReverseCacheSize, opts.ReverseRate)
+	}
+	return r
+}
+
+// ObservePacket learns the names of the addresses in DNS responses.
+func (r *Resolver) ObservePacket(packet gopacket.Packet) {
+	if r.snooped == nil {
+		return
+	}
+	if layer := packet.Layer(layers.LayerTypeDNS); layer != nil {
+		r.observeDNS(layer.(*layers.DNS))
+	}
+}
+
+// observeDNS maps every A and AAAA answer to the name that was queried,
+// rather than the end of a CNAME chain, since that is the name the
+// application asked for.
+func (r *Resolver) observeDNS(msg *layers.DNS) {
+	if !msg.QR || msg.ResponseCode != layers.DNSResponseCodeNoErr || len(msg.Questions) == 0 {
+		return
+	}
+	name := strings.TrimSuffix(string(msg.Questions[0].Name), ".")
+	if name == "" {
+		return
+	}
+
+	now := r.now()
+	for _, answer := range msg.Answers {
+		if answer.Type != layers.DNSTypeA && answer.Type != layers.DNSTypeAAAA || answer.IP == nil {
+			continue
+		}
+		ttl := time.Duration(answer.TTL) * time.Second
+		r.snooped.set(answer.IP.String(), name, now.Add(ttl+snoopGrace), now)
+	}
+}
+
+// Name returns the hostname of ip, or "" if it is not known (yet). Unknown
+// addresses are queued for a reverse lookup when that is enabled.
+func (r *Resolver) Name(ip string) string {
+	if r == nil {
+		return ""
+	}
+	if name, ok := r.cached(ip); ok {
+		return name
+	}
+	if r.reverse != nil {
+		r.reverse.enqueue(ip)
+	}
+	return ""
+}
+
+// Cached is like Name but never triggers a lookup.
+func (r *Resolver) Cached(ip string) string {
+	if r == nil {
+		return ""
+	}
+	name, _ := r.cached(ip)
+	return name
+}
+
+func (r *Resolver) cached(ip string) (string, bool) {
+	now := r.now()
+	if r.snooped != nil {
+		if name, ok := r.snooped.get(ip, now); ok {
+			return name, true
+		}
+	}
+	if r.reverse != nil {
+		return r.reverse.cache.get(ip, now)
+	}
+	return "", false
+}
+
+// Close stops the reverse lookup worker.
+func (r *Resolver) Close() {
+	if r != nil && r.reverse != nil {
+		r.reverse.close()
+	}
+}
@@ -0,0 +1,161 @@
+package hostnames
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func dnsPacket(t *testing.T, msg *layers.DNS) gopacket.Packet {
+	t.Helper()
+	eth := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0, 0, 0, 0, 0, 1},
+		DstMAC:       net.HardwareAddr{0, 0, 0, 0, 0, 2},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ip := &layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		Protocol: layers.IPProtocolUDP,
+		SrcIP:    net.ParseIP("192.168.1.1").To4(),
+		DstIP:    net.ParseIP("192.168.1.10").To4(),
+	}
+	udp := &layers.UDP{SrcPort: 53, DstPort: 40000}
+	require.NoError(t, udp.SetNetworkLayerForChecksum(ip))
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	require.NoError(t, gopacket.SerializeLayers(buf, opts, eth, ip, udp, msg))
+	return gopacket.NewPacket(buf.Bytes(), layers.LinkTypeEthernet, gopacket.Default)
+}
+
+func TestSnoopDNSResponses(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	r := newResolver(Options{Snooping: true}, nil)
+	r.now = func() time.Time { return now }
+
+	question := layers.DNSQuestion{Name: []byte("www.example.com"), Type: layers.DNSTypeA, Class: layers.DNSClassIN}
+	r.ObservePacket(dnsPacket(t, &layers.DNS{
+		ID: 1, QR: true, RD: true, RA: true,
+		Questions: []layers.DNSQuestion{question},
+		Answers: []layers.DNSResourceRecord{
+			{Name: []byte("www.example.com"), Type: layers.DNSTypeCNAME, Class: layers.DNSClassIN, TTL: 300, CNAME: []byte("edge.cdn.example.net")},
+			{Name: []byte("edge.cdn.example.net"), Type: layers.DNSTypeA, Class: layers.DNSClassIN, TTL: 60, IP: net.ParseIP("203.0.113.7").To4()},
+			{Name: []byte("edge.cdn.example.net"), Type: layers.DNSTypeAAAA, Class: layers.DNSClassIN, TTL: 60, IP: net.ParseIP("2001:db8::7")},
+		},
+	}))
+
+	assert.Equal(t, "www.example.com", r.Name("203.0.113.7"), "the queried name, not the CNAME target")
+	assert.Equal(t, "www.example.com", r.Name("2001:db8::7"))
+	assert.Equal(t, "", r.Name("203.0.113.8"))
+
+	// Queries and failed responses teach nothing.
+	r.ObservePacket(dnsPacket(t, &layers.DNS{ID: 2, Questions: []layers.DNSQuestion{question}}))
+	r.ObservePacket(dnsPacket(t, &layers.DNS{
+		ID: 3, QR: true, ResponseCode: layers.DNSResponseCodeNXDomain,
+		Questions: []layers.DNSQuestion{{Name: []byte("evil.example"), Type: layers.DNSTypeA, Class: layers.DNSClassIN}},
+		Answers:   []layers.DNSResourceRecord{{Name: []byte("evil.example"), Type: layers.DNSTypeA, Class: layers.DNSClassIN, TTL: 60, IP: net.ParseIP("203.0.113.7").To4()}},
+	}))
+	assert.Equal(t, "www.example.com", r.Name("203.0.113.7"))
+
+	now = now.Add(60*time.Second + snoopGrace - time.Second)
+	assert.Equal(t, "www.example.com", r.Cached("203.0.113.7"))
+	now = now.Add(time.Second)
+	assert.Equal(t, "", r.Cached("203.0.113.7"), "expired with the record's TTL plus the grace period")
+}
+
+type fakePTR struct {
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (f *fakePTR) lookupAddr(ctx context.Context, addr string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls[addr]++
+	if addr == "192.0.2.1" {
+		return []string{"host.example.net."}, nil
+	}
+	return nil, errors.New("no PTR record")
+}
+
+func (f *fakePTR) count(addr string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[addr]
+}
+
+func TestReverseLookups(t *testing.T) {
+	ptr := &fakePTR{calls: make(map[string]int)}
+	r := newResolver(Options{Reverse: true, ReverseCacheSize: 100, ReverseRate: 1000}, ptr.lookupAddr)
+	defer r.Close()
+
+	assert.Equal(t, "", r.Name("192.0.2.1"), "lookups happen in the background")
+	require.Eventually(t, func() bool { return r.Name("192.0.2.1") == "host.example.net" }, time.Second, 5*time.Millisecond)
+
+	r.Name("192.0.2.2")
+	require.Eventually(t, func() bool { return ptr.count("192.0.2.2") == 1 }, time.Second, 5*time.Millisecond)
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, "", r.Name("192.0.2.2"))
+	}
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, 1, ptr.count("192.0.2.2"), "failures are cached")
+	assert.Equal(t, 1, ptr.count("192.0.2.1"))
+
+	assert.Equal(t, "", r.Cached("192.0.2.3"))
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, 0, ptr.count("192.0.2.3"), "Cached does not trigger lookups")
+}
+
+func TestReverseLookupRateLimit(t *testing.T) {
+	ptr := &fakePTR{calls: make(map[string]int)}
+	r := newResolver(Options{Reverse: true, ReverseCacheSize: 100, ReverseRate: 10}, ptr.lookupAddr)
+	defer r.Close()
+
+	for i := 0; i < 10; i++ {
+		r.Name(fmt.Sprintf("192.0.2.%d", 10+i))
+	}
+	time.Sleep(150 * time.Millisecond)
+	total := 0
+	for i := 0; i < 10; i++ {
+		total += ptr.count(fmt.Sprintf("192.0.2.%d", 10+i))
+	}
+	assert.LessOrEqual(t, total, 2, "at most 10 lookups per second")
+}
+
+func TestCacheEviction(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := newCache(10)
+	for i := 0; i < 10; i++ {
+		c.set(fmt.Sprint(i), "name", now.Add(time.Duration(i+1)*time.Minute), now)
+	}
+	c.set("new", "name", now.Add(time.Hour), now)
+	assert.Equal(t, 10, c.len())
+	_, ok := c.get("0", now)
+	assert.False(t, ok, "the entry expiring soonest is evicted")
+	_, ok = c.get("new", now)
+	assert.True(t, ok)
+
+	c.set("1", "renamed", now.Add(time.Hour), now)
+	assert.Equal(t, 10, c.len(), "updating an entry does not evict")
+
+	later := now.Add(5 * time.Minute)
+	c.set("newer", "name", later.Add(time.Hour), later)
+	assert.Equal(t, 8, c.len(), "expired entries are dropped first")
+}
+
+func TestNilResolver(t *testing.T) {
+	var r *Resolver
+	assert.Equal(t, "", r.Name("192.0.2.1"))
+	assert.Equal(t, "", r.Cached("192.0.2.1"))
+	r.Close()
+}
@@ -0,0 +1,98 @@
+package hostnames
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	reverseTTL         = time.Hour
+	reverseNegativeTTL = 10 * time.Minute
+	reverseTimeout     = 2 * time.Second
+	reverseQueueSize   = 256
+)
+
+// reverseLookup resolves PTR records in the background, one at a time and
+// no faster than its rate. Addresses that do not fit in the queue are
+// dropped and asked for again later.
+type reverseLookup struct {
+	lookupAddr func(ctx context.Context, addr string) ([]string, error)
+	cache      *cache
+	interval   time.Duration
+
+	mu      sync.Mutex
+	pending map[string]bool
+	queue   chan string
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newReverseLookup(lookupAddr func(ctx context.Context, addr string) ([]string, error), cacheSize int, rate float64) *reverseLookup {
+	r := &reverseLookup{
+		lookupAddr: lookupAddr,
+		cache:      newCache(cacheSize),
+		interval:   time.Duration(float64(time.Second) / rate),
+		pending:    make(map[string]bool),
+		queue:      make(chan string, reverseQueueSize),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+func (r *reverseLookup) enqueue(ip string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pending[ip] {
+		return
+	}
+	select {
+	case r.queue <- ip:
+		r.pending[ip] = true
+	default:
+	}
+}
+
+func (r *reverseLookup) run() {
+	defer close(r.done)
+	for {
+		select {
+		case <-r.stop:
+			return
+		case ip := <-r.queue:
+			r.resolve(ip)
+
+			select {
+			case <-r.stop:
+				return
+			case <-time.After(r.interval):
+			}
+		}
+	}
+}
+
+func (r *reverseLookup) resolve(ip string) {
+	ctx, cancel := context.WithTimeout(context.Background(), reverseTimeout)
+	names, err := r.lookupAddr(ctx, ip)
+	cancel()
+
+	now := time.Now()
+	if err != nil || len(names) == 0 {
+		r.cache.set(ip, "", now.Add(reverseNegativeTTL), now)
+	} else {
+		r.cache.set(ip, strings.TrimSuffix(names[0], "."), now.Add(reverseTTL), now)
+	}
+
+	r.mu.Lock()
+	delete(r.pending, ip)
+	r.mu.Unlock()
+}
+
+func (r *reverseLookup) close() {
+	close(r.stop)
+	<-r.done
+}
@@ -0,0 +1,360 @@
+// Package message turns alert events into the messages notifiers send: a
+// title, a description, a colour and a list of fields. Notifiers only
+// format the message for their service, so every service says the same.
+package message
+
+import (
+	"fmt"
+	"network-monitor/internal/alert"
+	"network-monitor/internal/geoip"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Colours of the built-in messages, as 0xRRGGBB.
+const (
+	ColorAlert    = 0xE74C3C
+	ColorWarning  = 0xE67E22
+	ColorDown     = 0x992D22
+	ColorResolved = 0x2ECC71
+	ColorInfo     = 0x3498DB
+)
+
+type Field struct {
+	Name  string
+	Value string
+	// Inline fields may be shown side by side.
+	Inline bool
+}
+
+type Message struct {
+	Title       string
+	Description string
+	Color       int
+	Fields      []Field
+}
+
+// Default builds the built-in message for the event.
+func Default(event alert.Event) (Message, error) {
+	switch event.Kind {
+	case alert.KindInit:
+		return initMessage(event), nil
+	case alert.KindThresholdExceeded:
+		return thresholdMessage(event), nil
+	case alert.KindBelowThreshold:
+		return belowThresholdMessage(event), nil
+	case alert.KindNoTraffic:
+		return noTrafficMessage(event), nil
+	case alert.KindRule:
+		return ruleMessage(event), nil
+	case alert.KindResolved:
+		return resolvedMessage(event), nil
+	case alert.KindSummary:
+		return summaryMessage(event), nil
+	}
+	return Message{}, fmt.Errorf("unsupported event kind %q", event.Kind)
+}
+
+// FlowLine describes a flow on one line, with its ends' hostnames, GeoIP
+// data and process if known.
+func FlowLine(flow alert.Flow) string {
+	line := fmt.Sprintf("`%s` %s", flow.Description, formatMbps(flow.SpeedMbps))
+	if flow.SrcHost != "" || flow.DstHost != "" {
+		var ends []string
+		for _, end := range [][2]string{{flow.SrcHost, flow.SrcIP}, {flow.DstHost, flow.DstIP}} {
+			if end[0] != "" {
+				ends = append(ends, end[0])
+			} else if end[1] != "" {
+				ends = append(ends, end[1])
+			}
+		}
+		line += " (" + strings.Join(ends, " → ") + ")"
+	}
+	if geo := GeoLabel(flow.Country, flow.ASN, flow.ASOrganization); geo != "" {
+		line += " [" + geo + "]"
+	}
+	if flow.Process != "" {
+		line += " — " + flow.Process
+	}
+	return line
+}
+
+// GeoLabel formats GeoIP data as "DE · AS3320 Deutsche Telekom AG".
+func GeoLabel(country string, asn uint, organization string) string {
+	var parts []string
+	if country != "" {
+		parts = append(parts, country)
+	}
+	if as := (geoip.Info{ASN: asn, Organization: organization}).AS(); as != "" {
+		parts = append(parts, as)
+	}
+	return strings.Join(parts, " · ")
+}
+
+// TalkerName is the talker's address, followed by its hostname if known.
+func TalkerName(talker alert.Talker) string {
+	if talker.Hostname != "" {
+		return talker.IP + " (" + talker.Hostname + ")"
+	}
+	return talker.IP
+}
+
+// SortedTalkers returns the top talkers, fastest first.
+func SortedTalkers(talkers []alert.Talker) []alert.Talker {
+	sorted := append([]alert.Talker(nil), talkers...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].SpeedMbps > sorted[j].SpeedMbps
+	})
+	return sorted
+}
+
+func thresholdMessage(event alert.Event) Message {
+	sortedTalkers := SortedTalkers(event.TopTalkers)
+
+	fields := []Field{
+		{Name: "Interface", Value: event.Interface, Inline: false},
+		{Name: "⬇️ Download (rx)", Value: formatMbps(event.RxMbps), Inline: true},
+		{Name: "⬆️ Upload (tx)", Value: formatMbps(event.TxMbps), Inline: true},
+		{Name: "Total", Value: formatMbps(event.SpeedMbps), Inline: true},
+	}
+	for _, talker := range sortedTalkers {
+		value := formatMbps(talker.SpeedMbps)
+		if talker.RxMbps > 0 || talker.TxMbps > 0 {
+			value += fmt.Sprintf("\n↓ %.2f / ↑ %.2f Mbps", talker.RxMbps, talker.TxMbps)
+		}
+		if len(talker.Processes) > 0 {
+			value += "\n" + strings.Join(talker.Processes, ", ")
+		}
+		if geo := GeoLabel(talker.Country, talker.ASN, talker.ASOrganization); geo != "" {
+			value += "\n" + geo
+		}
+		fields = append(fields, Field{
+			Name:   TalkerName(talker),
+			Value:  value,
+			Inline: true,
+		})
+	}
+	fields = appendFlows(fields, event.TopFlows)
+
+	description := ""
+	for _, breach := range event.Breaches {
+		description += fmt.Sprintf("%s speed of %.2f Mbps exceeded the %.2f Mbps threshold.\n",
+			DirectionLabel(breach.Direction), breach.SpeedMbps, breach.ThresholdMbps)
+	}
+	description += fmt.Sprintf("Measured over the last %d seconds.\nTop %d talkers:", event.IntervalSeconds, len(sortedTalkers))
+
+	return Message{
+		Title:       "🚨 Network Threshold Exceeded!",
+		Description: description,
+		Color:       ColorAlert,
+		Fields:      fields,
+	}
+}
+
+func appendFlows(fields []Field, flows []alert.Flow) []Field {
+	if len(flows) == 0 {
+		return fields
+	}
+	var flowLines []string
+	for _, flow := range flows {
+		flowLines = append(flowLines, FlowLine(flow))
+	}
+	return append(fields, Field{
+		Name:  "Top flows",
+		Value: strings.Join(flowLines, "\n"),
+	})
+}
+
+func belowThresholdMessage(event alert.Event) Message {
+	description := fmt.Sprintf("Overall speed of %.2f Mbps is below the %.2f Mbps minimum.\nLow for %s.",
+		event.SpeedMbps, event.ThresholdMbps, formatDuration(event.Duration))
+
+	return Message{
+		Title:       "⚠️ Network Speed Below Minimum",
+		Description: description,
+		Color:       ColorWarning,
+		Fields: []Field{
+			{Name: "Interface", Value: event.Interface, Inline: false},
+			{Name: "⬇️ Download (rx)", Value: formatMbps(event.RxMbps), Inline: true},
+			{Name: "⬆️ Upload (tx)", Value: formatMbps(event.TxMbps), Inline: true},
+			{Name: "Lowest", Value: formatMbps(event.PeakMbps), Inline: true},
+		},
+	}
+}
+
+func noTrafficMessage(event alert.Event) Message {
+	return Message{
+		Title:       "🔌 No Network Traffic",
+		Description: fmt.Sprintf("No packets have been captured for %s. The link may be down.", formatDuration(event.Duration)),
+		Color:       ColorDown,
+		Fields: []Field{
+			{Name: "Interface", Value: event.Interface, Inline: false},
+		},
+	}
+}
+
+func ruleMessage(event alert.Event) Message {
+	rule := event.Rule
+	if rule == nil {
+		rule = &alert.RuleBreach{}
+	}
+
+	fields := []Field{
+		{Name: "Interface", Value: event.Interface, Inline: false},
+		{Name: "Match", Value: rule.Match, Inline: true},
+		{Name: "Current", Value: FormatRuleValue(rule.Metric, rule.Value), Inline: true},
+		{Name: "Threshold", Value: rule.Comparison + " " + FormatRuleValue(rule.Metric, rule.Threshold), Inline: true},
+	}
+	fields = appendFlows(fields, event.TopFlows)
+
+	return Message{
+		Title:       fmt.Sprintf("🚨 Rule Triggered: %s", rule.Name),
+		Description: fmt.Sprintf("Traffic matching %s has been %s for %s.", rule.Match, ruleVerb(rule.Comparison), formatDuration(event.Duration)),
+		Color:       ColorAlert,
+		Fields:      fields,
+	}
+}
+
+func ruleVerb(comparison string) string {
+	if comparison == "<" {
+		return "below its threshold"
+	}
+	return "above its threshold"
+}
+
+// FormatRuleValue formats a rule's value in the unit of its metric.
+func FormatRuleValue(metric string, value float64) string {
+	switch metric {
+	case "bytes":
+		return fmt.Sprintf("%.0f bytes", value)
+	case "pps":
+		return fmt.Sprintf("%.1f packets/s", value)
+	default:
+		return formatMbps(value)
+	}
+}
+
+func resolvedMessage(event alert.Event) Message {
+	fields := []Field{
+		{Name: "Interface", Value: event.Interface, Inline: false},
+		{Name: "Duration", Value: formatDuration(event.Duration), Inline: true},
+	}
+
+	title := "✅ Network Threshold Resolved"
+	description := ""
+	switch event.ResolvedKind {
+	case alert.KindNoTraffic:
+		title = "✅ Network Traffic Resumed"
+		description = "Packets are being captured again."
+	case alert.KindRule:
+		if event.Rule != nil {
+			title = fmt.Sprintf("✅ Rule Resolved: %s", event.Rule.Name)
+			description = fmt.Sprintf("%s is back to %s.", event.Rule.Match, FormatRuleValue(event.Rule.Metric, event.Rule.Value))
+			fields = append(fields, Field{Name: "Peak", Value: FormatRuleValue(event.Rule.Metric, event.Rule.Peak), Inline: true})
+		}
+	case alert.KindBelowThreshold:
+		for _, breach := range event.Breaches {
+			description += fmt.Sprintf("%s speed recovered to %.2f Mbps, above the %.2f Mbps minimum.\n",
+				DirectionLabel(breach.Direction), breach.SpeedMbps, breach.ThresholdMbps)
+		}
+		fields = append(fields, Field{Name: "Lowest", Value: formatMbps(event.PeakMbps), Inline: true})
+	default:
+		for _, breach := range event.Breaches {
+			description += fmt.Sprintf("%s speed is back to %.2f Mbps, within the %.2f Mbps threshold.\n",
+				DirectionLabel(breach.Direction), breach.SpeedMbps, breach.ThresholdMbps)
+		}
+		fields = append(fields, Field{Name: "Peak", Value: formatMbps(event.PeakMbps), Inline: true})
+	}
+
+	return Message{
+		Title:       title,
+		Description: strings.TrimSuffix(description, "\n"),
+		Color:       ColorResolved,
+		Fields:      fields,
+	}
+}
+
+func summaryMessage(event alert.Event) Message {
+	summary := event.Summary
+	if summary == nil {
+		summary = &alert.Summary{}
+	}
+
+	fields := []Field{
+		{Name: "Interface", Value: event.Interface, Inline: false},
+		{Name: "⬇️ Download (rx)", Value: formatBytes(summary.RxBytes), Inline: true},
+		{Name: "⬆️ Upload (tx)", Value: formatBytes(summary.TxBytes), Inline: true},
+		{Name: "Total", Value: formatBytes(summary.TotalBytes), Inline: true},
+		{Name: "Average", Value: formatMbps(event.SpeedMbps), Inline: true},
+		{Name: "Peak", Value: formatMbps(event.PeakMbps), Inline: true},
+		{Name: "Packets", Value: fmt.Sprintf("%d", summary.Packets), Inline: true},
+	}
+	var talkerLines []string
+	for _, talker := range SortedTalkers(event.TopTalkers) {
+		talkerLines = append(talkerLines, fmt.Sprintf("%s %s", TalkerName(talker), formatMbps(talker.SpeedMbps)))
+	}
+	if len(talkerLines) > 0 {
+		fields = append(fields, Field{Name: "Top talkers (average)", Value: strings.Join(talkerLines, "\n")})
+	}
+
+	return Message{
+		Title: "📊 Traffic Summary",
+		Description: fmt.Sprintf("Traffic from %s to %s, captured for %s.",
+			summary.From.Format(time.RFC1123), summary.To.Format(time.RFC1123), formatDuration(event.Duration)),
+		Color:  ColorInfo,
+		Fields: fields,
+	}
+}
+
+// DirectionLabel names a breach direction ("rx", "tx" or "total").
+func DirectionLabel(direction string) string {
+	switch direction {
+	case "rx":
+		return "Download (rx)"
+	case "tx":
+		return "Upload (tx)"
+	default:
+		return "Overall"
+	}
+}
+
+func initMessage(event alert.Event) Message {
+	interfaceName := event.Interface
+	if interfaceName == "" {
+		interfaceName = "Auto-Selected"
+	}
+
+	description := fmt.Sprintf(
+		"Network Monitor started.\nMonitoring Interface: **%s**\nThreshold: **%.2f Mbps**\nCheck Interval: **%ds**",
+		interfaceName, event.ThresholdMbps, event.IntervalSeconds,
+	)
+
+	return Message{
+		Title:       "🚀 Monitor Initialized",
+		Description: description,
+		Color:       ColorInfo,
+	}
+}
+
+func formatMbps(mbps float64) string {
+	return fmt.Sprintf("%.2f Mbps", mbps)
+}
+
+func formatDuration(d time.Duration) string {
+	return d.Round(time.Second).String()
+}
+
+// formatBytes formats n in decimal units, e.g. "1.5 MB".
+func formatBytes(n int64) string {
+	const unit = 1000
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "kMGTPE"[exp])
+}
@@ -0,0 +1,231 @@
+package message
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"network-monitor/internal/alert"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Data is what templates are executed with: the event, plus the built-in
+// message so a template can extend it rather than start over.
+type Data struct {
+	alert.Event
+	Default Message
+}
+
+// Templates replace the built-in messages of some event kinds. Each is a
+// text/template file that may define the blocks "title", "description",
+// "color" and "fields"; blocks it does not define keep the built-in part.
+// Text outside of any block is used as the description if there is no
+// "description" block.
+//
+// A nil *Templates renders the built-in messages.
+type Templates struct {
+	byKind map[alert.Kind]*template.Template
+	// sources holds the text of each template, to tell whether a reload
+	// changed anything.
+	sources map[alert.Kind]string
+}
+
+// Load parses the template files, keyed by the event kind they are for.
+func Load(files map[string]string) (*Templates, error) {
+	if len(files) == 0 {
+		return nil, nil
+	}
+	t := &Templates{byKind: make(map[alert.Kind]*template.Template), sources: make(map[alert.Kind]string)}
+	for kind, path := range files {
+		if !knownKind(alert.Kind(kind)) {
+			return nil, fmt.Errorf("template %s: unknown event kind %q", path, kind)
+		}
+		text, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read template: %w", err)
+		}
+		tmpl, err := template.New(filepath.Base(path)).Funcs(funcs()).Parse(string(text))
+		if err != nil {
+			return nil, fmt.Errorf("could not parse template: %w", err)
+		}
+		t.byKind[alert.Kind(kind)] = tmpl
+		t.sources[alert.Kind(kind)] = string(text)
+	}
+	return t, nil
+}
+
+// Equal reports whether both render the same messages: they were loaded
+// from templates with the same text for the same kinds.
+func (t *Templates) Equal(other *Templates) bool {
+	if t == nil || other == nil {
+		return t == other
+	}
+	return maps.Equal(t.sources, other.sources)
+}
+
+func knownKind(kind alert.Kind) bool {
+	switch kind {
+	case alert.KindInit, alert.KindThresholdExceeded, alert.KindBelowThreshold,
+		alert.KindNoTraffic, alert.KindRule, alert.KindResolved, alert.KindSummary:
+		return true
+	}
+	return false
+}
+
+// Render builds the message for the event from its template, or the
+// built-in message if there is none. Its errors are permanent: sending the
+// event again would fail the same way.
+func (t *Templates) Render(event alert.Event) (Message, error) {
+	msg, err := t.render(event)
+	if err != nil {
+		return Message{}, &renderError{err}
+	}
+	return msg, nil
+}
+
+// renderError is a message that could not be built.
+type renderError struct {
+	err error
+}
+
+func (e *renderError) Error() string   { return e.err.Error() }
+func (e *renderError) Unwrap() error   { return e.err }
+func (e *renderError) Permanent() bool { return true }
+
+func (t *Templates) render(event alert.Event) (Message, error) {
+	msg, err := Default(event)
+	if err != nil {
+		return Message{}, err
+	}
+	if t == nil || t.byKind[event.Kind] == nil {
+		return msg, nil
+	}
+
+	// Every execution gets its own copy so that field calls collect into
+	// this message only.
+	tmpl, err := t.byKind[event.Kind].Clone()
+	if err != nil {
+		return Message{}, err
+	}
+	var fields []Field
+	addField := func(inline bool) func(name string, value any) string {
+		return func(name string, value any) string {
+			fields = append(fields, Field{Name: name, Value: strings.TrimSpace(fmt.Sprint(value)), Inline: inline})
+			return ""
+		}
+	}
+	tmpl.Funcs(template.FuncMap{
+		"field":  addField(false),
+		"inline": addField(true),
+		"include": func(name string, data any) (string, error) {
+			var buf bytes.Buffer
+			err := tmpl.ExecuteTemplate(&buf, name, data)
+			return buf.String(), err
+		},
+	})
+
+	data := Data{Event: event, Default: msg}
+	execute := func(name string) (string, bool, error) {
+		if tmpl.Lookup(name) == nil {
+			return "", false, nil
+		}
+		var buf bytes.Buffer
+		if err := tmpl.ExecuteTemplate(&buf, name, data); err != nil {
+			return "", false, fmt.Errorf("template %s: %w", tmpl.Name(), err)
+		}
+		return strings.TrimSpace(buf.String()), true, nil
+	}
+
+	if title, ok, err := execute("title"); err != nil {
+		return Message{}, err
+	} else if ok {
+		msg.Title = title
+	}
+
+	description, ok, err := execute("description")
+	if err != nil {
+		return Message{}, err
+	}
+	if !ok {
+		description, _, err = execute(tmpl.Name())
+		if err != nil {
+			return Message{}, err
+		}
+		ok = description != ""
+	}
+	if ok {
+		msg.Description = description
+	}
+
+	if color, ok, err := execute("color"); err != nil {
+		return Message{}, err
+	} else if ok {
+		if msg.Color, err = parseColor(color); err != nil {
+			return Message{}, fmt.Errorf("template %s: %w", tmpl.Name(), err)
+		}
+	}
+
+	fields = nil
+	if _, ok, err := execute("fields"); err != nil {
+		return Message{}, err
+	} else if ok {
+		msg.Fields = fields
+	}
+	return msg, nil
+}
+
+// parseColor reads a colour as "#e74c3c" or as a decimal number.
+func parseColor(s string) (int, error) {
+	base, digits := 10, s
+	if strings.HasPrefix(s, "#") {
+		base, digits = 16, s[1:]
+	}
+	v, err := strconv.ParseInt(digits, base, 32)
+	if err != nil || v < 0 || v > 0xFFFFFF {
+		return 0, fmt.Errorf("invalid color %q", s)
+	}
+	return int(v), nil
+}
+
+// funcs are the helpers available to templates. field, inline and include
+// are placeholders here, bound for every execution by Render.
+func funcs() template.FuncMap {
+	return template.FuncMap{
+		"field":   func(string, any) string { return "" },
+		"inline":  func(string, any) string { return "" },
+		"include": func(string, any) (string, error) { return "", nil },
+
+		"mbps":      formatMbps,
+		"bytes":     anyBytes,
+		"duration":  formatDuration,
+		"time":      func(t time.Time, layout string) string { return t.Format(layout) },
+		"direction": DirectionLabel,
+		"ruleValue": FormatRuleValue,
+		"flow":      FlowLine,
+		"talker":    TalkerName,
+		"geo":       GeoLabel,
+		"sorted":    SortedTalkers,
+		"join":      strings.Join,
+		"upper":     strings.ToUpper,
+		"lower":     strings.ToLower,
+	}
+}
+
+// anyBytes is formatBytes for the integer and float values templates have.
+func anyBytes(n any) (string, error) {
+	switch v := n.(type) {
+	case int:
+		return formatBytes(int64(v)), nil
+	case int64:
+		return formatBytes(v), nil
+	case uint64:
+		return formatBytes(int64(v)), nil
+	case float64:
+		return formatBytes(int64(v)), nil
+	}
+	return "", fmt.Errorf("bytes: unsupported value %v", n)
+}
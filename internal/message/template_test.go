@@ -0,0 +1,153 @@
+package message
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"network-monitor/internal/alert"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTemplate(t *testing.T, text string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "message.tmpl")
+	require.NoError(t, os.WriteFile(path, []byte(text), 0o644))
+	return path
+}
+
+func thresholdEvent() alert.Event {
+	return alert.Event{
+		Kind:            alert.KindThresholdExceeded,
+		Interface:       "eth0",
+		IntervalSeconds: 60,
+		SpeedMbps:       150,
+		RxMbps:          120,
+		TxMbps:          30,
+		Breaches:        []alert.Breach{{Direction: "rx", SpeedMbps: 120, ThresholdMbps: 100}},
+		TopTalkers: []alert.Talker{
+			{IP: "10.0.0.2", SpeedMbps: 10, Hostname: "printer.lan"},
+			{IP: "10.0.0.1", SpeedMbps: 90, Country: "DE", ASN: 3320},
+		},
+		Duration: 90 * time.Second,
+	}
+}
+
+func TestRender(t *testing.T) {
+	path := writeTemplate(t, `
+{{define "title"}}🚨 {{.Interface}}: Schwellwert überschritten{{end}}
+{{define "color"}}#ff8800{{end}}
+{{define "description"}}
+{{range .Breaches}}{{direction .Direction}}: {{mbps .SpeedMbps}} (Grenze {{mbps .ThresholdMbps}})
+{{end}}Seit {{duration .Duration}}, {{bytes 1500000}} im Intervall.
+Runbook: https://wiki.example.com/runbooks/{{.Interface}}
+{{end}}
+{{define "talkers"}}{{range sorted .TopTalkers}}{{talker .}} {{mbps .SpeedMbps}} {{geo .Country .ASN .ASOrganization}}
+{{end}}{{end}}
+{{define "fields"}}
+{{inline "Empfang" (mbps .RxMbps)}}
+{{inline "Senden" (mbps .TxMbps)}}
+{{field "Top-Hosts" (include "talkers" .)}}
+{{end}}
+`)
+	templates, err := Load(map[string]string{"threshold_exceeded": path})
+	require.NoError(t, err)
+
+	msg, err := templates.Render(thresholdEvent())
+	require.NoError(t, err)
+	assert.Equal(t, "🚨 eth0: Schwellwert überschritten", msg.Title)
+	assert.Equal(t, 0xff8800, msg.Color)
+	assert.Equal(t, "Download (rx): 120.00 Mbps (Grenze 100.00 Mbps)\nSeit 1m30s, 1.5 MB im Intervall.\nRunbook: https://wiki.example.com/runbooks/eth0", msg.Description)
+	assert.Equal(t, []Field{
+		{Name: "Empfang", Value: "120.00 Mbps", Inline: true},
+		{Name: "Senden", Value: "30.00 Mbps", Inline: true},
+		{Name: "Top-Hosts", Value: "10.0.0.1 90.00 Mbps DE · AS3320\n10.0.0.2 (printer.lan) 10.00 Mbps"},
+	}, msg.Fields)
+
+	msg, err = templates.Render(alert.Event{Kind: alert.KindInit, IntervalSeconds: 60})
+	require.NoError(t, err)
+	assert.Equal(t, "🚀 Monitor Initialized", msg.Title, "kinds without a template keep the built-in message")
+}
+
+func TestRenderExtendsDefault(t *testing.T) {
+	path := writeTemplate(t, "{{.Default.Description}}\n\nRunbook: https://wiki.example.com/network\n")
+	templates, err := Load(map[string]string{"threshold_exceeded": path})
+	require.NoError(t, err)
+
+	event := thresholdEvent()
+	want, err := Default(event)
+	require.NoError(t, err)
+	msg, err := templates.Render(event)
+	require.NoError(t, err)
+	assert.Equal(t, want.Title, msg.Title)
+	assert.Equal(t, want.Fields, msg.Fields)
+	assert.Equal(t, want.Description+"\n\nRunbook: https://wiki.example.com/network", msg.Description)
+
+	var none *Templates
+	msg, err = none.Render(event)
+	require.NoError(t, err)
+	assert.Equal(t, want, msg)
+}
+
+func TestRenderSummary(t *testing.T) {
+	path := writeTemplate(t, `
+{{define "title"}}📊 {{.Interface}}: Tagesbericht{{end}}
+{{define "description"}}{{time .Summary.From "02.01."}}: {{bytes .Summary.TotalBytes}}, Spitze {{mbps .PeakMbps}}{{end}}
+`)
+	templates, err := Load(map[string]string{"summary": path})
+	require.NoError(t, err)
+
+	from := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	event := alert.Event{
+		Kind:       alert.KindSummary,
+		Interface:  "eth0",
+		Duration:   24 * time.Hour,
+		SpeedMbps:  1.5,
+		PeakMbps:   80,
+		TopTalkers: []alert.Talker{{IP: "10.0.0.1", SpeedMbps: 1}},
+		Summary:    &alert.Summary{From: from, To: from.Add(24 * time.Hour), TotalBytes: 16_200_000_000, RxBytes: 16_000_000_000, TxBytes: 200_000_000},
+	}
+	msg, err := templates.Render(event)
+	require.NoError(t, err)
+	assert.Equal(t, "📊 eth0: Tagesbericht", msg.Title)
+	assert.Equal(t, "01.03.: 16.2 GB, Spitze 80.00 Mbps", msg.Description)
+
+	want, err := Default(event)
+	require.NoError(t, err)
+	assert.Equal(t, want.Fields, msg.Fields, "the built-in fields are kept")
+	assert.Contains(t, want.Fields, Field{Name: "Total", Value: "16.2 GB", Inline: true})
+}
+
+func TestLoadErrors(t *testing.T) {
+	templates, err := Load(nil)
+	require.NoError(t, err)
+	assert.Nil(t, templates)
+
+	_, err = Load(map[string]string{"weekly": writeTemplate(t, "")})
+	assert.ErrorContains(t, err, `unknown event kind "weekly"`)
+	_, err = Load(map[string]string{"resolved": filepath.Join(t.TempDir(), "missing.tmpl")})
+	assert.ErrorContains(t, err, "could not read template")
+	_, err = Load(map[string]string{"resolved": writeTemplate(t, "{{if}}")})
+	assert.ErrorContains(t, err, "could not parse template")
+	_, err = Load(map[string]string{"resolved": writeTemplate(t, "{{nosuchfunc}}")})
+	assert.ErrorContains(t, err, "nosuchfunc")
+
+	templates, err = Load(map[string]string{"resolved": writeTemplate(t, `{{define "color"}}red{{end}}`)})
+	require.NoError(t, err)
+	_, err = templates.Render(alert.Event{Kind: alert.KindResolved})
+	assert.ErrorContains(t, err, `invalid color "red"`)
+
+	templates, err = Load(map[string]string{"resolved": writeTemplate(t, `{{.NoSuchField}}`)})
+	require.NoError(t, err)
+	_, err = templates.Render(alert.Event{Kind: alert.KindResolved})
+	assert.ErrorContains(t, err, "NoSuchField")
+
+	// Retrying cannot fix a broken template.
+	var permanent interface{ Permanent() bool }
+	require.True(t, errors.As(err, &permanent))
+	assert.True(t, permanent.Permanent())
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"log"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -36,16 +38,122 @@ var (
 		[]string{"interface", "ip_address"},
 	)
 
-	thresholdExceeded = promauto.NewGauge(
+	hostSpeed = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "network_host_speed_mbps",
+			Help: "Per-host speed in Mbps for local hosts, split by direction",
+		},
+		[]string{"interface", "ip_address", "direction"},
+	)
+
+	hostInfo = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "network_host_info",
+			Help: "Hostname of each host with traffic, always 1; join on ip_address to label other series",
+		},
+		[]string{"interface", "ip_address", "hostname"},
+	)
+
+	processSpeed = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "network_process_speed_mbps",
+			Help: "Speed in Mbps of the local processes (container/command) owning captured flows",
+		},
+		[]string{"interface", "process"},
+	)
+
+	countryTraffic = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "network_country_traffic_bytes_total",
+			Help: "Traffic in bytes exchanged with each country, by the GeoIP location of the remote end",
+		},
+		[]string{"interface", "country", "direction"},
+	)
+
+	asnTraffic = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "network_asn_traffic_bytes_total",
+			Help: "Traffic in bytes exchanged with each autonomous system, by the GeoIP data of the remote end",
+		},
+		[]string{"interface", "asn", "organization", "direction"},
+	)
+
+	thresholdExceeded = promauto.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "network_threshold_exceeded",
 			Help: "Whether the network speed threshold is exceeded (1 for yes, 0 for no)",
 		},
+		[]string{"interface"},
+	)
+
+	ruleExceeded = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "network_rule_exceeded",
+			Help: "Whether a configured rule is exceeded (1 for yes, 0 for no)",
+		},
+		[]string{"interface", "rule"},
+	)
+
+	ruleValue = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "network_rule_value",
+			Help: "Current value of each configured rule's metric",
+		},
+		[]string{"interface", "rule"},
+	)
+
+	belowThreshold = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "network_below_threshold",
+			Help: "Whether the network speed is below the minimum threshold (1 for yes, 0 for no)",
+		},
+		[]string{"interface"},
+	)
+
+	noTraffic = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "network_no_traffic",
+			Help: "Whether no packets have been seen for the configured number of intervals (1 for yes, 0 for no)",
+		},
+		[]string{"interface"},
+	)
+
+	notificationQueue = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "network_notification_queue_depth",
+			Help: "Notifications waiting to be sent, per notifier",
+		},
+		[]string{"notifier"},
+	)
+
+	notificationRetries = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "network_notification_retries_total",
+			Help: "Notification attempts that failed or were rate limited and will be retried",
+		},
+		[]string{"notifier"},
+	)
+
+	notificationFailures = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "network_notification_failures_total",
+			Help: "Notifications dropped without being delivered",
+		},
+		[]string{"notifier"},
+	)
+
+	packets = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "network_packets_total",
+			Help: "Total number of captured packets",
+		},
+		[]string{"interface"},
 	)
 )
 
 type MetricsServer struct {
 	server *http.Server
+	mux    *http.ServeMux
 }
 
 func NewMetricsServer(port string) *MetricsServer {
@@ -63,9 +171,15 @@ func NewMetricsServer(port string) *MetricsServer {
 
 	return &MetricsServer{
 		server: server,
+		mux:    mux,
 	}
 }
 
+// Handle serves an additional handler next to /metrics.
+func (m *MetricsServer) Handle(pattern string, handler http.Handler) {
+	m.mux.Handle(pattern, handler)
+}
+
 func (m *MetricsServer) Start() {
 	go func() {
 		log.Printf("Starting Prometheus metrics server on %s", m.server.Addr)
@@ -89,27 +203,162 @@ func contextWithTimeout(timeout time.Duration) (context.Context, context.CancelF
 	return context.WithTimeout(context.Background(), timeout)
 }
 
-func UpdateNetworkSpeed(interfaceName string, speedMbps float64) {
-	networkSpeed.WithLabelValues(interfaceName, "total").Set(speedMbps)
+func UpdateNetworkSpeed(interfaceName, direction string, speedMbps float64) {
+	networkSpeed.WithLabelValues(interfaceName, direction).Set(speedMbps)
 }
 
-func UpdateNetworkTraffic(interfaceName string, bytes int64) {
-	networkTraffic.WithLabelValues(interfaceName, "total").Add(float64(bytes))
+func UpdateNetworkTraffic(interfaceName, direction string, bytes int64) {
+	networkTraffic.WithLabelValues(interfaceName, direction).Add(float64(bytes))
+}
+
+func UpdateHostSpeeds(interfaceName, direction string, ipSpeeds map[string]float64) {
+	hostSpeed.DeletePartialMatch(prometheus.Labels{"interface": interfaceName, "direction": direction})
+
+	for ip, speed := range ipSpeeds {
+		hostSpeed.WithLabelValues(interfaceName, ip, direction).Set(speed)
+	}
 }
 
 func UpdateTopTalkers(interfaceName string, ipSpeeds map[string]float64) {
 
-	topTalkers.Reset()
+	topTalkers.DeletePartialMatch(prometheus.Labels{"interface": interfaceName})
 
 	for ip, speed := range ipSpeeds {
 		topTalkers.WithLabelValues(interfaceName, ip).Set(speed)
 	}
 }
 
-func UpdateThresholdStatus(exceeded bool) {
-	if exceeded {
-		thresholdExceeded.Set(1)
-	} else {
-		thresholdExceeded.Set(0)
+// UpdateHostInfo replaces the hostname series of an interface. A nil map
+// removes them.
+func UpdateHostInfo(interfaceName string, hostnames map[string]string) {
+	hostInfo.DeletePartialMatch(prometheus.Labels{"interface": interfaceName})
+	for ip, hostname := range hostnames {
+		hostInfo.WithLabelValues(interfaceName, ip, hostname).Set(1)
+	}
+}
+
+// UpdateProcessSpeeds replaces the per-process series of an interface. A nil
+// map removes them.
+func UpdateProcessSpeeds(interfaceName string, speeds map[string]float64) {
+	processSpeed.DeletePartialMatch(prometheus.Labels{"interface": interfaceName})
+	for name, speed := range speeds {
+		processSpeed.WithLabelValues(interfaceName, name).Set(speed)
+	}
+}
+
+// geoSeriesTTL is how long a country or AS series is kept without traffic.
+// A busy link talks to thousands of ASes over time; only the recent ones are
+// exported. A series that comes back starts from zero, which rate() treats
+// as a counter reset.
+const geoSeriesTTL = time.Hour
+
+// geoSeries holds when each country and AS series last had traffic, keyed
+// by its labels without the direction.
+var geoSeries = struct {
+	sync.Mutex
+	countries map[[2]string]time.Time
+	asns      map[[3]string]time.Time
+}{
+	countries: make(map[[2]string]time.Time),
+	asns:      make(map[[3]string]time.Time),
+}
+
+// UpdateCountryTraffic adds an interval's traffic with a country, ending at
+// now. total includes transit traffic, which is neither rx nor tx.
+func UpdateCountryTraffic(interfaceName, country string, total, rx, tx int64, now time.Time) {
+	countryTraffic.WithLabelValues(interfaceName, country, "total").Add(float64(total))
+	countryTraffic.WithLabelValues(interfaceName, country, "rx").Add(float64(rx))
+	countryTraffic.WithLabelValues(interfaceName, country, "tx").Add(float64(tx))
+
+	geoSeries.Lock()
+	geoSeries.countries[[2]string{interfaceName, country}] = now
+	geoSeries.Unlock()
+}
+
+// UpdateASNTraffic adds an interval's traffic with an autonomous system,
+// ending at now.
+func UpdateASNTraffic(interfaceName string, asn uint, organization string, total, rx, tx int64, now time.Time) {
+	label := strconv.FormatUint(uint64(asn), 10)
+	asnTraffic.WithLabelValues(interfaceName, label, organization, "total").Add(float64(total))
+	asnTraffic.WithLabelValues(interfaceName, label, organization, "rx").Add(float64(rx))
+	asnTraffic.WithLabelValues(interfaceName, label, organization, "tx").Add(float64(tx))
+
+	geoSeries.Lock()
+	geoSeries.asns[[3]string{interfaceName, label, organization}] = now
+	geoSeries.Unlock()
+}
+
+// ExpireGeoTraffic removes the country and AS series of an interface that
+// had no traffic for geoSeriesTTL before now.
+func ExpireGeoTraffic(interfaceName string, now time.Time) {
+	cutoff := now.Add(-geoSeriesTTL)
+
+	geoSeries.Lock()
+	defer geoSeries.Unlock()
+	for labels, seen := range geoSeries.countries {
+		if labels[0] == interfaceName && seen.Before(cutoff) {
+			for _, direction := range []string{"total", "rx", "tx"} {
+				countryTraffic.DeleteLabelValues(labels[0], labels[1], direction)
+			}
+			delete(geoSeries.countries, labels)
+		}
+	}
+	for labels, seen := range geoSeries.asns {
+		if labels[0] == interfaceName && seen.Before(cutoff) {
+			for _, direction := range []string{"total", "rx", "tx"} {
+				asnTraffic.DeleteLabelValues(labels[0], labels[1], labels[2], direction)
+			}
+			delete(geoSeries.asns, labels)
+		}
+	}
+}
+
+func UpdateThresholdStatus(interfaceName string, exceeded bool) {
+	thresholdExceeded.WithLabelValues(interfaceName).Set(boolToFloat(exceeded))
+}
+
+func UpdateRuleStatus(interfaceName, rule string, value float64, exceeded bool) {
+	ruleValue.WithLabelValues(interfaceName, rule).Set(value)
+	ruleExceeded.WithLabelValues(interfaceName, rule).Set(boolToFloat(exceeded))
+}
+
+func UpdateBelowThresholdStatus(interfaceName string, below bool) {
+	belowThreshold.WithLabelValues(interfaceName).Set(boolToFloat(below))
+}
+
+func UpdateNoTrafficStatus(interfaceName string, silent bool) {
+	noTraffic.WithLabelValues(interfaceName).Set(boolToFloat(silent))
+}
+
+func UpdatePackets(interfaceName string, count int64) {
+	packets.WithLabelValues(interfaceName).Add(float64(count))
+}
+
+// UpdateNotificationQueue replaces the queue depth series.
+func UpdateNotificationQueue(depths map[string]int) {
+	notificationQueue.Reset()
+	for notifier, depth := range depths {
+		notificationQueue.WithLabelValues(notifier).Set(float64(depth))
+	}
+}
+
+func AddNotificationRetry(notifier string) {
+	notificationRetries.WithLabelValues(notifier).Inc()
+}
+
+func AddNotificationFailure(notifier string) {
+	notificationFailures.WithLabelValues(notifier).Inc()
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
 	}
+	return 0
+}
+
+// DeleteRule removes every series of a rule that no longer exists.
+func DeleteRule(rule string) {
+	ruleValue.DeletePartialMatch(prometheus.Labels{"rule": rule})
+	ruleExceeded.DeletePartialMatch(prometheus.Labels{"rule": rule})
 }
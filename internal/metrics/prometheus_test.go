@@ -0,0 +1,44 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpireGeoTraffic(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	UpdateCountryTraffic("geo0", "US", 300, 200, 100, base)
+	UpdateASNTraffic("geo0", 15169, "Google LLC", 300, 200, 100, base)
+	UpdateCountryTraffic("geo0", "DE", 30, 20, 10, base.Add(30*time.Minute))
+	UpdateCountryTraffic("geo1", "US", 30, 20, 10, base)
+
+	ExpireGeoTraffic("geo0", base.Add(geoSeriesTTL))
+	assert.Equal(t, 9, testutil.CollectAndCount(countryTraffic), "nothing is idle for longer than the TTL yet")
+
+	ExpireGeoTraffic("geo0", base.Add(geoSeriesTTL+time.Minute))
+	assert.Equal(t, 6, testutil.CollectAndCount(countryTraffic), "US on geo0 is removed, DE and geo1 are kept")
+	assert.Equal(t, 0, testutil.CollectAndCount(asnTraffic))
+	assert.Equal(t, 20.0, testutil.ToFloat64(countryTraffic.WithLabelValues("geo0", "DE", "rx")))
+
+	// A series that comes back starts over.
+	UpdateCountryTraffic("geo0", "US", 3, 2, 1, base.Add(2*time.Hour))
+	assert.Equal(t, 2.0, testutil.ToFloat64(countryTraffic.WithLabelValues("geo0", "US", "rx")))
+}
+
+func TestRuleStatusKeepsThresholdSeries(t *testing.T) {
+	UpdateThresholdStatus("rules0", true)
+	UpdateRuleStatus("rules0", "nas", 42, true)
+	UpdateRuleStatus("rules0", "backup", 1, false)
+
+	assert.Equal(t, 1, testutil.CollectAndCount(thresholdExceeded), "rules do not add threshold series")
+	assert.Equal(t, 1.0, testutil.ToFloat64(thresholdExceeded.WithLabelValues("rules0")))
+	assert.Equal(t, 2, testutil.CollectAndCount(ruleExceeded))
+
+	DeleteRule("nas")
+	assert.Equal(t, 1, testutil.CollectAndCount(ruleExceeded))
+	assert.Equal(t, 1, testutil.CollectAndCount(ruleValue))
+	assert.Equal(t, 1, testutil.CollectAndCount(thresholdExceeded))
+}
@@ -0,0 +1,126 @@
+package monitor
+
+import (
+	"log"
+	"network-monitor/internal/analysis"
+	"network-monitor/internal/process"
+	"sort"
+	"time"
+)
+
+// maxTalkerProcesses limits the programs listed for each top talker.
+const maxTalkerProcesses = 3
+
+// attribution maps the flows of one interval to the local processes owning
+// them. A nil attribution (attribution disabled) knows nothing.
+type attribution struct {
+	flows map[analysis.FlowKey]process.Process
+	// hosts holds the bytes of every program, by name, per local address.
+	hosts    map[string]map[string]int64
+	programs map[string]int64
+}
+
+func attribute(resolver *process.Resolver, flows []analysis.FlowRecord) *attribution {
+	if resolver == nil {
+		return nil
+	}
+	if err := resolver.Refresh(time.Now()); err != nil {
+		log.Printf("Warning: process attribution failed: %v", err)
+		return nil
+	}
+
+	a := &attribution{
+		flows:    make(map[analysis.FlowKey]process.Process),
+		hosts:    make(map[string]map[string]int64),
+		programs: make(map[string]int64),
+	}
+	for _, flow := range flows {
+		if flow.Bytes == 0 {
+			continue
+		}
+		for _, end := range localEnds(flow) {
+			p, ok := resolver.Lookup(flow.Key.Protocol, end.ip, end.port)
+			if !ok {
+				continue
+			}
+			a.flows[flow.Key] = p
+			if a.hosts[end.ip] == nil {
+				a.hosts[end.ip] = make(map[string]int64)
+			}
+			a.hosts[end.ip][p.Name()] += flow.Bytes
+			a.programs[p.Name()] += flow.Bytes
+			break
+		}
+	}
+	return a
+}
+
+type endpoint struct {
+	ip   string
+	port uint16
+}
+
+// localEnds returns the ends of a flow that can belong to a local socket,
+// the sending end first.
+func localEnds(flow analysis.FlowRecord) []endpoint {
+	src := endpoint{flow.Key.SrcIP, flow.Key.SrcPort}
+	dst := endpoint{flow.Key.DstIP, flow.Key.DstPort}
+	switch flow.Direction {
+	case analysis.DirectionTx:
+		return []endpoint{src}
+	case analysis.DirectionRx:
+		return []endpoint{dst}
+	case analysis.DirectionLocal:
+		return []endpoint{src, dst}
+	}
+	return nil
+}
+
+// flow describes the process owning the local end of the flow.
+func (a *attribution) flow(key analysis.FlowKey) string {
+	if a == nil {
+		return ""
+	}
+	if p, ok := a.flows[key]; ok {
+		return p.String()
+	}
+	return ""
+}
+
+// processes returns the busiest programs behind a local address.
+func (a *attribution) processes(ip string) []string {
+	if a == nil {
+		return nil
+	}
+	names := sortedByBytes(a.hosts[ip])
+	if len(names) > maxTalkerProcesses {
+		names = names[:maxTalkerProcesses]
+	}
+	return names
+}
+
+// speeds returns the speed of every program in Mbps.
+func (a *attribution) speeds(interval time.Duration) map[string]float64 {
+	if a == nil {
+		return nil
+	}
+	speeds := make(map[string]float64, len(a.programs))
+	for name, bytes := range a.programs {
+		speeds[name] = analysis.CalculateSpeedMbps(bytes, interval)
+	}
+	return speeds
+}
+
+func sortedByBytes(bytes map[string]int64) []string {
+	names := make([]string, 0, len(bytes))
+	for name := range bytes {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if bytes[names[i]] != bytes[names[j]] {
+			return bytes[names[i]] > bytes[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
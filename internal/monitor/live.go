@@ -0,0 +1,111 @@
+package monitor
+
+import (
+	"network-monitor/internal/alert"
+	"network-monitor/internal/api"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	maxRecentSnapshots = 120
+	maxRecentEvents    = 50
+)
+
+// liveState keeps the recent intervals and alert notifications in memory
+// for the API and dashboard.
+type liveState struct {
+	mu        sync.RWMutex
+	snapshots map[string][]api.Snapshot
+	updated   map[string]time.Time
+	events    []alert.Event
+}
+
+func newLiveState() *liveState {
+	return &liveState{
+		snapshots: make(map[string][]api.Snapshot),
+		updated:   make(map[string]time.Time),
+	}
+}
+
+func (l *liveState) record(snapshot api.Snapshot, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	snapshots := append(l.snapshots[snapshot.Interface], snapshot)
+	if len(snapshots) > maxRecentSnapshots {
+		snapshots = snapshots[len(snapshots)-maxRecentSnapshots:]
+	}
+	l.snapshots[snapshot.Interface] = snapshots
+	l.updated[snapshot.Interface] = now
+}
+
+func (l *liveState) remove(interfaceName string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.snapshots, interfaceName)
+	delete(l.updated, interfaceName)
+}
+
+// latest returns the newest snapshot of every interface, sorted by name.
+func (l *liveState) latest() []api.Snapshot {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	latest := make([]api.Snapshot, 0, len(l.snapshots))
+	for _, snapshots := range l.snapshots {
+		latest = append(latest, snapshots[len(snapshots)-1])
+	}
+	sort.Slice(latest, func(i, j int) bool {
+		return latest[i].Interface < latest[j].Interface
+	})
+	return latest
+}
+
+// recent returns every kept snapshot ordered by start time.
+func (l *liveState) recent() []api.Snapshot {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	var recent []api.Snapshot
+	for _, snapshots := range l.snapshots {
+		recent = append(recent, snapshots...)
+	}
+	sort.SliceStable(recent, func(i, j int) bool {
+		if !recent[i].Start.Equal(recent[j].Start) {
+			return recent[i].Start.Before(recent[j].Start)
+		}
+		return recent[i].Interface < recent[j].Interface
+	})
+	return recent
+}
+
+func (l *liveState) lastUpdate(interfaceName string) (time.Time, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	t, ok := l.updated[interfaceName]
+	return t, ok
+}
+
+func (l *liveState) addEvent(event alert.Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.events = append(l.events, event)
+	if len(l.events) > maxRecentEvents {
+		l.events = l.events[len(l.events)-maxRecentEvents:]
+	}
+}
+
+// recentEvents returns the kept alert notifications, newest first.
+func (l *liveState) recentEvents() []alert.Event {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	events := make([]alert.Event, len(l.events))
+	for i, event := range l.events {
+		events[len(events)-1-i] = event
+	}
+	return events
+}
@@ -1,161 +1,972 @@
 package monitor
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"net/http"
+	"network-monitor/internal/alert"
 	"network-monitor/internal/analysis"
+	"network-monitor/internal/api"
+	"network-monitor/internal/broker"
 	"network-monitor/internal/capture"
 	"network-monitor/internal/config"
-	"network-monitor/internal/discord"
+	"network-monitor/internal/dashboard"
+	"network-monitor/internal/geoip"
+	"network-monitor/internal/hostnames"
 	"network-monitor/internal/metrics"
+	"network-monitor/internal/notify"
+	"network-monitor/internal/process"
+	"network-monitor/internal/rules"
+	"network-monitor/internal/storage"
+	"path/filepath"
 	"sort"
+	"sync"
+	"time"
 
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/pcap"
 )
 
 type Monitor struct {
-	cfg           *config.Config
+	mu            sync.RWMutex
+	settings      *settings
+	interfaces    []*interfaceMonitor
+	runWG         sync.WaitGroup
+	stopChan      chan struct{}
+	metricsServer *metrics.MetricsServer
+	apiServer     *api.Server
+	outbox        *notify.Queue
+	alerts        *alert.Tracker
+	history       *storage.Store
+	// hostnames is nil unless DNS snooping or reverse DNS is enabled.
+	hostnames *hostnames.Resolver
+
+	// results fans every interval of every pipeline out to the monitor,
+	// metrics and history subscribers, which consumersWG tracks.
+	results     *broker.Broker[intervalResult]
+	consumersWG sync.WaitGroup
+
+	live    *liveState
+	updates *broker.Broker[api.Update]
+	// summaries holds the summary in progress of every interface. Only the
+	// summarize subscriber uses it, and Close once the subscribers are done.
+	summaries map[string]*trafficSummary
+}
+
+// intervalResult is an aggregated interval and the pipeline it came from.
+type intervalResult struct {
+	im     *interfaceMonitor
+	result *analysis.IntervalResult
+}
+
+// settings is the reloadable part of the monitor. It is replaced as a whole
+// so that every interval is evaluated against one consistent configuration.
+type settings struct {
+	cfg *config.Config
+	// interfaces holds the resolved interface configs keyed by their
+	// configured name, which is empty for the auto-selected interface.
+	interfaces map[string]config.InterfaceConfig
+	notifier   notify.Multi
+	rules      []*rules.Rule
+	// resolver is nil unless process attribution is enabled.
+	resolver *process.Resolver
+	// geo is nil unless a GeoIP database is configured. It is reopened on
+	// every reload, which picks up updated database files.
+	geo *geoip.DB
+}
+
+// interfaceMonitor is the capture and aggregation pipeline for a single
+// interface (or replayed capture file). cfg is the configuration the
+// pipeline was started with; thresholds are looked up in the current
+// settings by cfg.Name.
+type interfaceMonitor struct {
+	cfg           config.InterfaceConfig
 	interfaceName string
 	handle        *pcap.Handle
 	packetSource  *gopacket.PacketSource
 	aggregator    *analysis.Aggregator
-	resultsChan   <-chan map[string]*analysis.TrafficData
-	stopChan      chan struct{}
-	metricsServer *metrics.MetricsServer
+	resultsChan   <-chan *analysis.IntervalResult
+	replay        bool
+	started       time.Time
 }
 
-func NewMonitor(cfg *config.Config) (*Monitor, error) {
-	pktSource, handle, err := capture.StartCapture(cfg.InterfaceName)
+func newSettings(cfg *config.Config) (*settings, error) {
+	notifier, err := notify.New(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("could not set up notifiers: %w", err)
+	}
+
+	geo, err := geoip.Open(cfg.GeoIPCountryDB, cfg.GeoIPASNDB)
+	if err != nil {
+		return nil, err
+	}
+
+	compiledRules, err := rules.Compile(cfg.Rules, cfg.IntervalSeconds, geo)
 	if err != nil {
-		return nil, fmt.Errorf("could not start capture: %w", err)
+		return nil, fmt.Errorf("invalid rules: %w", err)
 	}
 
-	aggCfg := &analysis.ConfigForAggregator{IntervalSeconds: cfg.IntervalSeconds}
-	agg, resultsChan := analysis.NewAggregator(aggCfg, pktSource, log.Default())
+	s := &settings{
+		cfg:        cfg,
+		interfaces: make(map[string]config.InterfaceConfig),
+		notifier:   notifier,
+		rules:      compiledRules,
+		geo:        geo,
+	}
+	// Sockets of the host say nothing about a replayed capture.
+	if cfg.ProcessAttribution && cfg.ReadFile == "" {
+		s.resolver = process.NewResolver(cfg.ProcPath, cfg.DockerSocket)
+	}
+	for _, ifCfg := range cfg.InterfaceConfigs() {
+		if err := capture.ValidateBPFFilter(ifCfg.BPFFilter, int32(ifCfg.SnapshotLen)); err != nil {
+			return nil, fmt.Errorf("interface %s: %w", displayName(ifCfg.Name), err)
+		}
+		s.interfaces[ifCfg.Name] = ifCfg
+	}
+	return s, nil
+}
+
+// CheckConfig runs the checks NewMonitor does before it opens any capture:
+// notifiers, GeoIP databases, rules and BPF filters.
+func CheckConfig(cfg *config.Config) error {
+	_, err := newSettings(cfg)
+	return err
+}
+
+func NewMonitor(cfg *config.Config) (*Monitor, error) {
+	s, err := newSettings(cfg)
+	if err != nil {
+		return nil, err
+	}
 
 	m := &Monitor{
-		cfg:           cfg,
-		interfaceName: cfg.InterfaceName,
-		handle:        handle,
-		packetSource:  pktSource,
-		aggregator:    agg,
-		resultsChan:   resultsChan,
-		stopChan:      make(chan struct{}),
+		settings:  s,
+		stopChan:  make(chan struct{}),
+		live:      newLiveState(),
+		results:   broker.New[intervalResult](),
+		updates:   broker.New[api.Update](),
+		summaries: make(map[string]*trafficSummary),
+		alerts: alert.NewTracker(alert.Policy{
+			ForIntervals: cfg.AlertForIntervals,
+			Cooldown:     cfg.GetAlertCooldown(),
+		}),
 	}
 
-	if cfg.InterfaceName == "" && handle != nil {
-		log.Printf("Monitoring on automatically selected interface. Check logs for name.")
-		m.interfaceName = "Auto-Selected"
-	} else {
-		m.interfaceName = cfg.InterfaceName
+	if cfg.StoragePath != "" {
+		m.history, err = storage.Open(cfg.StoragePath, storageRetention(cfg))
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Recording traffic history to %s", cfg.StoragePath)
+	}
+	m.outbox, err = notify.NewQueue(cfg.NotifyQueuePath, cfg.NotifyMaxAttempts, func() notify.Multi {
+		return m.current().notifier
+	})
+	if err != nil {
+		if m.history != nil {
+			m.history.Close()
+		}
+		return nil, fmt.Errorf("could not open notification queue: %w", err)
+	}
+	if cfg.DNSSnooping || cfg.ReverseDNS {
+		m.hostnames = hostnames.New(hostnames.Options{
+			Snooping:         cfg.DNSSnooping,
+			Reverse:          cfg.ReverseDNS,
+			ReverseCacheSize: cfg.ReverseDNSCacheSize,
+			ReverseRate:      cfg.ReverseDNSRate,
+		})
 	}
 
-	log.Printf("Monitor initialized. Interface: %s, Threshold: %.2f Mbps, Interval: %ds, TopN: %d",
-		m.interfaceName, m.cfg.ThresholdMbps, m.cfg.IntervalSeconds, m.cfg.TopN)
+	for _, ifCfg := range cfg.InterfaceConfigs() {
+		im, err := newInterfaceMonitor(cfg, ifCfg, cfg.GetIntervalDuration(), m.observers())
+		if err != nil {
+			m.stopInterfaces()
+			m.hostnames.Close()
+			m.closeOutbox()
+			if m.history != nil {
+				m.history.Close()
+			}
+			return nil, err
+		}
+		m.interfaces = append(m.interfaces, im)
+
+		log.Printf("Monitor initialized. Interface: %s, Threshold: %.2f Mbps, Interval: %ds, TopN: %d, Filter: '%s', SnapLen: %d, Promiscuous: %t",
+			im.interfaceName, im.cfg.ThresholdMbps, cfg.IntervalSeconds, cfg.TopN, im.cfg.BPFFilter, im.cfg.SnapshotLen, *im.cfg.Promiscuous)
+	}
+	m.warnUnmatchedRules(s)
 
 	if cfg.MetricsEnabled {
 		m.metricsServer = metrics.NewMetricsServer(cfg.MetricsPort)
+	}
+	if cfg.APIEnabled {
+		handler := http.NewServeMux()
+		handler.Handle("/api/", api.NewHandler(m))
+		if cfg.DashboardEnabled {
+			handler.Handle("/", dashboard.Handler())
+		}
+
+		port := cfg.APIPort
+		if port == "" {
+			port = cfg.MetricsPort
+		}
+		if m.metricsServer != nil && port == cfg.MetricsPort {
+			m.metricsServer.Handle("/", handler)
+		} else {
+			m.apiServer = api.NewServer(port, handler)
+			m.apiServer.Start()
+		}
+		log.Printf("JSON API initialized on port %s", port)
+		if cfg.DashboardEnabled {
+			log.Printf("Dashboard available at http://localhost:%s/", port)
+		}
+	} else if cfg.DashboardEnabled {
+		log.Println("Warning: the dashboard needs the JSON API, set api_enabled to use it.")
+	}
+	if m.metricsServer != nil {
 		m.metricsServer.Start()
 		log.Printf("Prometheus metrics endpoint initialized on port %s", cfg.MetricsPort)
 	}
 
-	go func() {
-		err := discord.SendInitNotification(m.cfg.WebhookURL, m.interfaceName, m.cfg.ThresholdMbps, m.cfg.IntervalSeconds)
-		if err != nil {
-			log.Printf("Error sending Discord init notification: %v", err)
-		}
-	}()
+	for _, im := range m.interfaces {
+		m.notify(alert.Event{
+			Kind:            alert.KindInit,
+			Interface:       im.interfaceName,
+			Time:            time.Now(),
+			IntervalSeconds: cfg.IntervalSeconds,
+			ThresholdMbps:   im.cfg.ThresholdMbps,
+		})
+	}
 
 	return m, nil
 }
 
+func storageRetention(cfg *config.Config) storage.Retention {
+	const day = 24 * time.Hour
+	return storage.Retention{
+		Raw:    time.Duration(cfg.StorageRawRetentionHours) * time.Hour,
+		Minute: time.Duration(cfg.StorageMinuteRetentionDays) * day,
+		Hour:   time.Duration(cfg.StorageHourRetentionDays) * day,
+		Day:    time.Duration(cfg.StorageDayRetentionDays) * day,
+	}
+}
+
+// History returns the traffic history store, or nil if history is disabled.
+func (m *Monitor) History() *storage.Store {
+	return m.history
+}
+
+// Snapshots returns the latest interval of every monitored interface, sorted
+// by interface name.
+func (m *Monitor) Snapshots() []api.Snapshot {
+	return m.live.latest()
+}
+
+func (m *Monitor) Recent() []api.Snapshot {
+	return m.live.recent()
+}
+
+func (m *Monitor) RecentAlerts() []alert.Event {
+	return m.live.recentEvents()
+}
+
+// Health reports the state of every capture pipeline. A pipeline is healthy
+// while it keeps delivering intervals.
+func (m *Monitor) Health() []api.CaptureHealth {
+	m.mu.RLock()
+	interfaces := m.interfaces
+	m.mu.RUnlock()
+	interval := m.current().cfg.GetIntervalDuration()
+
+	health := make([]api.CaptureHealth, 0, len(interfaces))
+	for _, im := range interfaces {
+		h := api.CaptureHealth{
+			Interface: im.interfaceName,
+			Mode:      "live",
+			BPFFilter: im.cfg.BPFFilter,
+		}
+		since := im.started
+		if updated, ok := m.live.lastUpdate(im.interfaceName); ok {
+			h.LastUpdate = &updated
+			since = updated
+		}
+		h.Healthy = time.Since(since) <= 2*interval+5*time.Second
+
+		if im.replay {
+			h.Mode = "file"
+		} else if im.handle != nil {
+			stats, err := im.handle.Stats()
+			if err != nil {
+				h.Error = err.Error()
+			} else {
+				h.PacketsReceived = stats.PacketsReceived
+				h.PacketsDropped = stats.PacketsDropped
+				h.PacketsIfDropped = stats.PacketsIfDropped
+			}
+		}
+		health = append(health, h)
+	}
+	return health
+}
+
+// Hostname returns the known hostname of ip, or "".
+func (m *Monitor) Hostname(ip string) string {
+	return m.hostnames.Name(ip)
+}
+
+// observers returns the packet observers every capture pipeline feeds.
+func (m *Monitor) observers() []analysis.PacketObserver {
+	if m.hostnames == nil {
+		return nil
+	}
+	return []analysis.PacketObserver{m.hostnames}
+}
+
+// Subscribe returns a subscription to the update published after every
+// processed interval.
+func (m *Monitor) Subscribe(buffer int) *broker.Subscription[api.Update] {
+	return m.updates.Subscribe(buffer)
+}
+
+func (m *Monitor) ActiveAlerts() []alert.Status {
+	return m.alerts.Active()
+}
+
+// Config returns the configuration in effect.
+func (m *Monitor) Config() *config.Config {
+	return m.current().cfg
+}
+
+// current returns the settings in effect.
+func (m *Monitor) current() *settings {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.settings
+}
+
+func newInterfaceMonitor(cfg *config.Config, ifCfg config.InterfaceConfig, interval time.Duration, observers []analysis.PacketObserver) (*interfaceMonitor, error) {
+	localNetworks, err := analysis.ParseNetworks(ifCfg.LocalNetworks)
+	if err != nil {
+		return nil, fmt.Errorf("invalid local_networks: %w", err)
+	}
+
+	var pktSource *gopacket.PacketSource
+	var handle *pcap.Handle
+	interfaceName := ifCfg.Name
+	if cfg.ReadFile != "" {
+		interfaceName = "file:" + filepath.Base(cfg.ReadFile)
+		pktSource, handle, err = capture.OpenFile(cfg.ReadFile, cfg.ReplaySpeed, ifCfg.BPFFilter)
+	} else {
+		if interfaceName == "" {
+			interfaceName, err = capture.DefaultInterface()
+			if err != nil {
+				return nil, fmt.Errorf("could not start capture: %w", err)
+			}
+			log.Printf("No interface specified, using first valid device found: %s", interfaceName)
+		}
+
+		addrs, addrErr := capture.InterfaceAddresses(interfaceName)
+		if addrErr != nil {
+			log.Printf("Warning: could not determine addresses of %s, rx/tx classification will rely on local_networks only: %v", interfaceName, addrErr)
+		}
+		for _, addr := range addrs {
+			localNetworks = append(localNetworks, analysis.HostNetwork(addr))
+		}
+
+		pktSource, handle, err = capture.StartCapture(interfaceName, capture.Options{
+			SnapshotLen: int32(ifCfg.SnapshotLen),
+			Promiscuous: *ifCfg.Promiscuous,
+			BPFFilter:   ifCfg.BPFFilter,
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not start capture on %s: %w", interfaceName, err)
+	}
+
+	aggCfg := &analysis.ConfigForAggregator{
+		Interval:      interval,
+		UsePacketTime: cfg.ReadFile != "",
+		LocalNetworks: localNetworks,
+
+		FlowIdleTimeout:   time.Duration(cfg.FlowIdleTimeoutSeconds) * time.Second,
+		FlowActiveTimeout: time.Duration(cfg.FlowActiveTimeoutSeconds) * time.Second,
+		MaxFlows:          cfg.FlowMaxEntries,
+		Observers:         observers,
+	}
+	logger := log.New(log.Writer(), fmt.Sprintf("[%s] ", interfaceName), log.Flags())
+	agg, resultsChan := analysis.NewAggregator(aggCfg, pktSource, logger)
+
+	return &interfaceMonitor{
+		cfg:           ifCfg,
+		interfaceName: interfaceName,
+		handle:        handle,
+		packetSource:  pktSource,
+		aggregator:    agg,
+		resultsChan:   resultsChan,
+		replay:        cfg.ReadFile != "",
+		started:       time.Now(),
+	}, nil
+}
+
+func (m *Monitor) warnUnmatchedRules(s *settings) {
+	for _, rule := range s.rules {
+		if rule.Interface == "" {
+			continue
+		}
+		matched := false
+		for _, im := range m.interfaces {
+			if rule.AppliesTo(im.interfaceName) {
+				matched = true
+			}
+		}
+		if !matched {
+			log.Printf("Warning: rule %s is limited to interface %s, which is not being monitored.", rule.Name, rule.Interface)
+		}
+	}
+}
+
+func displayName(interfaceName string) string {
+	if interfaceName == "" {
+		return "(auto-selected)"
+	}
+	return interfaceName
+}
+
+// Run processes intervals until every interface pipeline has finished.
+// Pipelines started by ApplyConfig are waited for as well.
 func (m *Monitor) Run() {
 	log.Printf("Starting monitoring loop...")
 
+	m.mu.Lock()
+	m.consume(m.processIntervalData)
+	m.consume(m.updateTrafficMetrics)
+	if m.history != nil {
+		m.consume(m.recordHistory)
+	}
+	m.consume(m.summarize)
+	for _, im := range m.interfaces {
+		m.startInterface(im)
+	}
+	m.mu.Unlock()
+
+	m.runWG.Wait()
+	m.stopConsumers()
+}
+
+// consume subscribes fn to every interval. Subscribers do not miss
+// intervals: a slow one holds up the pipelines rather than losing data.
+func (m *Monitor) consume(fn func(im *interfaceMonitor, result *analysis.IntervalResult)) {
+	sub := m.results.SubscribeAll(1)
+	m.consumersWG.Add(1)
+	go func() {
+		defer m.consumersWG.Done()
+		for iv := range sub.C {
+			fn(iv.im, iv.result)
+		}
+	}()
+}
+
+// stopConsumers lets the subscribers finish the intervals already published
+// and waits for them.
+func (m *Monitor) stopConsumers() {
+	m.results.Close()
+	m.consumersWG.Wait()
+}
+
+func (m *Monitor) startInterface(im *interfaceMonitor) {
+	m.runWG.Add(1)
+	go func() {
+		defer m.runWG.Done()
+		m.runInterface(im)
+	}()
+}
+
+func (m *Monitor) runInterface(im *interfaceMonitor) {
 	for {
 		select {
-		case intervalData, ok := <-m.resultsChan:
+		case result, ok := <-im.resultsChan:
 			if !ok {
-				log.Println("Aggregator results channel closed. Monitor stopping.")
+				log.Printf("Aggregator results channel for %s closed.", im.interfaceName)
 				return
 			}
 
-			m.processIntervalData(intervalData)
+			m.results.Publish(intervalResult{im: im, result: result})
 
 		case <-m.stopChan:
-			log.Println("Monitor stopping loop.")
+			log.Printf("Monitor stopping loop for %s.", im.interfaceName)
 			return
 		}
 	}
 }
 
-func (m *Monitor) processIntervalData(intervalData map[string]*analysis.TrafficData) {
-	interval := m.cfg.GetIntervalDuration()
-	overallBytes := int64(0)
-	ipSpeeds := make(map[string]float64)
+func (m *Monitor) processIntervalData(im *interfaceMonitor, result *analysis.IntervalResult) {
+	s := m.current()
+	ifCfg, ok := s.interfaces[im.cfg.Name]
+	if !ok {
+		// The interface was removed by a reload and is being shut down.
+		return
+	}
 
-	for ip, data := range intervalData {
-		overallBytes += data.Bytes
-		ipSpeedMbps := analysis.CalculateSpeedMbps(data.Bytes, interval)
-		ipSpeeds[ip] = ipSpeedMbps
+	interval := result.Duration
+	overallBytes := result.TotalBytes()
+	attr := attribute(s.resolver, result.Flows)
+	var talkers []alert.Talker
+	for ip, data := range result.Hosts {
+		if data.Bytes > 0 {
+			talkers = append(talkers, alert.Talker{
+				IP:        ip,
+				SpeedMbps: analysis.CalculateSpeedMbps(data.Bytes, interval),
+				RxMbps:    analysis.CalculateSpeedMbps(data.RxBytes, interval),
+				TxMbps:    analysis.CalculateSpeedMbps(data.TxBytes, interval),
+			})
+		}
 	}
 
 	overallSpeedMbps := analysis.CalculateSpeedMbps(overallBytes, interval)
+	rxSpeedMbps := analysis.CalculateSpeedMbps(result.RxBytes, interval)
+	txSpeedMbps := analysis.CalculateSpeedMbps(result.TxBytes, interval)
+
+	log.Printf("Interval Check [%s]: Start=%s, Duration=%.2fs, Total Bytes=%d, Overall Speed=%.2f Mbps, Rx=%.2f Mbps, Tx=%.2f Mbps, Active Flows=%d",
+		im.interfaceName, result.Start.Format(time.RFC3339), interval.Seconds(), overallBytes, overallSpeedMbps, rxSpeedMbps, txSpeedMbps, len(result.Flows))
+
+	now := result.Start.Add(interval)
+	conditions := []struct {
+		direction string
+		speed     float64
+		threshold float64
+		clear     float64
+	}{
+		{"total", overallSpeedMbps, ifCfg.ThresholdMbps, ifCfg.ClearThresholdMbps},
+		{string(analysis.DirectionRx), rxSpeedMbps, ifCfg.RxThresholdMbps, ifCfg.RxClearThresholdMbps},
+		{string(analysis.DirectionTx), txSpeedMbps, ifCfg.TxThresholdMbps, ifCfg.TxClearThresholdMbps},
+	}
 
-	log.Printf("Interval Check: Duration=%.2fs, Total Bytes=%d, Overall Speed=%.2f Mbps",
-		interval.Seconds(), overallBytes, overallSpeedMbps)
+	var breaches []alert.Breach
+	firing := false
+	for _, c := range conditions {
+		if c.threshold <= 0 {
+			continue
+		}
+		res := m.alerts.Evaluate(alert.Condition{
+			Key:            im.interfaceName + "/" + c.direction,
+			Value:          c.speed,
+			Threshold:      c.threshold,
+			ClearThreshold: c.clear,
+		}, now)
+
+		switch res.Transition {
+		case alert.TransitionPending:
+			log.Printf("Threshold exceeded on %s (%s: %.2f Mbps > %.2f Mbps), pending for %d/%d intervals.",
+				im.interfaceName, c.direction, c.speed, c.threshold, res.Status.Consecutive, s.cfg.AlertForIntervals)
+		case alert.TransitionFiring, alert.TransitionRenotify:
+			if res.Notify {
+				breaches = append(breaches, alert.Breach{Direction: c.direction, SpeedMbps: c.speed, ThresholdMbps: c.threshold})
+			} else {
+				log.Printf("Alert %s is firing, notification suppressed by cooldown.", res.Status.Key)
+			}
+		case alert.TransitionResolved:
+			m.notifyResolved(s, im, alert.KindThresholdExceeded, c.direction, res, now)
+			continue
+		}
+		if res.Status.State == alert.StateFiring {
+			firing = true
+		}
+	}
 
-	if m.cfg.MetricsEnabled {
-		metrics.UpdateNetworkSpeed(m.interfaceName, overallSpeedMbps)
-		metrics.UpdateNetworkTraffic(m.interfaceName, overallBytes)
-		metrics.UpdateTopTalkers(m.interfaceName, ipSpeeds)
+	lowSpeed := false
+	if ifCfg.MinThresholdMbps > 0 {
+		lowSpeed = m.evaluateLowTraffic(s, im, alert.KindBelowThreshold, alert.Condition{
+			Key:       im.interfaceName + "/below",
+			Value:     overallSpeedMbps,
+			Threshold: ifCfg.MinThresholdMbps,
+			Below:     true,
+		}, result, overallSpeedMbps, rxSpeedMbps, txSpeedMbps)
+	}
 
-		thresholdExceeded := overallSpeedMbps > m.cfg.ThresholdMbps
-		metrics.UpdateThresholdStatus(thresholdExceeded)
+	silent := false
+	if ifCfg.NoTrafficIntervals > 0 {
+		silent = m.evaluateLowTraffic(s, im, alert.KindNoTraffic, alert.Condition{
+			Key:          im.interfaceName + "/no_traffic",
+			Value:        float64(result.Packets),
+			Threshold:    1,
+			Below:        true,
+			ForIntervals: ifCfg.NoTrafficIntervals,
+		}, result, overallSpeedMbps, rxSpeedMbps, txSpeedMbps)
 	}
 
-	if overallSpeedMbps > m.cfg.ThresholdMbps {
-		m.notifyThresholdExceeded(overallSpeedMbps, ipSpeeds)
+	countries, asns := s.geo.Aggregate(result.Flows)
+
+	// Traffic metrics are kept by updateTrafficMetrics; the ones that need
+	// attribution, GeoIP or alert state are kept here.
+	if s.cfg.MetricsEnabled {
+		var processSpeeds map[string]float64
+		if s.cfg.ProcessMetrics {
+			processSpeeds = attr.speeds(interval)
+		}
+		metrics.UpdateProcessSpeeds(im.interfaceName, processSpeeds)
+		if s.cfg.GeoIPMetrics {
+			for _, c := range countries {
+				metrics.UpdateCountryTraffic(im.interfaceName, c.Country, c.Bytes, c.RxBytes, c.TxBytes, now)
+			}
+			for _, a := range asns {
+				metrics.UpdateASNTraffic(im.interfaceName, a.ASN, a.Organization, a.Bytes, a.RxBytes, a.TxBytes, now)
+			}
+			metrics.ExpireGeoTraffic(im.interfaceName, now)
+		}
+
+		metrics.UpdateThresholdStatus(im.interfaceName, firing)
+		metrics.UpdateBelowThresholdStatus(im.interfaceName, lowSpeed)
+		metrics.UpdateNoTrafficStatus(im.interfaceName, silent)
+	}
+
+	for _, rule := range s.rules {
+		if rule.AppliesTo(im.interfaceName) {
+			m.evaluateRule(s, im, rule, result, attr)
+		}
+	}
+
+	talkers = topTalkers(talkers, s.cfg.TopN)
+	for i := range talkers {
+		talkers[i].Hostname = m.hostnames.Name(talkers[i].IP)
+		talkers[i].Processes = attr.processes(talkers[i].IP)
+		info := s.geo.Lookup(talkers[i].IP)
+		talkers[i].Country, talkers[i].ASN, talkers[i].ASOrganization = info.Country, info.ASN, info.Organization
+	}
+	flows := m.topFlows(s, result.Flows, interval, attr)
+	snapshot := api.Snapshot{
+		Interface:       im.interfaceName,
+		Start:           result.Start,
+		DurationSeconds: interval.Seconds(),
+		TotalBytes:      overallBytes,
+		RxBytes:         result.RxBytes,
+		TxBytes:         result.TxBytes,
+		Packets:         result.Packets,
+		SpeedMbps:       overallSpeedMbps,
+		RxMbps:          rxSpeedMbps,
+		TxMbps:          txSpeedMbps,
+		ActiveFlows:     len(result.Flows),
+		TopTalkers:      talkers,
+		TopFlows:        flows,
+		Countries:       countries,
+		ASNs:            asns,
+	}
+	m.live.record(snapshot, time.Now())
+	m.updates.Publish(api.Update{
+		Snapshot: snapshot,
+		Alerts:   api.AlertsFor(m.alerts.Active(), im.interfaceName),
+	})
+
+	if len(breaches) > 0 {
+		m.notifyThresholdExceeded(alert.Event{
+			Kind:            alert.KindThresholdExceeded,
+			Interface:       im.interfaceName,
+			Time:            now,
+			IntervalSeconds: int(interval.Seconds()),
+			ThresholdMbps:   ifCfg.ThresholdMbps,
+			SpeedMbps:       overallSpeedMbps,
+			RxMbps:          rxSpeedMbps,
+			TxMbps:          txSpeedMbps,
+			Breaches:        breaches,
+			TopTalkers:      talkers,
+			TopFlows:        flows,
+		})
 	}
 }
 
-func (m *Monitor) notifyThresholdExceeded(currentSpeedMbps float64, ipSpeeds map[string]float64) {
-	log.Printf("ALERT: Network speed threshold exceeded! Current: %.2f Mbps, Threshold: %.2f Mbps",
-		currentSpeedMbps, m.cfg.ThresholdMbps)
+// updateTrafficMetrics exports the interval's rates, byte and packet counts
+// and per-host speeds.
+func (m *Monitor) updateTrafficMetrics(im *interfaceMonitor, result *analysis.IntervalResult) {
+	s := m.current()
+	if _, ok := s.interfaces[im.cfg.Name]; !ok || !s.cfg.MetricsEnabled {
+		return
+	}
+
+	interval := result.Duration
+	ipSpeeds := make(map[string]float64)
+	rxSpeeds := make(map[string]float64)
+	txSpeeds := make(map[string]float64)
+	for ip, data := range result.Hosts {
+		if data.Bytes > 0 {
+			ipSpeeds[ip] = analysis.CalculateSpeedMbps(data.Bytes, interval)
+		}
+		if data.RxBytes > 0 {
+			rxSpeeds[ip] = analysis.CalculateSpeedMbps(data.RxBytes, interval)
+		}
+		if data.TxBytes > 0 {
+			txSpeeds[ip] = analysis.CalculateSpeedMbps(data.TxBytes, interval)
+		}
+	}
+
+	metrics.UpdateNetworkSpeed(im.interfaceName, "total", analysis.CalculateSpeedMbps(result.TotalBytes(), interval))
+	metrics.UpdateNetworkSpeed(im.interfaceName, string(analysis.DirectionRx), analysis.CalculateSpeedMbps(result.RxBytes, interval))
+	metrics.UpdateNetworkSpeed(im.interfaceName, string(analysis.DirectionTx), analysis.CalculateSpeedMbps(result.TxBytes, interval))
+	metrics.UpdateNetworkTraffic(im.interfaceName, "total", result.TotalBytes())
+	metrics.UpdateNetworkTraffic(im.interfaceName, string(analysis.DirectionRx), result.RxBytes)
+	metrics.UpdateNetworkTraffic(im.interfaceName, string(analysis.DirectionTx), result.TxBytes)
+	metrics.UpdateTopTalkers(im.interfaceName, ipSpeeds)
+	metrics.UpdateHostSpeeds(im.interfaceName, string(analysis.DirectionRx), rxSpeeds)
+	metrics.UpdateHostSpeeds(im.interfaceName, string(analysis.DirectionTx), txSpeeds)
+	var hostInfo map[string]string
+	if s.cfg.HostnameMetrics {
+		hostInfo = m.knownHostnames(ipSpeeds)
+	}
+	metrics.UpdateHostInfo(im.interfaceName, hostInfo)
+	metrics.UpdatePackets(im.interfaceName, result.Packets)
+}
 
-	if m.cfg.WebhookURL == "" {
+func (m *Monitor) recordHistory(im *interfaceMonitor, result *analysis.IntervalResult) {
+	if _, ok := m.current().interfaces[im.cfg.Name]; !ok {
 		return
 	}
+	sample := storage.Sample{
+		Interface: im.interfaceName,
+		Start:     result.Start,
+		Duration:  result.Duration,
+		RxBytes:   result.RxBytes,
+		TxBytes:   result.TxBytes,
+		Hosts:     make(map[string]storage.HostBytes, len(result.Hosts)),
+	}
+	for ip, data := range result.Hosts {
+		sample.Hosts[ip] = storage.HostBytes{Bytes: data.Bytes, RxBytes: data.RxBytes, TxBytes: data.TxBytes}
+	}
+	if err := m.history.Write(sample); err != nil {
+		log.Printf("Error recording traffic history for %s: %v", im.interfaceName, err)
+	}
+}
 
-	type ipSpeedPair struct {
-		IP    string
-		Speed float64
+// knownHostnames returns the hostnames already known for the hosts, without
+// triggering reverse lookups for all of them.
+func (m *Monitor) knownHostnames(hosts map[string]float64) map[string]string {
+	names := make(map[string]string)
+	for ip := range hosts {
+		if name := m.hostnames.Cached(ip); name != "" {
+			names[ip] = name
+		}
 	}
-	var sortedTalkers []ipSpeedPair
-	for ip, speed := range ipSpeeds {
-		sortedTalkers = append(sortedTalkers, ipSpeedPair{IP: ip, Speed: speed})
+	return names
+}
+
+func (m *Monitor) topFlows(s *settings, flows []analysis.FlowRecord, interval time.Duration, attr *attribution) []alert.Flow {
+	var topFlows []alert.Flow
+	for _, flow := range analysis.TopFlows(flows, s.cfg.TopN) {
+		f := alert.Flow{
+			Description: flow.Key.String(),
+			SpeedMbps:   analysis.CalculateSpeedMbps(flow.Bytes, interval),
+			SrcIP:       flow.Key.SrcIP,
+			DstIP:       flow.Key.DstIP,
+			ServerName:  flow.ServerName,
+			Process:     attr.flow(flow.Key),
+		}
+		// Flows between local hosts have no remote end; transit flows get
+		// the first end the databases know.
+		for _, ip := range geoip.RemoteIPs(flow) {
+			if info := s.geo.Lookup(ip); info != (geoip.Info{}) {
+				f.Country, f.ASN, f.ASOrganization = info.Country, info.ASN, info.Organization
+				break
+			}
+		}
+		// The name the client asked for is more specific than a snooped or
+		// reverse name for a shared server address.
+		if flow.ServerName != "" && flow.ServerIP == flow.Key.SrcIP {
+			f.SrcHost = flow.ServerName
+		} else {
+			f.SrcHost = m.hostnames.Name(flow.Key.SrcIP)
+		}
+		if flow.ServerName != "" && flow.ServerIP == flow.Key.DstIP {
+			f.DstHost = flow.ServerName
+		} else {
+			f.DstHost = m.hostnames.Name(flow.Key.DstIP)
+		}
+		topFlows = append(topFlows, f)
 	}
-	sort.Slice(sortedTalkers, func(i, j int) bool {
-		return sortedTalkers[i].Speed > sortedTalkers[j].Speed
-	})
+	return topFlows
+}
 
-	topN := m.cfg.TopN
-	if len(sortedTalkers) < topN {
-		topN = len(sortedTalkers)
+// evaluateRule checks a configured rule against the flows of the interval.
+// Every rule is tracked and notified separately.
+func (m *Monitor) evaluateRule(s *settings, im *interfaceMonitor, rule *rules.Rule, result *analysis.IntervalResult, attr *attribution) {
+	now := result.Start.Add(result.Duration)
+	value, matched := rule.Evaluate(result)
+	res := m.alerts.Evaluate(alert.Condition{
+		Key:          im.interfaceName + "/rule/" + rule.Name,
+		Value:        value,
+		Threshold:    rule.Threshold,
+		Below:        rule.Below(),
+		ForIntervals: rule.ForIntervals,
+	}, now)
+
+	breach := &alert.RuleBreach{
+		Name:       rule.Name,
+		Match:      rule.Describe(),
+		Metric:     rule.Metric,
+		Comparison: rule.Comparison,
+		Value:      value,
+		Threshold:  rule.Threshold,
+		Peak:       res.Status.PeakValue,
 	}
 
-	topTalkersMap := make(map[string]float64)
-	for i := 0; i < topN; i++ {
-		topTalkersMap[sortedTalkers[i].IP] = sortedTalkers[i].Speed
+	firing := res.Status.State == alert.StateFiring
+	switch res.Transition {
+	case alert.TransitionFiring, alert.TransitionRenotify:
+		log.Printf("ALERT: Rule %s triggered on %s! Match: %s, Current: %.2f %s, Threshold: %s %.2f",
+			rule.Name, im.interfaceName, breach.Match, value, rule.Metric, rule.Comparison, rule.Threshold)
+		if !res.Notify {
+			log.Printf("Alert %s is firing, notification suppressed by cooldown.", res.Status.Key)
+			break
+		}
+		m.notify(alert.Event{
+			Kind:            alert.KindRule,
+			Interface:       im.interfaceName,
+			Time:            now,
+			IntervalSeconds: int(result.Duration.Seconds()),
+			Duration:        now.Sub(res.Status.Since) + result.Duration,
+			TopFlows:        m.topFlows(s, matched, result.Duration, attr),
+			Rule:            breach,
+		})
+
+	case alert.TransitionResolved:
+		firing = false
+		duration := now.Sub(res.Status.Since)
+		log.Printf("RESOLVED: Rule %s on %s. Current: %.2f %s, Peak: %.2f %s, Duration: %s",
+			rule.Name, im.interfaceName, value, rule.Metric, breach.Peak, rule.Metric, duration)
+		if res.Notify {
+			m.notify(alert.Event{
+				Kind:            alert.KindResolved,
+				ResolvedKind:    alert.KindRule,
+				Interface:       im.interfaceName,
+				Time:            now,
+				IntervalSeconds: int(result.Duration.Seconds()),
+				Duration:        duration,
+				Rule:            breach,
+			})
+		}
 	}
 
-	go func() {
-		err := discord.SendDiscordNotification(m.cfg.WebhookURL, topTalkersMap, m.cfg.ThresholdMbps, m.cfg.IntervalSeconds)
-		if err != nil {
-			log.Printf("Error sending Discord threshold notification: %v", err)
+	if s.cfg.MetricsEnabled {
+		metrics.UpdateRuleStatus(im.interfaceName, rule.Name, value, firing)
+	}
+}
+
+// topTalkers sorts talkers by speed and keeps the first n.
+func topTalkers(talkers []alert.Talker, n int) []alert.Talker {
+	sort.Slice(talkers, func(i, j int) bool {
+		return talkers[i].SpeedMbps > talkers[j].SpeedMbps
+	})
+	if len(talkers) > n {
+		talkers = talkers[:n]
+	}
+	return talkers
+}
+
+func (m *Monitor) notifyThresholdExceeded(event alert.Event) {
+	for _, breach := range event.Breaches {
+		log.Printf("ALERT: Network speed threshold exceeded on %s! Direction: %s, Current: %.2f Mbps, Threshold: %.2f Mbps",
+			event.Interface, breach.Direction, breach.SpeedMbps, breach.ThresholdMbps)
+	}
+
+	m.notify(event)
+}
+
+// evaluateLowTraffic runs a minimum-speed or no-traffic rule for the interval
+// and reports whether it is firing. Unlike threshold breaches, each of these
+// alerts is notified on its own.
+func (m *Monitor) evaluateLowTraffic(s *settings, im *interfaceMonitor, kind alert.Kind, c alert.Condition, result *analysis.IntervalResult, speed, rx, tx float64) bool {
+	now := result.Start.Add(result.Duration)
+	res := m.alerts.Evaluate(c, now)
+
+	switch res.Transition {
+	case alert.TransitionFiring, alert.TransitionRenotify:
+		duration := now.Sub(res.Status.Since) + result.Duration
+		if kind == alert.KindNoTraffic {
+			log.Printf("ALERT: No packets seen on %s for %s.", im.interfaceName, duration)
+		} else {
+			log.Printf("ALERT: Network speed below minimum on %s! Current: %.2f Mbps, Minimum: %.2f Mbps, Duration: %s",
+				im.interfaceName, speed, c.Threshold, duration)
 		}
-	}()
+		if !res.Notify {
+			log.Printf("Alert %s is firing, notification suppressed by cooldown.", res.Status.Key)
+			break
+		}
+
+		event := alert.Event{
+			Kind:            kind,
+			Interface:       im.interfaceName,
+			Time:            now,
+			IntervalSeconds: int(result.Duration.Seconds()),
+			SpeedMbps:       speed,
+			RxMbps:          rx,
+			TxMbps:          tx,
+			Duration:        duration,
+		}
+		if kind == alert.KindBelowThreshold {
+			event.ThresholdMbps = c.Threshold
+			event.PeakMbps = res.Status.PeakValue
+			event.Breaches = []alert.Breach{{Direction: "total", SpeedMbps: speed, ThresholdMbps: c.Threshold}}
+		}
+		m.notify(event)
+
+	case alert.TransitionResolved:
+		m.notifyResolved(s, im, kind, "total", res, now)
+		return false
+	}
+
+	return res.Status.State == alert.StateFiring
+}
+
+func (m *Monitor) notifyResolved(s *settings, im *interfaceMonitor, kind alert.Kind, direction string, res alert.Result, now time.Time) {
+	status := res.Status
+	duration := now.Sub(status.Since)
+	switch kind {
+	case alert.KindNoTraffic:
+		log.Printf("RESOLVED: Traffic resumed on %s after %s without packets.", im.interfaceName, duration)
+	case alert.KindBelowThreshold:
+		log.Printf("RESOLVED: Network speed back above minimum on %s. Current: %.2f Mbps, Lowest: %.2f Mbps, Duration: %s",
+			im.interfaceName, status.LastValue, status.PeakValue, duration)
+	default:
+		log.Printf("RESOLVED: Network speed back below threshold on %s. Direction: %s, Current: %.2f Mbps, Peak: %.2f Mbps, Duration: %s",
+			im.interfaceName, direction, status.LastValue, status.PeakValue, duration)
+	}
+
+	// The episode never notified (cooldown), so there is nothing to resolve.
+	if !res.Notify {
+		return
+	}
+	event := alert.Event{
+		Kind:            alert.KindResolved,
+		ResolvedKind:    kind,
+		Interface:       im.interfaceName,
+		Time:            now,
+		IntervalSeconds: s.cfg.IntervalSeconds,
+		Duration:        duration,
+	}
+	if kind != alert.KindNoTraffic {
+		event.ThresholdMbps = status.Threshold
+		event.Breaches = []alert.Breach{{Direction: direction, SpeedMbps: status.LastValue, ThresholdMbps: status.Threshold}}
+		event.PeakMbps = status.PeakValue
+	}
+	m.notify(event)
+}
+
+// notify queues the event for every configured notifier. The outbox sends
+// it in the background and retries failed deliveries.
+func (m *Monitor) notify(event alert.Event) {
+	if event.Kind != alert.KindInit && event.Kind != alert.KindSummary {
+		m.live.addEvent(event)
+	}
+	m.outbox.Enqueue(event)
+}
+
+// closeOutbox sends what is still queued until the drain timeout.
+func (m *Monitor) closeOutbox() {
+	ctx, cancel := context.WithTimeout(context.Background(), m.current().cfg.GetNotifyDrainTimeout())
+	defer cancel()
+	m.outbox.Close(ctx)
+}
+
+func (m *Monitor) stopInterfaces() {
+	for _, im := range m.interfaces {
+		im.aggregator.Stop()
+	}
 }
 
 func (m *Monitor) Close() {
@@ -163,13 +974,34 @@ func (m *Monitor) Close() {
 
 	close(m.stopChan)
 
-	if m.aggregator != nil {
-		m.aggregator.Stop()
-	}
+	m.mu.Lock()
+	m.stopInterfaces()
+	m.mu.Unlock()
+
+	// Intervals may still be being processed; they use the outbox and the
+	// history closed below.
+	m.runWG.Wait()
+	m.stopConsumers()
+	m.flushSummaries()
+
+	// Ends open streams so the HTTP servers can shut down.
+	m.updates.Close()
 
 	if m.metricsServer != nil {
 		m.metricsServer.Stop()
 	}
+	if m.apiServer != nil {
+		m.apiServer.Stop()
+	}
+
+	m.closeOutbox()
+	m.hostnames.Close()
+
+	if m.history != nil {
+		if err := m.history.Close(); err != nil {
+			log.Printf("Error closing traffic history: %v", err)
+		}
+	}
 
 	log.Println("Monitor closed.")
 }
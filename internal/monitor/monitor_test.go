@@ -0,0 +1,149 @@
+package monitor
+
+import (
+	"context"
+	"network-monitor/internal/alert"
+	"network-monitor/internal/analysis"
+	"network-monitor/internal/api"
+	"network-monitor/internal/broker"
+	"network-monitor/internal/config"
+	"network-monitor/internal/notify"
+	"network-monitor/internal/storage"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunFansOutIntervals(t *testing.T) {
+	cfg := &config.Config{
+		ThresholdMbps:     100,
+		IntervalSeconds:   60,
+		TopN:              5,
+		SnapshotLen:       1024,
+		AlertForIntervals: 1,
+		Interfaces:        []config.InterfaceConfig{{Name: "eth0"}},
+	}
+	s, err := newSettings(cfg)
+	require.NoError(t, err)
+	history, err := storage.Open(filepath.Join(t.TempDir(), "history.db"), storage.Retention{Raw: time.Hour})
+	require.NoError(t, err)
+	defer history.Close()
+
+	start := time.Now().Add(-time.Minute).Truncate(time.Second)
+	results := make(chan *analysis.IntervalResult, 1)
+	results <- &analysis.IntervalResult{
+		Start:    start,
+		Duration: time.Minute,
+		Hosts:    map[string]*analysis.TrafficData{"10.0.0.1": {Bytes: 600, RxBytes: 600}},
+		RxBytes:  600,
+		Packets:  1,
+	}
+	close(results)
+
+	m := &Monitor{
+		settings:   s,
+		interfaces: []*interfaceMonitor{{cfg: cfg.InterfaceConfigs()[0], interfaceName: "eth0", resultsChan: results}},
+		stopChan:   make(chan struct{}),
+		alerts:     alert.NewTracker(alert.Policy{ForIntervals: 1}),
+		history:    history,
+		results:    broker.New[intervalResult](),
+		live:       newLiveState(),
+		updates:    broker.New[api.Update](),
+	}
+	updates := m.updates.Subscribe(1)
+
+	// Run returns once the pipeline has finished and every subscriber has
+	// handled its intervals.
+	m.Run()
+
+	update := <-updates.C
+	assert.Equal(t, "eth0", update.Snapshot.Interface)
+	assert.Equal(t, int64(600), update.Snapshot.RxBytes)
+
+	samples, err := history.Query(storage.Query{Interface: "eth0", From: start, Resolution: storage.ResolutionRaw})
+	require.NoError(t, err)
+	require.Len(t, samples, 1)
+	assert.Equal(t, int64(600), samples[0].RxBytes)
+	assert.Equal(t, int64(600), samples[0].Hosts["10.0.0.1"].Bytes)
+}
+
+type recordingNotifier struct {
+	mu     sync.Mutex
+	events []alert.Event
+}
+
+func (r *recordingNotifier) Name() string {
+	return "recorder"
+}
+
+func (r *recordingNotifier) Notify(ctx context.Context, event alert.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+	return nil
+}
+
+func TestSummaries(t *testing.T) {
+	cfg := &config.Config{
+		ThresholdMbps:        100,
+		IntervalSeconds:      60,
+		TopN:                 1,
+		SnapshotLen:          1024,
+		AlertForIntervals:    1,
+		SummaryIntervalHours: 1,
+		Interfaces:           []config.InterfaceConfig{{Name: "eth0"}},
+	}
+	s, err := newSettings(cfg)
+	require.NoError(t, err)
+	recorder := &recordingNotifier{}
+	outbox, err := notify.NewQueue("", 1, func() notify.Multi { return notify.Multi{recorder} })
+	require.NoError(t, err)
+
+	m := &Monitor{settings: s, outbox: outbox, live: newLiveState(), summaries: make(map[string]*trafficSummary)}
+	im := &interfaceMonitor{cfg: cfg.InterfaceConfigs()[0], interfaceName: "eth0"}
+	base := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	m.summarize(im, &analysis.IntervalResult{
+		Start:    base.Add(20 * time.Minute),
+		Duration: time.Minute,
+		Hosts:    map[string]*analysis.TrafficData{"10.0.0.1": {Bytes: 600, RxBytes: 600}},
+		RxBytes:  600,
+		Packets:  2,
+	})
+	m.summarize(im, &analysis.IntervalResult{
+		Start:    base.Add(40 * time.Minute),
+		Duration: time.Minute,
+		Hosts:    map[string]*analysis.TrafficData{"10.0.0.2": {Bytes: 6000, TxBytes: 6000}},
+		TxBytes:  6000,
+		Packets:  3,
+	})
+	m.summarize(im, &analysis.IntervalResult{
+		Start:    base.Add(time.Hour),
+		Duration: time.Minute,
+		Hosts:    map[string]*analysis.TrafficData{"10.0.0.1": {Bytes: 60, RxBytes: 60}},
+		RxBytes:  60,
+		Packets:  1,
+	})
+	// The summary of the hour in progress is sent at shutdown.
+	m.flushSummaries()
+	outbox.Close(context.Background())
+
+	require.Len(t, recorder.events, 2)
+	first := recorder.events[0]
+	assert.Equal(t, alert.KindSummary, first.Kind)
+	assert.Equal(t, &alert.Summary{From: base, To: base.Add(time.Hour), TotalBytes: 6600, RxBytes: 600, TxBytes: 6000, Packets: 5}, first.Summary)
+	assert.Equal(t, 2*time.Minute, first.Duration, "only the captured time")
+	assert.InDelta(t, analysis.CalculateSpeedMbps(6000, time.Minute), first.PeakMbps, 1e-9)
+	require.Len(t, first.TopTalkers, 1)
+	assert.Equal(t, "10.0.0.2", first.TopTalkers[0].IP)
+	assert.InDelta(t, analysis.CalculateSpeedMbps(6000, 2*time.Minute), first.TopTalkers[0].SpeedMbps, 1e-9)
+
+	second := recorder.events[1]
+	assert.Equal(t, base.Add(time.Hour), second.Summary.From)
+	assert.Equal(t, base.Add(time.Hour+time.Minute), second.Summary.To, "a flushed summary ends with its last interval")
+	assert.Equal(t, int64(60), second.Summary.TotalBytes)
+	assert.Empty(t, m.RecentAlerts(), "summaries are not alerts")
+}
@@ -0,0 +1,198 @@
+package monitor
+
+import (
+	"fmt"
+	"log"
+	"network-monitor/internal/alert"
+	"network-monitor/internal/config"
+	"network-monitor/internal/metrics"
+	"network-monitor/internal/notify"
+	"network-monitor/internal/rules"
+	"slices"
+)
+
+// ApplyConfig swaps in a new configuration. Thresholds, top_n, alerting,
+// notifiers and rules take effect from the next interval. Capture pipelines
+// are only restarted for interfaces whose capture settings changed. If the
+// new configuration is invalid the running one is left untouched.
+func (m *Monitor) ApplyConfig(cfg *config.Config) error {
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	next, err := newSettings(cfg)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	select {
+	case <-m.stopChan:
+		return fmt.Errorf("monitor is closed")
+	default:
+	}
+
+	prev := m.settings
+	if cfg.MetricsEnabled != prev.cfg.MetricsEnabled || cfg.MetricsPort != prev.cfg.MetricsPort {
+		log.Println("Warning: metrics settings changed, restart the monitor to apply them.")
+	}
+	if cfg.APIEnabled != prev.cfg.APIEnabled || cfg.APIPort != prev.cfg.APIPort || cfg.DashboardEnabled != prev.cfg.DashboardEnabled {
+		log.Println("Warning: API settings changed, restart the monitor to apply them.")
+	}
+	if cfg.DNSSnooping != prev.cfg.DNSSnooping || cfg.ReverseDNS != prev.cfg.ReverseDNS ||
+		cfg.ReverseDNSCacheSize != prev.cfg.ReverseDNSCacheSize || cfg.ReverseDNSRate != prev.cfg.ReverseDNSRate {
+		log.Println("Warning: hostname settings changed, restart the monitor to apply them.")
+	}
+	if cfg.StoragePath != prev.cfg.StoragePath {
+		log.Println("Warning: storage_path changed, restart the monitor to apply it.")
+	}
+	if cfg.NotifyQueuePath != prev.cfg.NotifyQueuePath || cfg.NotifyMaxAttempts != prev.cfg.NotifyMaxAttempts {
+		log.Println("Warning: notification queue settings changed, restart the monitor to apply them.")
+	}
+
+	interfaces, started, stopped, err := m.planInterfaces(prev.cfg, cfg)
+	if err != nil {
+		return err
+	}
+
+	// Unchanged notifiers are kept, with their rate limits.
+	next.notifier = notify.Reuse(next.notifier, prev.notifier)
+	m.settings = next
+	m.interfaces = interfaces
+	m.alerts.SetPolicy(alert.Policy{
+		ForIntervals: cfg.AlertForIntervals,
+		Cooldown:     cfg.GetAlertCooldown(),
+	})
+	m.pruneAlerts(next)
+	if m.history != nil {
+		m.history.SetRetention(storageRetention(cfg))
+	}
+
+	if cfg.MetricsEnabled {
+		for _, rule := range prev.rules {
+			if !slices.ContainsFunc(next.rules, func(r *rules.Rule) bool { return r.Name == rule.Name }) {
+				metrics.DeleteRule(rule.Name)
+			}
+		}
+	}
+
+	// Start replacements before stopping the old pipelines so Run does not
+	// see every pipeline finish in between.
+	for _, im := range started {
+		m.startInterface(im)
+	}
+	for _, im := range stopped {
+		log.Printf("Stopping capture on %s.", im.interfaceName)
+		m.live.remove(im.interfaceName)
+		im.aggregator.Stop()
+		if im.handle != nil {
+			go im.handle.Close()
+		}
+	}
+
+	m.warnUnmatchedRules(next)
+	log.Printf("Configuration reloaded: %d interface(s) monitored, %d capture(s) started, %d stopped.",
+		len(interfaces), len(started), len(stopped))
+	return nil
+}
+
+// planInterfaces works out which pipelines to keep, start and stop for the
+// new configuration. New pipelines are opened here; if any of them fails,
+// the ones already opened are closed again and nothing changes.
+func (m *Monitor) planInterfaces(prev, next *config.Config) (interfaces, started, stopped []*interfaceMonitor, err error) {
+	if prev.ReadFile != "" || next.ReadFile != "" {
+		if next.ReadFile != prev.ReadFile || next.InterfaceName != prev.InterfaceName {
+			return nil, nil, nil, fmt.Errorf("read_file and interface cannot be changed while running")
+		}
+		if captureSettingsChanged(prev, next) || prev.BPFFilter != next.BPFFilter {
+			log.Println("Warning: capture settings cannot be changed while replaying a file, keeping the current pipeline.")
+		}
+		return m.interfaces, nil, nil, nil
+	}
+
+	existing := make(map[string]*interfaceMonitor, len(m.interfaces))
+	for _, im := range m.interfaces {
+		existing[im.cfg.Name] = im
+	}
+
+	for _, ifCfg := range next.InterfaceConfigs() {
+		if im, ok := existing[ifCfg.Name]; ok && !captureSettingsChanged(prev, next) && !interfaceCaptureChanged(im.cfg, ifCfg) {
+			interfaces = append(interfaces, im)
+			delete(existing, ifCfg.Name)
+			continue
+		}
+
+		im, err := newInterfaceMonitor(next, ifCfg, next.GetIntervalDuration(), m.observers())
+		if err != nil {
+			for _, im := range started {
+				im.aggregator.Stop()
+				if im.handle != nil {
+					im.handle.Close()
+				}
+			}
+			return nil, nil, nil, err
+		}
+		log.Printf("Starting capture on %s. Filter: '%s', SnapLen: %d, Promiscuous: %t",
+			im.interfaceName, ifCfg.BPFFilter, ifCfg.SnapshotLen, *ifCfg.Promiscuous)
+		interfaces = append(interfaces, im)
+		started = append(started, im)
+	}
+
+	for _, im := range m.interfaces {
+		if existing[im.cfg.Name] == im {
+			stopped = append(stopped, im)
+		}
+	}
+	return interfaces, started, stopped, nil
+}
+
+// captureSettingsChanged reports whether settings shared by every pipeline
+// changed.
+func captureSettingsChanged(prev, next *config.Config) bool {
+	return prev.IntervalSeconds != next.IntervalSeconds ||
+		prev.FlowIdleTimeoutSeconds != next.FlowIdleTimeoutSeconds ||
+		prev.FlowActiveTimeoutSeconds != next.FlowActiveTimeoutSeconds ||
+		prev.FlowMaxEntries != next.FlowMaxEntries ||
+		prev.ReplaySpeed != next.ReplaySpeed
+}
+
+func interfaceCaptureChanged(prev, next config.InterfaceConfig) bool {
+	return prev.BPFFilter != next.BPFFilter ||
+		prev.SnapshotLen != next.SnapshotLen ||
+		*prev.Promiscuous != *next.Promiscuous ||
+		!slices.Equal(prev.LocalNetworks, next.LocalNetworks)
+}
+
+// pruneAlerts forgets alerts that the new settings can no longer produce, so
+// a removed rule or disabled threshold does not stay firing forever.
+func (m *Monitor) pruneAlerts(s *settings) {
+	keys := make(map[string]bool)
+	for _, im := range m.interfaces {
+		ifCfg := s.interfaces[im.cfg.Name]
+		name := im.interfaceName
+		if ifCfg.ThresholdMbps > 0 {
+			keys[name+"/total"] = true
+		}
+		if ifCfg.RxThresholdMbps > 0 {
+			keys[name+"/rx"] = true
+		}
+		if ifCfg.TxThresholdMbps > 0 {
+			keys[name+"/tx"] = true
+		}
+		if ifCfg.MinThresholdMbps > 0 {
+			keys[name+"/below"] = true
+		}
+		if ifCfg.NoTrafficIntervals > 0 {
+			keys[name+"/no_traffic"] = true
+		}
+		for _, rule := range s.rules {
+			if rule.AppliesTo(name) {
+				keys[name+"/rule/"+rule.Name] = true
+			}
+		}
+	}
+	m.alerts.Retain(func(key string) bool {
+		return keys[key]
+	})
+}
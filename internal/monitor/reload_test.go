@@ -0,0 +1,239 @@
+package monitor
+
+import (
+	"io"
+	"log"
+	"network-monitor/internal/alert"
+	"network-monitor/internal/analysis"
+	"network-monitor/internal/config"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// emptySource is a capture without packets.
+type emptySource struct{}
+
+func (emptySource) ReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	return nil, gopacket.CaptureInfo{}, io.EOF
+}
+
+func testConfig() *config.Config {
+	return &config.Config{
+		ThresholdMbps:            100,
+		IntervalSeconds:          60,
+		TopN:                     5,
+		SnapshotLen:              1024,
+		Promiscuous:              true,
+		FlowIdleTimeoutSeconds:   60,
+		FlowActiveTimeoutSeconds: 1800,
+		FlowMaxEntries:           1000,
+		AlertForIntervals:        1,
+		NotifyMaxAttempts:        1,
+		WebhookURL:               "http://discord.hook",
+		Interfaces: []config.InterfaceConfig{
+			{Name: "eth0"},
+			{Name: "eth1", RxThresholdMbps: 50},
+		},
+	}
+}
+
+// testMonitor returns a monitor running cfg with pipelines that capture
+// nothing, so reloads can be applied without opening interfaces.
+func testMonitor(t *testing.T, cfg *config.Config) *Monitor {
+	s, err := newSettings(cfg)
+	require.NoError(t, err)
+	m := &Monitor{
+		settings: s,
+		stopChan: make(chan struct{}),
+		live:     newLiveState(),
+		alerts:   alert.NewTracker(alert.Policy{ForIntervals: 1}),
+	}
+	for _, ifCfg := range cfg.InterfaceConfigs() {
+		source := gopacket.NewPacketSource(emptySource{}, layers.LinkTypeEthernet)
+		aggregator, results := analysis.NewAggregator(&analysis.ConfigForAggregator{
+			IntervalSeconds: cfg.IntervalSeconds,
+			UsePacketTime:   true,
+		}, source, log.New(io.Discard, "", 0))
+		m.interfaces = append(m.interfaces, &interfaceMonitor{
+			cfg:           ifCfg,
+			interfaceName: ifCfg.Name,
+			aggregator:    aggregator,
+			resultsChan:   results,
+		})
+	}
+	return m
+}
+
+func TestInterfaceCaptureChanged(t *testing.T) {
+	on, off := true, false
+	base := config.InterfaceConfig{Name: "eth0", BPFFilter: "ip", SnapshotLen: 1024, Promiscuous: &on, LocalNetworks: []string{"10.0.0.0/8"}, ThresholdMbps: 100}
+
+	for _, tc := range []struct {
+		name    string
+		change  func(*config.InterfaceConfig)
+		changed bool
+	}{
+		{"nothing", func(*config.InterfaceConfig) {}, false},
+		{"threshold", func(c *config.InterfaceConfig) { c.ThresholdMbps = 200; c.MinThresholdMbps = 1 }, false},
+		{"same promiscuous value", func(c *config.InterfaceConfig) { same := true; c.Promiscuous = &same }, false},
+		{"filter", func(c *config.InterfaceConfig) { c.BPFFilter = "tcp" }, true},
+		{"snapshot length", func(c *config.InterfaceConfig) { c.SnapshotLen = 65535 }, true},
+		{"promiscuous", func(c *config.InterfaceConfig) { c.Promiscuous = &off }, true},
+		{"local networks", func(c *config.InterfaceConfig) { c.LocalNetworks = []string{"192.168.0.0/16"} }, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			next := base
+			tc.change(&next)
+			assert.Equal(t, tc.changed, interfaceCaptureChanged(base, next))
+		})
+	}
+}
+
+func TestCaptureSettingsChanged(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		change  func(*config.Config)
+		changed bool
+	}{
+		{"threshold", func(c *config.Config) { c.ThresholdMbps = 200 }, false},
+		{"notifiers", func(c *config.Config) { c.WebhookURL = "http://other.hook" }, false},
+		{"interval", func(c *config.Config) { c.IntervalSeconds = 30 }, true},
+		{"flow idle timeout", func(c *config.Config) { c.FlowIdleTimeoutSeconds = 10 }, true},
+		{"flow active timeout", func(c *config.Config) { c.FlowActiveTimeoutSeconds = 10 }, true},
+		{"flow table size", func(c *config.Config) { c.FlowMaxEntries = 10 }, true},
+		{"replay speed", func(c *config.Config) { c.ReplaySpeed = 2 }, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			next := testConfig()
+			tc.change(next)
+			assert.Equal(t, tc.changed, captureSettingsChanged(testConfig(), next))
+		})
+	}
+}
+
+func TestPlanInterfaces(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		change  func(*config.Config)
+		kept    []string
+		stopped []string
+		err     string
+	}{
+		{
+			name:   "unchanged",
+			change: func(*config.Config) {},
+			kept:   []string{"eth0", "eth1"},
+		},
+		{
+			name: "thresholds do not restart capture",
+			change: func(c *config.Config) {
+				c.ThresholdMbps = 500
+				c.Interfaces[1].TxThresholdMbps = 10
+			},
+			kept: []string{"eth0", "eth1"},
+		},
+		{
+			name:    "removed interface",
+			change:  func(c *config.Config) { c.Interfaces = c.Interfaces[:1] },
+			kept:    []string{"eth0"},
+			stopped: []string{"eth1"},
+		},
+		{
+			name:    "first interface removed",
+			change:  func(c *config.Config) { c.Interfaces = []config.InterfaceConfig{c.Interfaces[1]} },
+			kept:    []string{"eth1"},
+			stopped: []string{"eth0"},
+		},
+		{
+			name:   "read_file",
+			change: func(c *config.Config) { c.Interfaces = nil; c.ReadFile = "capture.pcap" },
+			err:    "read_file and interface cannot be changed while running",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			m := testMonitor(t, testConfig())
+			next := testConfig()
+			tc.change(next)
+
+			interfaces, started, stopped, err := m.planInterfaces(testConfig(), next)
+			if tc.err != "" {
+				assert.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Empty(t, started)
+			assert.Equal(t, tc.kept, interfaceNames(interfaces))
+			assert.Equal(t, tc.stopped, interfaceNames(stopped))
+			for _, im := range interfaces {
+				assert.Contains(t, m.interfaces, im, "kept pipelines are the running ones")
+			}
+		})
+	}
+}
+
+func interfaceNames(interfaces []*interfaceMonitor) []string {
+	var names []string
+	for _, im := range interfaces {
+		names = append(names, im.interfaceName)
+	}
+	return names
+}
+
+func TestApplyConfigRejectsInvalidConfig(t *testing.T) {
+	cfg := testConfig()
+	m := testMonitor(t, cfg)
+	running, interfaces := m.settings, m.interfaces
+
+	for _, tc := range []struct {
+		name   string
+		change func(*config.Config)
+		err    string
+	}{
+		{"invalid value", func(c *config.Config) { c.TopN = 0 }, "invalid configuration: top_n must be positive"},
+		{"missing GeoIP database", func(c *config.Config) { c.GeoIPCountryDB = filepath.Join(t.TempDir(), "missing.mmdb") }, "missing.mmdb"},
+		{"unknown notifier", func(c *config.Config) { c.Notifiers = []config.NotifierConfig{{Type: "pager"}} }, "is not supported"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			next := testConfig()
+			tc.change(next)
+			assert.ErrorContains(t, m.ApplyConfig(next), tc.err)
+			assert.Same(t, running, m.settings, "the running settings are kept")
+			assert.Equal(t, interfaces, m.interfaces)
+		})
+	}
+}
+
+func TestApplyConfig(t *testing.T) {
+	m := testMonitor(t, testConfig())
+	now := time.Now()
+	for _, key := range []string{"eth0/total", "eth0/rx", "eth1/total", "eth1/rx"} {
+		m.alerts.Evaluate(alert.Condition{Key: key, Value: 10, Threshold: 1}, now)
+	}
+	prevNotifier := m.settings.notifier
+
+	next := testConfig()
+	next.ThresholdMbps = 200
+	next.Interfaces = next.Interfaces[:1]
+	next.Notifiers = []config.NotifierConfig{{Type: config.NotifierSlack, WebhookURL: "http://slack.hook"}}
+	require.NoError(t, m.ApplyConfig(next))
+
+	assert.Same(t, next, m.settings.cfg)
+	assert.Equal(t, 200.0, m.settings.interfaces["eth0"].ThresholdMbps)
+	assert.Equal(t, []string{"eth0"}, interfaceNames(m.interfaces))
+
+	var active []string
+	for _, s := range m.alerts.Active() {
+		active = append(active, s.Key)
+	}
+	assert.Equal(t, []string{"eth0/total"}, active, "alerts of removed interfaces and disabled thresholds are dropped")
+
+	require.Len(t, m.settings.notifier, 2)
+	assert.Same(t, prevNotifier[0], m.settings.notifier[0], "the unchanged Discord notifier keeps its rate limit")
+	assert.Equal(t, "slack-0", m.settings.notifier[1].Name())
+}
@@ -0,0 +1,134 @@
+package monitor
+
+import (
+	"log"
+	"network-monitor/internal/alert"
+	"network-monitor/internal/analysis"
+	"time"
+)
+
+// trafficSummary adds up the intervals of one interface over a summary
+// period. Periods are aligned to multiples of their length in UTC, so daily
+// summaries cover UTC days.
+type trafficSummary struct {
+	from, to time.Time
+	// last is the end of the latest interval added.
+	last     time.Time
+	captured time.Duration
+	total    int64
+	rx, tx   int64
+	packets  int64
+	peakMbps float64
+	hosts    map[string]*analysis.TrafficData
+}
+
+func newTrafficSummary(start time.Time, period time.Duration) *trafficSummary {
+	from := start.Truncate(period)
+	return &trafficSummary{from: from, to: from.Add(period), hosts: make(map[string]*analysis.TrafficData)}
+}
+
+func (t *trafficSummary) add(result *analysis.IntervalResult) {
+	t.last = result.Start.Add(result.Duration)
+	t.captured += result.Duration
+	total := result.TotalBytes()
+	t.total += total
+	t.rx += result.RxBytes
+	t.tx += result.TxBytes
+	t.packets += result.Packets
+	t.peakMbps = max(t.peakMbps, analysis.CalculateSpeedMbps(total, result.Duration))
+	for ip, data := range result.Hosts {
+		host, ok := t.hosts[ip]
+		if !ok {
+			host = &analysis.TrafficData{}
+			t.hosts[ip] = host
+		}
+		host.Bytes += data.Bytes
+		host.RxBytes += data.RxBytes
+		host.TxBytes += data.TxBytes
+	}
+}
+
+// summarize adds the interval to its interface's summary. The summary is
+// sent once an interval starts after its period.
+func (m *Monitor) summarize(im *interfaceMonitor, result *analysis.IntervalResult) {
+	s := m.current()
+	period := s.cfg.GetSummaryInterval()
+	if period <= 0 {
+		delete(m.summaries, im.interfaceName)
+		return
+	}
+	if _, ok := s.interfaces[im.cfg.Name]; !ok {
+		return
+	}
+
+	summary := m.summaries[im.interfaceName]
+	switch {
+	case summary == nil:
+	case !result.Start.Before(summary.to):
+		m.sendSummary(s, im.interfaceName, summary, summary.to)
+		summary = nil
+	case summary.to.Sub(summary.from) != period:
+		// The period was changed by a reload; the summary so far is sent
+		// on its own.
+		m.sendSummary(s, im.interfaceName, summary, summary.last)
+		summary = nil
+	}
+	if summary == nil {
+		summary = newTrafficSummary(result.Start, period)
+		m.summaries[im.interfaceName] = summary
+	}
+	summary.add(result)
+}
+
+// flushSummaries sends the summaries of the periods in progress. Close calls
+// it once no more intervals are processed.
+func (m *Monitor) flushSummaries() {
+	s := m.current()
+	for interfaceName, summary := range m.summaries {
+		m.sendSummary(s, interfaceName, summary, summary.last)
+		delete(m.summaries, interfaceName)
+	}
+}
+
+func (m *Monitor) sendSummary(s *settings, interfaceName string, summary *trafficSummary, to time.Time) {
+	var talkers []alert.Talker
+	for ip, data := range summary.hosts {
+		if data.Bytes > 0 {
+			talkers = append(talkers, alert.Talker{
+				IP:        ip,
+				SpeedMbps: analysis.CalculateSpeedMbps(data.Bytes, summary.captured),
+				RxMbps:    analysis.CalculateSpeedMbps(data.RxBytes, summary.captured),
+				TxMbps:    analysis.CalculateSpeedMbps(data.TxBytes, summary.captured),
+			})
+		}
+	}
+	talkers = topTalkers(talkers, s.cfg.TopN)
+	for i := range talkers {
+		talkers[i].Hostname = m.hostnames.Name(talkers[i].IP)
+		info := s.geo.Lookup(talkers[i].IP)
+		talkers[i].Country, talkers[i].ASN, talkers[i].ASOrganization = info.Country, info.ASN, info.Organization
+	}
+
+	log.Printf("Traffic summary for %s from %s to %s: %d bytes (rx: %d, tx: %d).",
+		interfaceName, summary.from.Format(time.RFC3339), to.Format(time.RFC3339), summary.total, summary.rx, summary.tx)
+	m.notify(alert.Event{
+		Kind:            alert.KindSummary,
+		Interface:       interfaceName,
+		Time:            time.Now(),
+		IntervalSeconds: s.cfg.IntervalSeconds,
+		SpeedMbps:       analysis.CalculateSpeedMbps(summary.total, summary.captured),
+		RxMbps:          analysis.CalculateSpeedMbps(summary.rx, summary.captured),
+		TxMbps:          analysis.CalculateSpeedMbps(summary.tx, summary.captured),
+		TopTalkers:      talkers,
+		Duration:        summary.captured,
+		PeakMbps:        summary.peakMbps,
+		Summary: &alert.Summary{
+			From:       summary.from,
+			To:         to,
+			TotalBytes: summary.total,
+			RxBytes:    summary.rx,
+			TxBytes:    summary.tx,
+			Packets:    summary.packets,
+		},
+	})
+}
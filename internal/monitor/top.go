@@ -0,0 +1,35 @@
+package monitor
+
+import (
+	"context"
+	"io"
+	"log"
+	"network-monitor/internal/config"
+	"network-monitor/internal/top"
+)
+
+// RunTop shows live per-host rates of the first configured interface in the
+// terminal. It runs the regular capture and aggregation pipeline with
+// opts.Refresh as the interval, but without alerting, notifiers, metrics or
+// history.
+func RunTop(ctx context.Context, cfg *config.Config, opts top.Options) error {
+	ifCfg := cfg.InterfaceConfigs()[0]
+
+	// Capture and aggregator logs would draw over the table.
+	prev := log.Writer()
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(prev)
+
+	im, err := newInterfaceMonitor(cfg, ifCfg, opts.Refresh, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		im.aggregator.Stop()
+		if im.handle != nil {
+			im.handle.Close()
+		}
+	}()
+
+	return top.Run(ctx, im.interfaceName, im.resultsChan, opts)
+}
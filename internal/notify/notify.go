@@ -0,0 +1,164 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"network-monitor/internal/alert"
+	"network-monitor/internal/config"
+	"network-monitor/internal/discord"
+	"network-monitor/internal/email"
+	"network-monitor/internal/message"
+	"network-monitor/internal/slack"
+	"network-monitor/internal/teams"
+	"network-monitor/internal/webhook"
+	"reflect"
+	"time"
+)
+
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, event alert.Event) error
+}
+
+// Multi fans an event out to every notifier it holds.
+type Multi []Notifier
+
+func (m Multi) Name() string {
+	return "multi"
+}
+
+func (m Multi) Notify(ctx context.Context, event alert.Event) error {
+	var errs []error
+	for _, n := range m {
+		if err := n.Notify(ctx, event); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", n.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// New builds the notifiers described by the configuration. A top-level
+// webhook_url is treated as an additional Discord notifier.
+func New(cfg *config.Config) (Multi, error) {
+	templates, err := message.Load(cfg.Templates)
+	if err != nil {
+		return nil, err
+	}
+
+	var notifiers Multi
+	if cfg.WebhookURL != "" {
+		nc := config.NotifierConfig{Type: config.NotifierDiscord, WebhookURL: cfg.WebhookURL}
+		notifiers = append(notifiers, &configured{
+			Notifier:  discord.NewNotifier("discord", cfg.WebhookURL, templates),
+			cfg:       nc,
+			templates: templates,
+		})
+	}
+
+	for i, nc := range cfg.Notifiers {
+		name := cfg.NotifierName(i)
+		templates := templates
+		if len(nc.Templates) > 0 {
+			if templates, err = message.Load(cfg.NotifierTemplates(i)); err != nil {
+				return nil, fmt.Errorf("notifier %s: %w", name, err)
+			}
+		}
+		n, err := build(name, nc, templates)
+		if err != nil {
+			return nil, fmt.Errorf("notifier %s: %w", name, err)
+		}
+		notifiers = append(notifiers, &configured{Notifier: n, cfg: nc, templates: templates})
+	}
+	return notifiers, nil
+}
+
+func build(name string, nc config.NotifierConfig, templates *message.Templates) (Notifier, error) {
+	switch nc.Type {
+	case config.NotifierDiscord:
+		return discord.NewNotifier(name, nc.WebhookURL, templates), nil
+	case config.NotifierSlack:
+		return slack.NewNotifier(name, nc.WebhookURL, templates), nil
+	case config.NotifierTeams:
+		return teams.NewNotifier(name, nc.WebhookURL, templates), nil
+	case config.NotifierWebhook:
+		return webhook.NewNotifier(name, webhook.Options{
+			URL:         nc.WebhookURL,
+			Headers:     nc.Headers,
+			BearerToken: nc.BearerToken,
+			Secret:      nc.Secret,
+		}, templates), nil
+	case config.NotifierEmail:
+		recipients := make(map[alert.Severity][]string, len(nc.Recipients))
+		for severity, addrs := range nc.Recipients {
+			recipients[alert.Severity(severity)] = addrs
+		}
+		return email.NewNotifier(name, email.Options{
+			Host:       nc.SMTPHost,
+			Port:       nc.SMTPPort,
+			TLS:        nc.SMTPTLS,
+			Username:   nc.Username,
+			Password:   nc.Password,
+			From:       nc.From,
+			To:         nc.To,
+			Recipients: recipients,
+		}, templates), nil
+	}
+	return nil, fmt.Errorf("unsupported type %q", nc.Type)
+}
+
+// configured is a notifier built by New, with what it was built from.
+type configured struct {
+	Notifier
+	cfg       config.NotifierConfig
+	templates *message.Templates
+}
+
+// Reuse returns next with every notifier that is unchanged from prev, by
+// name, settings and templates, replaced by the one in prev. This keeps
+// their state, such as a Discord rate limit, across a reload.
+func Reuse(next, prev Multi) Multi {
+	old := make(map[string]*configured, len(prev))
+	for _, n := range prev {
+		if c, ok := n.(*configured); ok {
+			old[c.Name()] = c
+		}
+	}
+	reused := make(Multi, len(next))
+	for i, n := range next {
+		reused[i] = n
+		c, ok := n.(*configured)
+		if !ok {
+			continue
+		}
+		if p := old[c.Name()]; p != nil && reflect.DeepEqual(p.cfg, c.cfg) && p.templates.Equal(c.templates) {
+			reused[i] = p
+		}
+	}
+	return reused
+}
+
+// SampleEvent is a made-up threshold alert for testing notifiers. Its
+// addresses are from the documentation ranges.
+func SampleEvent(interfaceName string, thresholdMbps float64, intervalSeconds int, now time.Time) alert.Event {
+	speed := thresholdMbps * 1.5
+	return alert.Event{
+		Kind:            alert.KindThresholdExceeded,
+		Interface:       interfaceName,
+		Time:            now,
+		IntervalSeconds: intervalSeconds,
+		ThresholdMbps:   thresholdMbps,
+		SpeedMbps:       speed,
+		RxMbps:          speed * 0.8,
+		TxMbps:          speed * 0.2,
+		Breaches:        []alert.Breach{{Direction: "total", SpeedMbps: speed, ThresholdMbps: thresholdMbps}},
+		TopTalkers: []alert.Talker{
+			{IP: "192.0.2.10", SpeedMbps: speed * 0.6, RxMbps: speed * 0.55, TxMbps: speed * 0.05},
+			{IP: "198.51.100.7", SpeedMbps: speed * 0.3, RxMbps: speed * 0.2, TxMbps: speed * 0.1, Hostname: "cdn.example.net"},
+		},
+		TopFlows: []alert.Flow{
+			{Description: "203.0.113.5:443 → 192.0.2.10:51234 TCP", SpeedMbps: speed * 0.5,
+				SrcIP: "203.0.113.5", DstIP: "192.0.2.10", SrcHost: "www.example.com", ServerName: "www.example.com"},
+		},
+	}
+}
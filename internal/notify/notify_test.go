@@ -0,0 +1,109 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"network-monitor/internal/alert"
+	"network-monitor/internal/config"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingNotifier struct {
+	name   string
+	err    error
+	events []alert.Event
+}
+
+func (r *recordingNotifier) Name() string {
+	return r.name
+}
+
+func (r *recordingNotifier) Notify(ctx context.Context, event alert.Event) error {
+	r.events = append(r.events, event)
+	return r.err
+}
+
+func TestMultiFansOutToAllNotifiers(t *testing.T) {
+	first := &recordingNotifier{name: "first", err: errors.New("boom")}
+	second := &recordingNotifier{name: "second"}
+
+	err := Multi{first, second}.Notify(context.Background(), alert.Event{Kind: alert.KindInit, Interface: "eth0"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "first: boom")
+
+	require.Len(t, first.events, 1)
+	require.Len(t, second.events, 1, "a failing notifier must not stop delivery to the others")
+	assert.Equal(t, "eth0", second.events[0].Interface)
+}
+
+func TestNewFromConfig(t *testing.T) {
+	notifiers, err := New(&config.Config{
+		WebhookURL: "http://legacy.hook",
+		Notifiers: []config.NotifierConfig{
+			{Type: config.NotifierDiscord, Name: "ops", WebhookURL: "http://ops.hook"},
+			{Type: config.NotifierDiscord, WebhookURL: "http://other.hook"},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, notifiers, 3)
+	assert.Equal(t, "discord", notifiers[0].Name())
+	assert.Equal(t, "ops", notifiers[1].Name())
+	assert.Equal(t, "discord-1", notifiers[2].Name())
+
+	_, err = New(&config.Config{Notifiers: []config.NotifierConfig{{Type: "pager"}}})
+	assert.Error(t, err)
+}
+
+func TestReuseKeepsUnchangedNotifiers(t *testing.T) {
+	dir := t.TempDir()
+	tmpl := filepath.Join(dir, "resolved.tmpl")
+	require.NoError(t, os.WriteFile(tmpl, []byte("cleared"), 0o644))
+
+	cfg := &config.Config{
+		WebhookURL: "http://legacy.hook",
+		Notifiers: []config.NotifierConfig{
+			{Type: config.NotifierDiscord, Name: "ops", WebhookURL: "http://ops.hook"},
+			{Type: config.NotifierSlack, Name: "chat", WebhookURL: "http://chat.hook", Templates: map[string]string{"resolved": tmpl}},
+			{Type: config.NotifierTeams, Name: "teams", WebhookURL: "http://teams.hook"},
+		},
+	}
+	prev, err := New(cfg)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(tmpl, []byte("all clear"), 0o644))
+	changed := *cfg
+	changed.Notifiers = []config.NotifierConfig{
+		cfg.Notifiers[0],
+		cfg.Notifiers[1],
+		{Type: config.NotifierTeams, Name: "teams", WebhookURL: "http://new-teams.hook"},
+		{Type: config.NotifierDiscord, Name: "added", WebhookURL: "http://added.hook"},
+	}
+	next, err := New(&changed)
+	require.NoError(t, err)
+
+	reused := Reuse(next, prev)
+	require.Len(t, reused, 5)
+	assert.Same(t, prev[0], reused[0], "the top-level webhook is unchanged")
+	assert.Same(t, prev[1], reused[1], "ops is unchanged")
+	assert.Same(t, next[2], reused[2], "chat's template file changed")
+	assert.Same(t, next[3], reused[3], "teams' URL changed")
+	assert.Same(t, next[4], reused[4])
+}
+
+func TestSampleEvent(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	event := SampleEvent("eth0", 100, 60, now)
+
+	assert.Equal(t, alert.KindThresholdExceeded, event.Kind)
+	assert.Equal(t, now, event.Time)
+	assert.Greater(t, event.SpeedMbps, event.ThresholdMbps)
+	require.Len(t, event.Breaches, 1)
+	assert.Equal(t, event.SpeedMbps, event.Breaches[0].SpeedMbps)
+	assert.NotEmpty(t, event.TopTalkers)
+}
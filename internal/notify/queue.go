@@ -0,0 +1,369 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"sort"
+	"sync"
+	"time"
+
+	"network-monitor/internal/alert"
+	"network-monitor/internal/metrics"
+)
+
+const (
+	initialBackoff = 2 * time.Second
+	maxBackoff     = 5 * time.Minute
+	// maxAge drops deliveries that have not gone out within a day; the
+	// alert is stale by then.
+	maxAge      = 24 * time.Hour
+	sendTimeout = 30 * time.Second
+)
+
+// delivery is one event waiting to be sent to one notifier.
+type delivery struct {
+	ID       uint64      `json:"id"`
+	Notifier string      `json:"notifier"`
+	Event    alert.Event `json:"event"`
+	Queued   time.Time   `json:"queued"`
+	Attempts int         `json:"attempts"`
+	Next     time.Time   `json:"next"`
+}
+
+// Queue delivers events to notifiers in the background, retrying failures
+// with exponential backoff and jitter. Events for the same notifier go out
+// in order, one at a time; notifiers are sent to concurrently, so a notifier
+// that is down, slow or rate limited holds back only its own deliveries.
+// With a path, pending deliveries are kept in a file and resumed after a
+// restart.
+type Queue struct {
+	// notifiers returns the notifiers currently configured, which change on
+	// reload. Deliveries find theirs by name.
+	notifiers   func() Multi
+	maxAttempts int
+	store       *queueStore
+	now         func() time.Time
+
+	mu      sync.Mutex
+	pending []*delivery
+	nextID  uint64
+	// sending holds the notifiers with an attempt in progress.
+	sending  map[string]bool
+	attempts sync.WaitGroup
+
+	wake    chan struct{}
+	closing chan struct{}
+	done    chan struct{}
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+// NewQueue opens the queue and starts delivering. An empty path keeps the
+// queue in memory only.
+func NewQueue(path string, maxAttempts int, notifiers func() Multi) (*Queue, error) {
+	q := newQueue(maxAttempts, notifiers, time.Now)
+	if path != "" {
+		store, err := openQueueStore(path)
+		if err != nil {
+			return nil, err
+		}
+		pending, err := store.load()
+		if err != nil {
+			store.close()
+			return nil, err
+		}
+		q.store = store
+		q.pending = pending
+		now := q.now()
+		for _, d := range pending {
+			q.nextID = max(q.nextID, d.ID)
+			// Waits from before the restart are not carried over.
+			d.Next = now
+		}
+		if len(pending) > 0 {
+			log.Printf("Resuming %d queued notifications from %s.", len(pending), path)
+		}
+	}
+	q.updateMetrics()
+	go q.run()
+	return q, nil
+}
+
+func newQueue(maxAttempts int, notifiers func() Multi, now func() time.Time) *Queue {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Queue{
+		notifiers:   notifiers,
+		maxAttempts: maxAttempts,
+		now:         now,
+		sending:     make(map[string]bool),
+		wake:        make(chan struct{}, 1),
+		closing:     make(chan struct{}),
+		done:        make(chan struct{}),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+}
+
+// Enqueue queues the event for every notifier currently configured.
+func (q *Queue) Enqueue(event alert.Event) {
+	now := q.now()
+	q.mu.Lock()
+	for _, n := range q.notifiers() {
+		q.nextID++
+		d := &delivery{ID: q.nextID, Notifier: n.Name(), Event: event, Queued: now, Next: now}
+		q.pending = append(q.pending, d)
+		q.save(d)
+	}
+	q.mu.Unlock()
+
+	q.updateMetrics()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Len returns the number of pending deliveries.
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+// Close keeps delivering until the queue is empty or ctx is done. Whatever
+// is left stays in the file for the next start.
+func (q *Queue) Close(ctx context.Context) {
+	close(q.closing)
+	select {
+	case <-q.done:
+	case <-ctx.Done():
+		q.cancel()
+		<-q.done
+	}
+	q.cancel()
+
+	if n := q.Len(); n > 0 {
+		if q.store != nil {
+			log.Printf("%d notifications are still queued and will be retried on the next start.", n)
+		} else {
+			log.Printf("Dropping %d notifications that could not be sent before shutdown.", n)
+		}
+	}
+	if q.store != nil {
+		if err := q.store.close(); err != nil {
+			log.Printf("Error closing notification queue: %v", err)
+		}
+	}
+}
+
+func (q *Queue) run() {
+	defer close(q.done)
+	defer q.attempts.Wait()
+	closing := q.closing
+	for {
+		q.deliverDue()
+		if q.ctx.Err() != nil {
+			return
+		}
+		if closing == nil && q.Len() == 0 {
+			return
+		}
+
+		var timer *time.Timer
+		var due <-chan time.Time
+		if next, ok := q.nextDue(); ok {
+			timer = time.NewTimer(next.Sub(q.now()))
+			due = timer.C
+		}
+		select {
+		case <-q.wake:
+		case <-due:
+		case <-closing:
+			closing = nil
+		case <-q.ctx.Done():
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// deliverDue starts an attempt for the first pending delivery of every
+// notifier if it is due. An attempt that finishes wakes the queue.
+func (q *Queue) deliverDue() {
+	now := q.now()
+	for _, d := range q.heads() {
+		if q.ctx.Err() != nil {
+			return
+		}
+		if d.Next.After(now) {
+			continue
+		}
+
+		q.mu.Lock()
+		q.sending[d.Notifier] = true
+		q.mu.Unlock()
+		q.attempts.Add(1)
+		go func() {
+			defer q.attempts.Done()
+			q.attempt(d)
+
+			q.mu.Lock()
+			delete(q.sending, d.Notifier)
+			q.mu.Unlock()
+			select {
+			case q.wake <- struct{}{}:
+			default:
+			}
+		}()
+	}
+}
+
+// nextDue returns when the next delivery that is not being sent is due.
+func (q *Queue) nextDue() (time.Time, bool) {
+	heads := q.heads()
+	if len(heads) == 0 {
+		return time.Time{}, false
+	}
+	next := heads[0].Next
+	for _, d := range heads[1:] {
+		if d.Next.Before(next) {
+			next = d.Next
+		}
+	}
+	return next, true
+}
+
+// heads returns the first pending delivery of every notifier that is not
+// being sent to. The ones behind it wait for it, whatever their own Next.
+func (q *Queue) heads() []*delivery {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var heads []*delivery
+	seen := make(map[string]bool)
+	for _, d := range q.pending {
+		if !seen[d.Notifier] {
+			seen[d.Notifier] = true
+			if !q.sending[d.Notifier] {
+				heads = append(heads, d)
+			}
+		}
+	}
+	return heads
+}
+
+func (q *Queue) attempt(d *delivery) {
+	if age := q.now().Sub(d.Queued); age >= maxAge {
+		q.fail(d, "it has been queued for "+age.Round(time.Minute).String())
+		return
+	}
+	var notifier Notifier
+	for _, n := range q.notifiers() {
+		if n.Name() == d.Notifier {
+			notifier = n
+			break
+		}
+	}
+	if notifier == nil {
+		q.fail(d, "the notifier is no longer configured")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(q.ctx, sendTimeout)
+	err := notifier.Notify(ctx, d.Event)
+	cancel()
+	if err == nil {
+		q.remove(d)
+		return
+	}
+	if q.ctx.Err() != nil {
+		// Shutting down; the delivery stays queued.
+		return
+	}
+
+	var limited interface{ RetryAfter() time.Duration }
+	var permanent interface{ Permanent() bool }
+	switch {
+	case errors.As(err, &limited) && limited.RetryAfter() > 0:
+		// Rate limits do not count as failed attempts.
+		d.Next = q.now().Add(limited.RetryAfter())
+		log.Printf("Notifier %s is rate limited, retrying %s notification in %s.", d.Notifier, d.Event.Kind, limited.RetryAfter().Round(time.Millisecond))
+	case errors.As(err, &permanent) && permanent.Permanent(), d.Attempts+1 >= q.maxAttempts:
+		q.fail(d, fmt.Sprintf("%v (attempt %d)", err, d.Attempts+1))
+		return
+	default:
+		d.Attempts++
+		wait := backoff(d.Attempts)
+		d.Next = q.now().Add(wait)
+		log.Printf("Error sending %s notification for %s to %s (attempt %d): %v; retrying in %s.",
+			d.Event.Kind, d.Event.Interface, d.Notifier, d.Attempts, err, wait.Round(time.Second))
+	}
+	metrics.AddNotificationRetry(d.Notifier)
+
+	q.mu.Lock()
+	q.save(d)
+	q.mu.Unlock()
+}
+
+// backoff doubles the delay with every attempt up to maxBackoff, and picks a
+// random point in its upper half so that notifiers recovering at the same
+// time are not hit at once.
+func backoff(attempts int) time.Duration {
+	wait := maxBackoff
+	if attempts < 20 {
+		wait = min(initialBackoff<<(attempts-1), maxBackoff)
+	}
+	return wait/2 + rand.N(wait/2)
+}
+
+func (q *Queue) fail(d *delivery, reason string) {
+	log.Printf("Dropping %s notification for %s to %s: %s", d.Event.Kind, d.Event.Interface, d.Notifier, reason)
+	metrics.AddNotificationFailure(d.Notifier)
+	q.remove(d)
+}
+
+func (q *Queue) remove(d *delivery) {
+	q.mu.Lock()
+	for i, p := range q.pending {
+		if p == d {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			break
+		}
+	}
+	if q.store != nil {
+		if err := q.store.delete(d.ID); err != nil {
+			log.Printf("Error removing notification from queue file: %v", err)
+		}
+	}
+	q.mu.Unlock()
+	q.updateMetrics()
+}
+
+// save persists d. It must be called with mu held.
+func (q *Queue) save(d *delivery) {
+	if q.store == nil {
+		return
+	}
+	if err := q.store.put(d); err != nil {
+		log.Printf("Error writing notification to queue file: %v", err)
+	}
+}
+
+func (q *Queue) updateMetrics() {
+	q.mu.Lock()
+	depths := make(map[string]int)
+	for _, d := range q.pending {
+		depths[d.Notifier]++
+	}
+	q.mu.Unlock()
+	metrics.UpdateNotificationQueue(depths)
+}
+
+func sortDeliveries(deliveries []*delivery) {
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].ID < deliveries[j].ID
+	})
+}
@@ -0,0 +1,197 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"network-monitor/internal/alert"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scriptedNotifier returns the queued errors one by one, then succeeds.
+type scriptedNotifier struct {
+	name string
+
+	mu        sync.Mutex
+	errs      []error
+	delivered []alert.Kind
+}
+
+func (s *scriptedNotifier) Name() string {
+	return s.name
+}
+
+func (s *scriptedNotifier) Notify(ctx context.Context, event alert.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.errs) > 0 {
+		err := s.errs[0]
+		s.errs = s.errs[1:]
+		return err
+	}
+	s.delivered = append(s.delivered, event.Kind)
+	return nil
+}
+
+func (s *scriptedNotifier) kinds() []alert.Kind {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]alert.Kind(nil), s.delivered...)
+}
+
+type retryAfterError time.Duration
+
+func (e retryAfterError) Error() string             { return "slow down" }
+func (e retryAfterError) RetryAfter() time.Duration { return time.Duration(e) }
+
+type permanentError struct{}
+
+func (permanentError) Error() string   { return "webhook deleted" }
+func (permanentError) Permanent() bool { return true }
+
+// deliver makes the attempts that are due, waits for them and returns when
+// the next one will be due.
+func deliver(q *Queue) (time.Time, bool) {
+	q.deliverDue()
+	q.attempts.Wait()
+	return q.nextDue()
+}
+
+// blockingNotifier holds every send until it is released or cancelled.
+type blockingNotifier struct {
+	name    string
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingNotifier) Name() string {
+	return b.name
+}
+
+func (b *blockingNotifier) Notify(ctx context.Context, event alert.Event) error {
+	b.started <- struct{}{}
+	select {
+	case <-b.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestQueueRetries(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	flaky := &scriptedNotifier{name: "flaky", errs: []error{errors.New("connection refused"), retryAfterError(time.Minute)}}
+	healthy := &scriptedNotifier{name: "healthy"}
+	q := newQueue(5, func() Multi { return Multi{flaky, healthy} }, func() time.Time { return now })
+
+	q.Enqueue(alert.Event{Kind: alert.KindThresholdExceeded})
+	q.Enqueue(alert.Event{Kind: alert.KindResolved})
+
+	next, ok := deliver(q)
+	require.True(t, ok)
+	assert.Equal(t, []alert.Kind{alert.KindThresholdExceeded}, healthy.kinds())
+	assert.Empty(t, flaky.kinds())
+	assert.Equal(t, now, next, "the healthy notifier's next event is due")
+	assert.Equal(t, 1, q.pending[0].Attempts)
+
+	next, _ = deliver(q)
+	assert.Equal(t, []alert.Kind{alert.KindThresholdExceeded, alert.KindResolved}, healthy.kinds())
+	assert.Equal(t, 2, q.Len(), "later events wait behind the notifier's first one")
+	assert.GreaterOrEqual(t, next, now.Add(initialBackoff/2))
+	assert.Less(t, next, now.Add(initialBackoff))
+
+	now = next
+	next, _ = deliver(q)
+	assert.Equal(t, now.Add(time.Minute), next, "retry_after is honoured")
+	assert.Equal(t, 1, q.pending[0].Attempts, "rate limits are not failed attempts")
+
+	now = next
+	deliver(q)
+	deliver(q)
+	assert.Equal(t, []alert.Kind{alert.KindThresholdExceeded, alert.KindResolved}, flaky.kinds(), "delivered in order")
+	assert.Zero(t, q.Len())
+}
+
+func TestQueueDrops(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	rejected := &scriptedNotifier{name: "rejected", errs: []error{permanentError{}}}
+	down := &scriptedNotifier{name: "down", errs: []error{errors.New("timeout"), errors.New("timeout")}}
+	notifiers := Multi{rejected, down}
+	q := newQueue(2, func() Multi { return notifiers }, func() time.Time { return now })
+
+	q.Enqueue(alert.Event{Kind: alert.KindInit})
+	next, _ := deliver(q)
+	assert.Equal(t, 1, q.Len(), "permanent errors are not retried")
+	now = next
+	_, ok := deliver(q)
+	assert.False(t, ok, "dropped after max attempts")
+
+	q.Enqueue(alert.Event{Kind: alert.KindInit})
+	notifiers = Multi{down}
+	deliver(q)
+	assert.Zero(t, q.Len(), "removed notifiers are dropped")
+	assert.Equal(t, []alert.Kind{alert.KindInit}, down.kinds())
+
+	q.Enqueue(alert.Event{Kind: alert.KindInit})
+	now = now.Add(maxAge)
+	deliver(q)
+	assert.Zero(t, q.Len())
+	assert.Len(t, down.kinds(), 1, "stale deliveries are not sent")
+}
+
+func TestQueueSlowNotifier(t *testing.T) {
+	slow := &blockingNotifier{name: "slow", started: make(chan struct{}, 1), release: make(chan struct{})}
+	fast := &scriptedNotifier{name: "fast"}
+	q, err := NewQueue("", 5, func() Multi { return Multi{slow, fast} })
+	require.NoError(t, err)
+
+	q.Enqueue(alert.Event{Kind: alert.KindThresholdExceeded})
+	<-slow.started
+	q.Enqueue(alert.Event{Kind: alert.KindResolved})
+	assert.Eventually(t, func() bool { return len(fast.kinds()) == 2 }, 5*time.Second, 10*time.Millisecond,
+		"the fast notifier keeps delivering while the slow one is sending")
+	assert.Equal(t, 2, q.Len(), "the slow notifier's events wait for its first one")
+
+	close(slow.release)
+	q.Close(context.Background())
+	assert.Zero(t, q.Len())
+}
+
+func TestBackoff(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{1: initialBackoff, 3: 4 * initialBackoff, 12: maxBackoff, 100: maxBackoff} {
+		wait := backoff(attempts)
+		assert.GreaterOrEqual(t, wait, want/2)
+		assert.Less(t, wait, want)
+	}
+}
+
+func TestQueuePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.db")
+	blocked := &scriptedNotifier{name: "discord", errs: []error{retryAfterError(time.Hour)}}
+	q, err := NewQueue(path, 5, func() Multi { return Multi{blocked} })
+	require.NoError(t, err)
+	q.Enqueue(alert.Event{Kind: alert.KindRule, Interface: "eth0"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	q.Close(ctx)
+	assert.Empty(t, blocked.kinds())
+
+	resumed := &scriptedNotifier{name: "discord"}
+	q, err = NewQueue(path, 5, func() Multi { return Multi{resumed} })
+	require.NoError(t, err)
+	q.Enqueue(alert.Event{Kind: alert.KindResolved, Interface: "eth0"})
+	q.Close(context.Background())
+	assert.Equal(t, []alert.Kind{alert.KindRule, alert.KindResolved}, resumed.kinds(), "the queued event is sent first")
+
+	q, err = NewQueue(path, 5, func() Multi { return nil })
+	require.NoError(t, err)
+	assert.Zero(t, q.Len())
+	q.Close(context.Background())
+}
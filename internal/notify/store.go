@@ -0,0 +1,77 @@
+package notify
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var deliveriesBucket = []byte("deliveries")
+
+// queueStore keeps pending deliveries in a bbolt file, keyed by ID.
+type queueStore struct {
+	db *bolt.DB
+}
+
+func openQueueStore(path string) (*queueStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open notification queue %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(deliveriesBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialise notification queue %s: %w", path, err)
+	}
+	return &queueStore{db: db}, nil
+}
+
+// load returns the stored deliveries in ID order. Entries that cannot be
+// decoded are skipped.
+func (s *queueStore) load() ([]*delivery, error) {
+	var deliveries []*delivery
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(deliveriesBucket).ForEach(func(k, v []byte) error {
+			var d delivery
+			if err := json.Unmarshal(v, &d); err == nil {
+				deliveries = append(deliveries, &d)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read notification queue: %w", err)
+	}
+	sortDeliveries(deliveries)
+	return deliveries, nil
+}
+
+func (s *queueStore) put(d *delivery) error {
+	value, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(deliveriesBucket).Put(deliveryKey(d.ID), value)
+	})
+}
+
+func (s *queueStore) delete(id uint64) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(deliveriesBucket).Delete(deliveryKey(id))
+	})
+}
+
+func (s *queueStore) close() error {
+	return s.db.Close()
+}
+
+func deliveryKey(id uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, id)
+}
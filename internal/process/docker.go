@@ -0,0 +1,66 @@
+package process
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dockerNames resolves container IDs to names through the Docker Engine API
+// and caches the result, including failures.
+type dockerNames struct {
+	client *http.Client
+
+	mu    sync.Mutex
+	names map[string]string
+}
+
+func newDockerNames(socket string) *dockerNames {
+	return &dockerNames{
+		client: &http.Client{
+			Timeout: 2 * time.Second,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+		names: make(map[string]string),
+	}
+}
+
+func (d *dockerNames) lookup(id string) (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if name, ok := d.names[id]; ok {
+		return name, name != ""
+	}
+
+	name := d.fetch(id)
+	d.names[id] = name
+	return name, name != ""
+}
+
+func (d *dockerNames) fetch(id string) string {
+	resp, err := d.client.Get("http://docker/containers/" + id + "/json")
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ""
+	}
+
+	var info struct {
+		Name string `json:"Name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(info.Name, "/")
+}
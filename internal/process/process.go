@@ -0,0 +1,114 @@
+// Package process attributes local sockets to the processes and containers
+// that own them, using the socket tables and file descriptors under /proc.
+package process
+
+import (
+	"fmt"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultProcPath     = "/proc"
+	DefaultDockerSocket = "/var/run/docker.sock"
+
+	// minRefreshAge keeps several interfaces finishing an interval at the
+	// same time from rescanning /proc one after another.
+	minRefreshAge = time.Second
+)
+
+// Process is the owner of a socket. Container is the container name if it
+// could be looked up, otherwise the short container ID.
+type Process struct {
+	PID         int
+	Command     string
+	ContainerID string
+	Container   string
+}
+
+// Name identifies the program without its PID, so that workers of the same
+// service are grouped: "nginx", or "web/nginx" inside a container.
+func (p Process) Name() string {
+	if p.Container != "" {
+		return p.Container + "/" + p.Command
+	}
+	return p.Command
+}
+
+func (p Process) String() string {
+	return fmt.Sprintf("%s (pid %d)", p.Name(), p.PID)
+}
+
+type socketKey struct {
+	protocol string
+	addr     netip.Addr
+	port     uint16
+}
+
+// Resolver looks up the process owning a local address and port. Its view
+// is a snapshot taken by Refresh.
+type Resolver struct {
+	procPath string
+	docker   *dockerNames
+
+	mu        sync.RWMutex
+	refreshed time.Time
+	// sockets is keyed by the exact local address; wildcard holds sockets
+	// bound to an unspecified address with an invalid addr.
+	sockets  map[socketKey]Process
+	wildcard map[socketKey]Process
+}
+
+// NewResolver reads from procPath (normally /proc). Container names are
+// looked up through the Docker API at dockerSocket; an empty path disables
+// the lookup.
+func NewResolver(procPath, dockerSocket string) *Resolver {
+	if procPath == "" {
+		procPath = DefaultProcPath
+	}
+	r := &Resolver{procPath: procPath}
+	if dockerSocket != "" {
+		r.docker = newDockerNames(dockerSocket)
+	}
+	return r
+}
+
+// Refresh rescans the sockets of every process. Processes that cannot be
+// read (usually for lack of privileges) are skipped.
+func (r *Resolver) Refresh(now time.Time) error {
+	r.mu.RLock()
+	fresh := now.Sub(r.refreshed) < minRefreshAge
+	r.mu.RUnlock()
+	if fresh {
+		return nil
+	}
+
+	sockets, wildcard, err := r.scan()
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.sockets, r.wildcard, r.refreshed = sockets, wildcard, now
+	r.mu.Unlock()
+	return nil
+}
+
+// Lookup returns the process with a socket on ip and port. protocol is "TCP"
+// or "UDP". A socket bound to exactly ip wins over one listening on all
+// addresses.
+func (r *Resolver) Lookup(protocol, ip string, port uint16) (Process, bool) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || port == 0 {
+		return Process{}, false
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if p, ok := r.sockets[socketKey{protocol, addr.Unmap(), port}]; ok {
+		return p, true
+	}
+	p, ok := r.wildcard[socketKey{protocol: protocol, port: port}]
+	return p, ok
+}
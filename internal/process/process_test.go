@@ -0,0 +1,185 @@
+package process
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const tcpHeader = "  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n"
+
+type fakeProc struct {
+	t    *testing.T
+	root string
+}
+
+func (f fakeProc) process(pid int, comm, cgroup, netns string, inodes ...int) string {
+	dir := filepath.Join(f.root, strconv.Itoa(pid))
+	require.NoError(f.t, os.MkdirAll(filepath.Join(dir, "fd"), 0755))
+	require.NoError(f.t, os.MkdirAll(filepath.Join(dir, "ns"), 0755))
+	require.NoError(f.t, os.MkdirAll(filepath.Join(dir, "net"), 0755))
+	require.NoError(f.t, os.WriteFile(filepath.Join(dir, "comm"), []byte(comm+"\n"), 0644))
+	require.NoError(f.t, os.WriteFile(filepath.Join(dir, "cgroup"), []byte(cgroup), 0644))
+	require.NoError(f.t, os.Symlink("net:["+netns+"]", filepath.Join(dir, "ns", "net")))
+	require.NoError(f.t, os.Symlink("/dev/null", filepath.Join(dir, "fd", "0")))
+	for i, inode := range inodes {
+		link := "socket:[" + strconv.Itoa(inode) + "]"
+		require.NoError(f.t, os.Symlink(link, filepath.Join(dir, "fd", strconv.Itoa(i+3))))
+	}
+	return dir
+}
+
+func (f fakeProc) table(dir, name, content string) {
+	require.NoError(f.t, os.WriteFile(filepath.Join(dir, "net", name), []byte(tcpHeader+content), 0644))
+}
+
+func TestResolverLookup(t *testing.T) {
+	if runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64" {
+		t.Skip("fixtures are in little-endian byte order")
+	}
+	f := fakeProc{t: t, root: t.TempDir()}
+
+	// Host namespace: sshd listening on all addresses and an established
+	// connection from 192.168.1.10:22.
+	host := f.process(100, "sshd", "0::/system.slice/ssh.service\n", "1", 1001, 1002)
+	f.table(host, "tcp", ""+
+		"   0: 00000000:0016 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1001 1\n"+
+		"   1: 0A01A8C0:0016 0200A8C0:D431 01 00000000:00000000 00:00000000 00000000     0        0 1002 1\n"+
+		"   2: 0A01A8C0:1F90 0200A8C0:D432 06 00000000:00000000 00:00000000 00000000     0        0 0 1\n")
+	f.table(host, "tcp6", "")
+	f.process(101, "sshd", "0::/system.slice/ssh.service\n", "1", 1002)
+
+	// A container with its own namespace, listening on [::]:80.
+	id := "3f4e5a6b7c8d9e0f1a2b3c4d5e6f7a8b9c0d1e2f3a4b5c6d7e8f9a0b1c2d3e4f"
+	web := f.process(200, "nginx", "0::/system.slice/docker-"+id+".scope\n", "2", 2001)
+	f.table(web, "tcp6", "   0: 00000000000000000000000000000000:0050 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 2001 1\n")
+	f.table(web, "udp", "")
+
+	// Processes without sockets or with unreadable fds are ignored.
+	f.process(300, "sleep", "", "1")
+	require.NoError(t, os.MkdirAll(filepath.Join(f.root, "self"), 0755))
+
+	r := NewResolver(f.root, "")
+	require.NoError(t, r.Refresh(time.Now()))
+
+	p, ok := r.Lookup("TCP", "192.168.1.10", 22)
+	require.True(t, ok)
+	assert.Equal(t, Process{PID: 100, Command: "sshd"}, p)
+
+	p, ok = r.Lookup("TCP", "10.0.0.5", 22)
+	require.True(t, ok, "wildcard listener")
+	assert.Equal(t, "sshd", p.Command)
+
+	p, ok = r.Lookup("TCP", "172.17.0.2", 80)
+	require.True(t, ok, "sockets in other network namespaces are found")
+	assert.Equal(t, Process{PID: 200, Command: "nginx", ContainerID: id, Container: id[:12]}, p)
+	assert.Equal(t, "3f4e5a6b7c8d/nginx", p.Name())
+	assert.Equal(t, "3f4e5a6b7c8d/nginx (pid 200)", p.String())
+
+	_, ok = r.Lookup("UDP", "192.168.1.10", 22)
+	assert.False(t, ok, "protocols are kept apart")
+	_, ok = r.Lookup("TCP", "192.168.1.10", 8080)
+	assert.False(t, ok, "TIME_WAIT sockets have no owner")
+	_, ok = r.Lookup("TCP", "not-an-ip", 22)
+	assert.False(t, ok)
+}
+
+func TestResolverAmbiguousPorts(t *testing.T) {
+	f := fakeProc{t: t, root: t.TempDir()}
+	listen := "   0: 00000000:0050 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 %d 1\n"
+	a := f.process(10, "nginx", "", "1", 11)
+	f.table(a, "tcp", fmt.Sprintf(listen, 11))
+	b := f.process(20, "apache2", "", "2", 21)
+	f.table(b, "tcp", fmt.Sprintf(listen, 21))
+
+	r := NewResolver(f.root, "")
+	require.NoError(t, r.Refresh(time.Now()))
+	_, ok := r.Lookup("TCP", "10.0.0.1", 80)
+	assert.False(t, ok, "two programs listen on port 80 in different namespaces")
+}
+
+func TestResolverContainerNames(t *testing.T) {
+	id := "aaaaaaaaaaaabbbbbbbbbbbbccccccccccccddddddddddddeeeeeeeeeeeeffff"
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	requests := 0
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/containers/"+id+"/json" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"Id": id, "Name": "/web"})
+	})}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+
+	f := fakeProc{t: t, root: t.TempDir()}
+	dir := f.process(200, "nginx", "12:memory:/docker/"+id+"\n", "2", 2001)
+	f.table(dir, "tcp", "   0: 00000000:0050 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 2001 1\n")
+
+	r := NewResolver(f.root, socket)
+	require.NoError(t, r.Refresh(time.Now()))
+	p, ok := r.Lookup("TCP", "172.17.0.2", 80)
+	require.True(t, ok)
+	assert.Equal(t, "web", p.Container)
+	assert.Equal(t, "web/nginx", p.Name())
+
+	require.NoError(t, r.Refresh(time.Now().Add(time.Minute)))
+	assert.Equal(t, 1, requests, "names are cached")
+}
+
+func TestResolverOwnSocket(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("needs /proc")
+	}
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	r := NewResolver("", "")
+	require.NoError(t, r.Refresh(time.Now()))
+	p, ok := r.Lookup("TCP", "127.0.0.1", uint16(port))
+	require.True(t, ok)
+	assert.Equal(t, os.Getpid(), p.PID)
+}
+
+func TestParseHexAddr(t *testing.T) {
+	if runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64" {
+		t.Skip("fixtures are in little-endian byte order")
+	}
+	addr, err := parseHexAddr("0100007F")
+	require.NoError(t, err)
+	assert.Equal(t, netip.MustParseAddr("127.0.0.1"), addr)
+
+	addr, err = parseHexAddr("0000000000000000FFFF00000100007F")
+	require.NoError(t, err)
+	assert.Equal(t, netip.MustParseAddr("127.0.0.1"), addr, "v4-mapped addresses are unmapped")
+
+	addr, err = parseHexAddr("B80D0120000000000000000001000000")
+	require.NoError(t, err)
+	assert.Equal(t, netip.MustParseAddr("2001:db8::1"), addr)
+
+	_, err = parseHexAddr("0100")
+	assert.Error(t, err)
+}
+
+func TestContainerID(t *testing.T) {
+	id := "3f4e5a6b7c8d9e0f1a2b3c4d5e6f7a8b9c0d1e2f3a4b5c6d7e8f9a0b1c2d3e4f"
+	assert.Equal(t, id, containerID("0::/system.slice/docker-"+id+".scope\n"))
+	assert.Equal(t, id, containerID("0::/kubepods.slice/kubepods-pod1.slice/cri-containerd-"+id+".scope\n"))
+	assert.Equal(t, "", containerID("0::/user.slice/user-1000.slice/session-2.scope\n"))
+}
@@ -0,0 +1,235 @@
+package process
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var socketTables = []struct {
+	file     string
+	protocol string
+}{
+	{"tcp", "TCP"},
+	{"tcp6", "TCP"},
+	{"udp", "UDP"},
+	{"udp6", "UDP"},
+}
+
+var containerIDPattern = regexp.MustCompile(`[0-9a-f]{64}`)
+
+// scan maps every socket to its owning process. Socket inodes are unique
+// across network namespaces, but the socket tables are per namespace, so
+// the tables are read once through a process in each namespace.
+func (r *Resolver) scan() (map[socketKey]Process, map[socketKey]Process, error) {
+	entries, err := os.ReadDir(r.procPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not read %s: %w", r.procPath, err)
+	}
+
+	owners := make(map[uint64]int)
+	namespaces := make(map[string]int)
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		dir := filepath.Join(r.procPath, entry.Name())
+		fds, err := os.ReadDir(filepath.Join(dir, "fd"))
+		if err != nil {
+			continue
+		}
+
+		hasSockets := false
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(dir, "fd", fd.Name()))
+			if err != nil {
+				continue
+			}
+			if inode, ok := socketInode(link); ok {
+				if _, seen := owners[inode]; !seen {
+					owners[inode] = pid
+				}
+				hasSockets = true
+			}
+		}
+		if !hasSockets {
+			continue
+		}
+
+		ns, err := os.Readlink(filepath.Join(dir, "ns", "net"))
+		if err != nil {
+			ns = "pid:" + entry.Name()
+		}
+		if _, seen := namespaces[ns]; !seen {
+			namespaces[ns] = pid
+		}
+	}
+
+	t := newSocketTable()
+	processes := make(map[int]Process)
+	for _, pid := range namespaces {
+		for _, table := range socketTables {
+			path := filepath.Join(r.procPath, strconv.Itoa(pid), "net", table.file)
+			r.readSocketTable(path, table.protocol, owners, processes, t)
+		}
+	}
+	sockets, wildcard := t.finish()
+	return sockets, wildcard, nil
+}
+
+func (r *Resolver) readSocketTable(path, protocol string, owners map[uint64]int, processes map[int]Process, t *socketTable) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		addr, port, inode, ok := parseSocketLine(scanner.Text())
+		if !ok {
+			continue
+		}
+		pid, ok := owners[inode]
+		if !ok {
+			continue
+		}
+		p, ok := processes[pid]
+		if !ok {
+			p = r.process(pid)
+			processes[pid] = p
+		}
+		t.add(socketKey{protocol, addr, port}, p)
+	}
+}
+
+func (r *Resolver) process(pid int) Process {
+	dir := filepath.Join(r.procPath, strconv.Itoa(pid))
+	p := Process{PID: pid}
+	if comm, err := os.ReadFile(filepath.Join(dir, "comm")); err == nil {
+		p.Command = strings.TrimSpace(string(comm))
+	}
+	if cgroup, err := os.ReadFile(filepath.Join(dir, "cgroup")); err == nil {
+		p.ContainerID = containerID(string(cgroup))
+	}
+	if p.ContainerID != "" {
+		p.Container = p.ContainerID[:12]
+		if r.docker != nil {
+			if name, ok := r.docker.lookup(p.ContainerID); ok {
+				p.Container = name
+			}
+		}
+	}
+	return p
+}
+
+// socketTable collects sockets, dropping keys that are claimed by different
+// programs (e.g. two containers listening on the same port).
+type socketTable struct {
+	sockets, wildcard map[socketKey]Process
+	ambiguous         map[socketKey]bool
+}
+
+func newSocketTable() *socketTable {
+	return &socketTable{
+		sockets:   make(map[socketKey]Process),
+		wildcard:  make(map[socketKey]Process),
+		ambiguous: make(map[socketKey]bool),
+	}
+}
+
+func (t *socketTable) add(key socketKey, p Process) {
+	m := t.sockets
+	if key.addr.IsUnspecified() {
+		m = t.wildcard
+		key.addr = netip.Addr{}
+	}
+	if existing, ok := m[key]; ok {
+		if existing.Name() != p.Name() {
+			t.ambiguous[key] = true
+		}
+		return
+	}
+	m[key] = p
+}
+
+func (t *socketTable) finish() (sockets, wildcard map[socketKey]Process) {
+	for key := range t.ambiguous {
+		delete(t.sockets, key)
+		delete(t.wildcard, key)
+	}
+	return t.sockets, t.wildcard
+}
+
+func socketInode(link string) (uint64, bool) {
+	s, ok := strings.CutPrefix(link, "socket:[")
+	if !ok {
+		return 0, false
+	}
+	inode, err := strconv.ParseUint(strings.TrimSuffix(s, "]"), 10, 64)
+	return inode, err == nil
+}
+
+// parseSocketLine parses a line of /proc/net/{tcp,udp}[6]:
+//
+//	sl  local_address rem_address   st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode
+//	 0: 0100007F:0277 00000000:0000 0A 00000000:00000000 00:00000000 00000000   0       0 21768
+func parseSocketLine(line string) (netip.Addr, uint16, uint64, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 10 {
+		return netip.Addr{}, 0, 0, false
+	}
+	host, portHex, found := strings.Cut(fields[1], ":")
+	if !found {
+		return netip.Addr{}, 0, 0, false
+	}
+	addr, err := parseHexAddr(host)
+	if err != nil {
+		return netip.Addr{}, 0, 0, false
+	}
+	port, err := strconv.ParseUint(portHex, 16, 16)
+	if err != nil {
+		return netip.Addr{}, 0, 0, false
+	}
+	inode, err := strconv.ParseUint(fields[9], 10, 64)
+	if err != nil || inode == 0 {
+		return netip.Addr{}, 0, 0, false
+	}
+	return addr, uint16(port), inode, true
+}
+
+// parseHexAddr decodes an address from the socket tables, which print it as
+// 32-bit words in host byte order.
+func parseHexAddr(s string) (netip.Addr, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	if len(b) != 4 && len(b) != 16 {
+		return netip.Addr{}, fmt.Errorf("unexpected address length %d", len(b))
+	}
+	for i := 0; i < len(b); i += 4 {
+		binary.BigEndian.PutUint32(b[i:], binary.NativeEndian.Uint32(b[i:]))
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr.Unmap(), nil
+}
+
+// containerID extracts a container ID from /proc/<pid>/cgroup. Docker,
+// containerd, CRI-O and Podman all put the 64 character ID in the path.
+func containerID(cgroup string) string {
+	ids := containerIDPattern.FindAllString(cgroup, -1)
+	if len(ids) == 0 {
+		return ""
+	}
+	return ids[len(ids)-1]
+}
@@ -0,0 +1,192 @@
+package rules
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"network-monitor/internal/analysis"
+	"network-monitor/internal/config"
+	"network-monitor/internal/geoip"
+)
+
+// Locator looks up the country and AS of an address; *geoip.DB implements
+// it.
+type Locator interface {
+	Lookup(ip string) geoip.Info
+}
+
+// Rule is a compiled config.RuleConfig.
+type Rule struct {
+	Name         string
+	Interface    string
+	Metric       string
+	Comparison   string
+	Threshold    float64
+	ForIntervals int
+
+	network   *net.IPNet
+	port      uint16
+	protocol  string
+	direction analysis.Direction
+
+	countries        []string
+	excludeCountries []string
+	asns             []uint
+	geo              Locator
+}
+
+// Compile prepares the rules. geo is used by rules that match countries or
+// ASNs and may be nil otherwise.
+func Compile(cfgs []config.RuleConfig, intervalSeconds int, geo Locator) ([]*Rule, error) {
+	rules := make([]*Rule, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		rule := &Rule{
+			Name:         cfg.Name,
+			Interface:    cfg.Interface,
+			Metric:       cfg.Metric,
+			Comparison:   cfg.Comparison,
+			Threshold:    cfg.Threshold,
+			ForIntervals: cfg.ForIntervals(intervalSeconds),
+			port:         uint16(cfg.Match.Port),
+			protocol:     strings.ToUpper(cfg.Match.Protocol),
+			direction:    analysis.Direction(cfg.Match.Direction),
+			asns:         cfg.Match.ASNs,
+			geo:          geo,
+		}
+		for _, code := range cfg.Match.Countries {
+			rule.countries = append(rule.countries, strings.ToUpper(code))
+		}
+		for _, code := range cfg.Match.ExcludeCountries {
+			rule.excludeCountries = append(rule.excludeCountries, strings.ToUpper(code))
+		}
+		if cfg.Match.CIDR != "" {
+			networks, err := analysis.ParseNetworks([]string{cfg.Match.CIDR})
+			if err != nil {
+				return nil, fmt.Errorf("rule %s: %w", cfg.Name, err)
+			}
+			rule.network = networks[0]
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// AppliesTo reports whether the rule should be evaluated on the interface.
+func (r *Rule) AppliesTo(interfaceName string) bool {
+	return r.Interface == "" || r.Interface == interfaceName
+}
+
+// Below reports whether the rule fires when the value drops under the
+// threshold rather than rising above it.
+func (r *Rule) Below() bool {
+	return r.Comparison == "<"
+}
+
+func (r *Rule) Matches(flow analysis.FlowRecord) bool {
+	if r.network != nil && !r.network.Contains(net.ParseIP(flow.Key.SrcIP)) && !r.network.Contains(net.ParseIP(flow.Key.DstIP)) {
+		return false
+	}
+	if r.port != 0 && flow.Key.SrcPort != r.port && flow.Key.DstPort != r.port {
+		return false
+	}
+	if r.protocol != "" && !strings.EqualFold(flow.Key.Protocol, r.protocol) {
+		return false
+	}
+	if r.direction != "" && flow.Direction != r.direction {
+		return false
+	}
+	return r.matchesGeo(flow)
+}
+
+// matchesGeo reports whether a remote end of the flow is in the selected
+// countries and ASes. Ends the databases do not cover never match.
+func (r *Rule) matchesGeo(flow analysis.FlowRecord) bool {
+	byCountry := len(r.countries) > 0 || len(r.excludeCountries) > 0
+	if !byCountry && len(r.asns) == 0 {
+		return true
+	}
+	if r.geo == nil {
+		return false
+	}
+	for _, ip := range geoip.RemoteIPs(flow) {
+		info := r.geo.Lookup(ip)
+		if byCountry {
+			if info.Country == "" || slices.Contains(r.excludeCountries, info.Country) {
+				continue
+			}
+			if len(r.countries) > 0 && !slices.Contains(r.countries, info.Country) {
+				continue
+			}
+		}
+		if len(r.asns) > 0 && !slices.Contains(r.asns, info.ASN) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// Evaluate returns the rule's metric over the flows in the interval that
+// match it, together with those flows.
+func (r *Rule) Evaluate(result *analysis.IntervalResult) (float64, []analysis.FlowRecord) {
+	var matched []analysis.FlowRecord
+	var bytes, packets int64
+	for _, flow := range result.Flows {
+		if !r.Matches(flow) {
+			continue
+		}
+		matched = append(matched, flow)
+		bytes += flow.Bytes
+		packets += flow.Packets
+	}
+
+	switch r.Metric {
+	case config.RuleMetricBytes:
+		return float64(bytes), matched
+	case config.RuleMetricPPS:
+		if result.Duration <= 0 {
+			return 0, matched
+		}
+		return float64(packets) / result.Duration.Seconds(), matched
+	default:
+		return analysis.CalculateSpeedMbps(bytes, result.Duration), matched
+	}
+}
+
+// Describe summarises the match, e.g. "192.168.1.10/32 port 445 TCP rx" or
+// "tx country not US,CA".
+func (r *Rule) Describe() string {
+	var parts []string
+	if r.network != nil {
+		parts = append(parts, r.network.String())
+	}
+	if r.port != 0 {
+		parts = append(parts, "port "+strconv.Itoa(int(r.port)))
+	}
+	if r.protocol != "" {
+		parts = append(parts, r.protocol)
+	}
+	if r.direction != "" {
+		parts = append(parts, string(r.direction))
+	}
+	if len(r.countries) > 0 {
+		parts = append(parts, "country "+strings.Join(r.countries, ","))
+	}
+	if len(r.excludeCountries) > 0 {
+		parts = append(parts, "country not "+strings.Join(r.excludeCountries, ","))
+	}
+	if len(r.asns) > 0 {
+		var asns []string
+		for _, asn := range r.asns {
+			asns = append(asns, "AS"+strconv.FormatUint(uint64(asn), 10))
+		}
+		parts = append(parts, strings.Join(asns, ","))
+	}
+	if len(parts) == 0 {
+		return "all traffic"
+	}
+	return strings.Join(parts, " ")
+}
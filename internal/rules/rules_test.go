@@ -0,0 +1,116 @@
+package rules
+
+import (
+	"testing"
+	"time"
+
+	"network-monitor/internal/analysis"
+	"network-monitor/internal/config"
+	"network-monitor/internal/geoip"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func flow(src, dst string, srcPort, dstPort uint16, protocol string, direction analysis.Direction, bytes, packets int64) analysis.FlowRecord {
+	return analysis.FlowRecord{
+		Key:       analysis.FlowKey{SrcIP: src, DstIP: dst, SrcPort: srcPort, DstPort: dstPort, Protocol: protocol},
+		Direction: direction,
+		Bytes:     bytes,
+		Packets:   packets,
+	}
+}
+
+func TestRuleEvaluate(t *testing.T) {
+	result := &analysis.IntervalResult{
+		Duration: 10 * time.Second,
+		Flows: []analysis.FlowRecord{
+			flow("192.168.1.10", "1.2.3.4", 445, 50000, "TCP", analysis.DirectionTx, 1_000_000, 100),
+			flow("1.2.3.4", "192.168.1.10", 50000, 445, "TCP", analysis.DirectionRx, 250_000, 50),
+			flow("192.168.1.20", "8.8.8.8", 40000, 53, "UDP", analysis.DirectionTx, 5_000, 10),
+		},
+	}
+
+	compiled, err := Compile([]config.RuleConfig{
+		{Name: "nas", Match: config.RuleMatch{CIDR: "192.168.1.10"}, Metric: config.RuleMetricMbps, Comparison: ">", Threshold: 500},
+		{Name: "nas-upload", Match: config.RuleMatch{CIDR: "192.168.1.0/24", Direction: "tx", Protocol: "tcp"}, Metric: config.RuleMetricBytes, Comparison: ">"},
+		{Name: "dns", Match: config.RuleMatch{Port: 53}, Metric: config.RuleMetricPPS, Comparison: ">", ForSeconds: 25},
+	}, 10, nil)
+	require.NoError(t, err)
+	require.Len(t, compiled, 3)
+
+	value, matched := compiled[0].Evaluate(result)
+	assert.InDelta(t, 1.0, value, 1e-9)
+	assert.Len(t, matched, 2)
+	assert.Equal(t, "192.168.1.10/32", compiled[0].Describe())
+
+	value, matched = compiled[1].Evaluate(result)
+	assert.Equal(t, 1_000_000.0, value)
+	assert.Len(t, matched, 1)
+
+	value, matched = compiled[2].Evaluate(result)
+	assert.Equal(t, 1.0, value)
+	assert.Len(t, matched, 1)
+	assert.Equal(t, 3, compiled[2].ForIntervals)
+	assert.Equal(t, "port 53", compiled[2].Describe())
+}
+
+func TestRuleAppliesTo(t *testing.T) {
+	compiled, err := Compile([]config.RuleConfig{
+		{Name: "any", Metric: config.RuleMetricMbps, Comparison: "<"},
+		{Name: "wan", Interface: "wan0", Metric: config.RuleMetricMbps, Comparison: ">"},
+	}, 60, nil)
+	require.NoError(t, err)
+
+	assert.True(t, compiled[0].AppliesTo("eth0"))
+	assert.True(t, compiled[0].Below())
+	assert.Equal(t, "all traffic", compiled[0].Describe())
+	assert.True(t, compiled[1].AppliesTo("wan0"))
+	assert.False(t, compiled[1].AppliesTo("eth0"))
+}
+
+type fakeLocator map[string]geoip.Info
+
+func (f fakeLocator) Lookup(ip string) geoip.Info {
+	return f[ip]
+}
+
+func TestRuleGeo(t *testing.T) {
+	geo := fakeLocator{
+		"1.2.3.4":     {Country: "US", ASN: 15169},
+		"5.6.7.8":     {Country: "DE", ASN: 3320},
+		"203.0.113.9": {Country: "CN", ASN: 4134},
+	}
+	result := &analysis.IntervalResult{
+		Duration: time.Second,
+		Flows: []analysis.FlowRecord{
+			flow("192.168.1.10", "1.2.3.4", 50000, 443, "TCP", analysis.DirectionTx, 1000, 1),
+			flow("192.168.1.10", "5.6.7.8", 50001, 443, "TCP", analysis.DirectionTx, 2000, 1),
+			flow("203.0.113.9", "192.168.1.10", 443, 50002, "TCP", analysis.DirectionRx, 4000, 1),
+			flow("192.168.1.10", "10.9.9.9", 50003, 443, "TCP", analysis.DirectionTx, 8000, 1),
+		},
+	}
+
+	compiled, err := Compile([]config.RuleConfig{
+		{Name: "unexpected", Match: config.RuleMatch{Direction: "tx", ExcludeCountries: []string{"us", "CA"}}, Metric: config.RuleMetricBytes, Comparison: ">"},
+		{Name: "china", Match: config.RuleMatch{Countries: []string{"CN"}}, Metric: config.RuleMetricBytes, Comparison: ">"},
+		{Name: "telekom", Match: config.RuleMatch{ASNs: []uint{3320, 4134}}, Metric: config.RuleMetricBytes, Comparison: ">"},
+	}, 60, geo)
+	require.NoError(t, err)
+
+	value, _ := compiled[0].Evaluate(result)
+	assert.Equal(t, 2000.0, value, "unknown countries are not unexpected")
+	assert.Equal(t, "tx country not US,CA", compiled[0].Describe())
+	value, _ = compiled[1].Evaluate(result)
+	assert.Equal(t, 4000.0, value)
+	value, _ = compiled[2].Evaluate(result)
+	assert.Equal(t, 6000.0, value)
+	assert.Equal(t, "AS3320,AS4134", compiled[2].Describe())
+
+	compiled, err = Compile([]config.RuleConfig{
+		{Name: "china", Match: config.RuleMatch{Countries: []string{"CN"}}, Metric: config.RuleMetricBytes, Comparison: ">"},
+	}, 60, nil)
+	require.NoError(t, err)
+	value, _ = compiled[0].Evaluate(result)
+	assert.Zero(t, value, "nothing matches without a database")
+}
@@ -0,0 +1,154 @@
+// Package slack sends notifications to Slack incoming webhooks as Block Kit
+// messages.
+package slack
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"network-monitor/internal/alert"
+	"network-monitor/internal/message"
+	"network-monitor/internal/webhook"
+	"strings"
+	"time"
+)
+
+// Block Kit limits; longer texts are rejected, so they are cut short.
+const (
+	maxHeaderLen        = 150
+	maxTextLen          = 3000
+	maxFieldLen         = 2000
+	maxFieldsPerSection = 10
+)
+
+type text struct {
+	Type  string `json:"type"`
+	Text  string `json:"text"`
+	Emoji bool   `json:"emoji,omitempty"`
+}
+
+type block struct {
+	Type     string `json:"type"`
+	Text     *text  `json:"text,omitempty"`
+	Fields   []text `json:"fields,omitempty"`
+	Elements []text `json:"elements,omitempty"`
+}
+
+type attachment struct {
+	Color  string  `json:"color"`
+	Blocks []block `json:"blocks"`
+}
+
+type payload struct {
+	// Text is shown in notifications, where blocks are not.
+	Text        string       `json:"text"`
+	Attachments []attachment `json:"attachments"`
+}
+
+type Notifier struct {
+	name       string
+	webhookURL string
+	templates  *message.Templates
+	client     *http.Client
+}
+
+// NewNotifier returns a notifier posting to the Slack incoming webhook at
+// webhookURL. templates may be nil to send the built-in messages.
+func NewNotifier(name, webhookURL string, templates *message.Templates) *Notifier {
+	return &Notifier{
+		name:       name,
+		webhookURL: webhookURL,
+		templates:  templates,
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (n *Notifier) Name() string {
+	return n.name
+}
+
+func (n *Notifier) Notify(ctx context.Context, event alert.Event) error {
+	if n.webhookURL == "" {
+		return fmt.Errorf("webhook URL is empty, skipping notification")
+	}
+
+	msg, err := n.templates.Render(event)
+	if err != nil {
+		return err
+	}
+	if err := webhook.Post(ctx, n.client, "slack", n.webhookURL, newPayload(msg, event.Time)); err != nil {
+		return err
+	}
+
+	log.Printf("Successfully sent %s notification to Slack (%s).", event.Kind, n.name)
+	return nil
+}
+
+// newPayload lays the message out as a header, the description, the fields
+// and the time. Inline fields are grouped into two-column sections.
+func newPayload(msg message.Message, t time.Time) payload {
+	blocks := []block{{
+		Type: "header",
+		Text: &text{Type: "plain_text", Text: truncate(msg.Title, maxHeaderLen), Emoji: true},
+	}}
+	if msg.Description != "" {
+		blocks = append(blocks, section(msg.Description))
+	}
+
+	var inline []text
+	flush := func() {
+		if len(inline) > 0 {
+			blocks = append(blocks, block{Type: "section", Fields: inline})
+			inline = nil
+		}
+	}
+	for _, field := range msg.Fields {
+		value := "*" + escape(field.Name) + "*\n" + mrkdwn(field.Value)
+		if !field.Inline {
+			flush()
+			blocks = append(blocks, block{Type: "section", Text: &text{Type: "mrkdwn", Text: truncate(value, maxTextLen)}})
+			continue
+		}
+		inline = append(inline, text{Type: "mrkdwn", Text: truncate(value, maxFieldLen)})
+		if len(inline) == maxFieldsPerSection {
+			flush()
+		}
+	}
+	flush()
+
+	if !t.IsZero() {
+		fallback := t.UTC().Format(time.RFC1123)
+		blocks = append(blocks, block{Type: "context", Elements: []text{{
+			Type: "mrkdwn",
+			Text: fmt.Sprintf("<!date^%d^{date_short_pretty} {time_secs}|%s>", t.Unix(), fallback),
+		}}})
+	}
+
+	return payload{
+		Text:        msg.Title,
+		Attachments: []attachment{{Color: fmt.Sprintf("#%06x", msg.Color), Blocks: blocks}},
+	}
+}
+
+func section(s string) block {
+	return block{Type: "section", Text: &text{Type: "mrkdwn", Text: truncate(mrkdwn(s), maxTextLen)}}
+}
+
+// mrkdwn converts the messages' Markdown to Slack's: bold is *text*.
+func mrkdwn(s string) string {
+	return strings.ReplaceAll(escape(s), "**", "*")
+}
+
+// escape escapes the characters Slack treats as control sequences.
+func escape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
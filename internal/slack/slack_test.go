@@ -0,0 +1,130 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"network-monitor/internal/alert"
+	"network-monitor/internal/webhook"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotifierSendsThresholdMessage(t *testing.T) {
+	var received payload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	event := alert.Event{
+		Kind:            alert.KindThresholdExceeded,
+		Interface:       "eth0",
+		Time:            time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+		IntervalSeconds: 60,
+		SpeedMbps:       150,
+		RxMbps:          140,
+		TxMbps:          10,
+		Breaches:        []alert.Breach{{Direction: "total", SpeedMbps: 150, ThresholdMbps: 100}},
+		TopTalkers: []alert.Talker{
+			{IP: "10.0.0.2", SpeedMbps: 10, Hostname: "printer.lan"},
+			{IP: "10.0.0.1", SpeedMbps: 90, RxMbps: 80, TxMbps: 10},
+		},
+		TopFlows: []alert.Flow{{Description: "10.0.0.1:5000 → 1.2.3.4:443 TCP", SpeedMbps: 80, SrcIP: "10.0.0.1", DstIP: "1.2.3.4", DstHost: "video.example.com"}},
+	}
+
+	require.NoError(t, NewNotifier("test", server.URL, nil).Notify(context.Background(), event))
+
+	assert.Equal(t, "🚨 Network Threshold Exceeded!", received.Text)
+	require.Len(t, received.Attachments, 1)
+	assert.Equal(t, "#e74c3c", received.Attachments[0].Color)
+
+	blocks := received.Attachments[0].Blocks
+	var types []string
+	for _, b := range blocks {
+		types = append(types, b.Type)
+	}
+	assert.Equal(t, []string{"header", "section", "section", "section", "section", "context"}, types)
+	assert.Equal(t, "🚨 Network Threshold Exceeded!", blocks[0].Text.Text)
+	assert.Contains(t, blocks[1].Text.Text, "Overall speed of 150.00 Mbps exceeded the 100.00 Mbps threshold.")
+	assert.Equal(t, "*Interface*\neth0", blocks[2].Text.Text)
+
+	var fields []string
+	for _, f := range blocks[3].Fields {
+		fields = append(fields, f.Text)
+	}
+	assert.Equal(t, []string{
+		"*⬇️ Download (rx)*\n140.00 Mbps",
+		"*⬆️ Upload (tx)*\n10.00 Mbps",
+		"*Total*\n150.00 Mbps",
+		"*10.0.0.1*\n90.00 Mbps\n↓ 80.00 / ↑ 10.00 Mbps",
+		"*10.0.0.2 (printer.lan)*\n10.00 Mbps",
+	}, fields)
+	assert.Equal(t, "*Top flows*\n`10.0.0.1:5000 → 1.2.3.4:443 TCP` 80.00 Mbps (10.0.0.1 → video.example.com)", blocks[4].Text.Text)
+	assert.Equal(t, "<!date^1704110400^{date_short_pretty} {time_secs}|Mon, 01 Jan 2024 12:00:00 UTC>", blocks[5].Elements[0].Text)
+}
+
+func TestNotifierSendsInitAndResolved(t *testing.T) {
+	var received []payload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p payload
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&p))
+		received = append(received, p)
+	}))
+	defer server.Close()
+	notifier := NewNotifier("test", server.URL, nil)
+
+	require.NoError(t, notifier.Notify(context.Background(), alert.Event{Kind: alert.KindInit, Interface: "eth0", ThresholdMbps: 100, IntervalSeconds: 60}))
+	require.NoError(t, notifier.Notify(context.Background(), alert.Event{
+		Kind: alert.KindResolved, Interface: "eth0", Duration: 5 * time.Minute, PeakMbps: 180,
+		Breaches: []alert.Breach{{Direction: "rx", SpeedMbps: 40, ThresholdMbps: 100}},
+	}))
+
+	require.Len(t, received, 2)
+	init := received[0].Attachments[0]
+	assert.Equal(t, "#3498db", init.Color)
+	assert.Contains(t, init.Blocks[1].Text.Text, "Monitoring Interface: *eth0*", "bold is converted to mrkdwn")
+
+	resolved := received[1].Attachments[0]
+	assert.Equal(t, "✅ Network Threshold Resolved", resolved.Blocks[0].Text.Text)
+	assert.Equal(t, "Download (rx) speed is back to 40.00 Mbps, within the 100.00 Mbps threshold.", resolved.Blocks[1].Text.Text)
+	require.Len(t, resolved.Blocks[3].Fields, 2)
+	assert.Equal(t, "*Peak*\n180.00 Mbps", resolved.Blocks[3].Fields[1].Text)
+}
+
+func TestNotifierReportsErrors(t *testing.T) {
+	status := http.StatusNotFound
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "30")
+		}
+		w.WriteHeader(status)
+		w.Write([]byte("no_service"))
+	}))
+	defer server.Close()
+	notifier := NewNotifier("test", server.URL, nil)
+
+	err := notifier.Notify(context.Background(), alert.Event{Kind: alert.KindInit})
+	var statusErr *webhook.StatusError
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, "received non-2xx status code from slack: 404 404 Not Found - no_service", err.Error())
+	assert.True(t, statusErr.Permanent())
+
+	status = http.StatusTooManyRequests
+	err = notifier.Notify(context.Background(), alert.Event{Kind: alert.KindInit})
+	var limited *webhook.RateLimitError
+	require.ErrorAs(t, err, &limited)
+	assert.Equal(t, 30*time.Second, limited.RetryAfter())
+}
+
+func TestEscape(t *testing.T) {
+	assert.Equal(t, "a &lt;b&gt; &amp; *c*", mrkdwn("a <b> & **c**"))
+	assert.Equal(t, "abc", truncate("abc", 3))
+	assert.Equal(t, "ab…", truncate("abcd", 3))
+}
@@ -0,0 +1,437 @@
+package storage
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+type Resolution string
+
+const (
+	ResolutionRaw    Resolution = "raw"
+	ResolutionMinute Resolution = "1m"
+	ResolutionHour   Resolution = "1h"
+	ResolutionDay    Resolution = "1d"
+)
+
+// Resolutions lists the stored resolutions from finest to coarsest.
+var Resolutions = []Resolution{ResolutionRaw, ResolutionMinute, ResolutionHour, ResolutionDay}
+
+// Step is the width of one sample at the resolution. Raw samples are as
+// wide as the monitoring interval, so their step is zero.
+func (r Resolution) Step() time.Duration {
+	switch r {
+	case ResolutionMinute:
+		return time.Minute
+	case ResolutionHour:
+		return time.Hour
+	case ResolutionDay:
+		return 24 * time.Hour
+	default:
+		return 0
+	}
+}
+
+func ParseResolution(s string) (Resolution, error) {
+	for _, r := range Resolutions {
+		if string(r) == s {
+			return r, nil
+		}
+	}
+	return "", fmt.Errorf("unknown resolution %q", s)
+}
+
+// Retention is how long samples are kept at each resolution. Zero keeps
+// them forever.
+type Retention struct {
+	Raw    time.Duration
+	Minute time.Duration
+	Hour   time.Duration
+	Day    time.Duration
+}
+
+func (r Retention) For(res Resolution) time.Duration {
+	switch res {
+	case ResolutionMinute:
+		return r.Minute
+	case ResolutionHour:
+		return r.Hour
+	case ResolutionDay:
+		return r.Day
+	default:
+		return r.Raw
+	}
+}
+
+type HostBytes struct {
+	Bytes   int64 `json:"bytes"`
+	RxBytes int64 `json:"rx_bytes,omitempty"`
+	TxBytes int64 `json:"tx_bytes,omitempty"`
+}
+
+// Sample holds the byte counts of one interface for one time slot. For
+// downsampled resolutions Duration is the captured time the slot covers,
+// which can be less than the step if the monitor was not running.
+type Sample struct {
+	Interface string               `json:"interface"`
+	Start     time.Time            `json:"start"`
+	Duration  time.Duration        `json:"duration"`
+	RxBytes   int64                `json:"rx_bytes"`
+	TxBytes   int64                `json:"tx_bytes"`
+	Hosts     map[string]HostBytes `json:"hosts"`
+}
+
+func (s *Sample) TotalBytes() int64 {
+	total := int64(0)
+	for _, host := range s.Hosts {
+		total += host.Bytes
+	}
+	return total
+}
+
+// slotTotals is what is stored under a slot's time key. Host counts are
+// stored next to it, one key per host.
+type slotTotals struct {
+	Duration time.Duration `json:"duration"`
+	RxBytes  int64         `json:"rx_bytes"`
+	TxBytes  int64         `json:"tx_bytes"`
+}
+
+func (h *HostBytes) add(other HostBytes) {
+	h.Bytes += other.Bytes
+	h.RxBytes += other.RxBytes
+	h.TxBytes += other.TxBytes
+}
+
+const pruneEvery = 10 * time.Minute
+
+// Store keeps per-interval host traffic in a bbolt database. Every raw
+// sample is rolled up into the minute, hour and day resolutions as it is
+// written, so each resolution is complete on its own.
+//
+// The database has one top-level bucket per resolution holding one bucket
+// per interface. A slot's totals are keyed by its start time and each of
+// its hosts by the start time followed by the host, so a write only touches
+// the hosts it carries however many the slot has seen.
+type Store struct {
+	db *bolt.DB
+
+	mu        sync.Mutex
+	retention Retention
+	latest    time.Time
+	lastPrune time.Time
+}
+
+func Open(path string, retention Retention) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history database %s: %w", path, err)
+	}
+	return &Store{db: db, retention: retention}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func (s *Store) SetRetention(retention Retention) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retention = retention
+}
+
+// Write stores a raw sample and adds it to the downsampled resolutions.
+// Retention is enforced relative to the newest sample written, so replayed
+// captures are not pruned as soon as they are stored.
+func (s *Store) Write(sample Sample) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		for _, res := range Resolutions {
+			b, err := interfaceBucket(tx, res, sample.Interface)
+			if err != nil {
+				return err
+			}
+
+			start := sample.Start
+			if step := res.Step(); step > 0 {
+				start = start.Truncate(step)
+			}
+			key := timeKey(start)
+
+			var totals slotTotals
+			if err := get(b, key, &totals); err != nil {
+				return fmt.Errorf("corrupt %s sample for %s: %w", res, sample.Interface, err)
+			}
+			totals.Duration += sample.Duration
+			totals.RxBytes += sample.RxBytes
+			totals.TxBytes += sample.TxBytes
+			if err := put(b, key, totals); err != nil {
+				return err
+			}
+
+			for ip, data := range sample.Hosts {
+				hk := hostKey(key, ip)
+				var host HostBytes
+				if err := get(b, hk, &host); err != nil {
+					return fmt.Errorf("corrupt %s sample of %s for %s: %w", res, ip, sample.Interface, err)
+				}
+				host.add(data)
+				if err := put(b, hk, host); err != nil {
+					return err
+				}
+			}
+		}
+
+		if sample.Start.After(s.latest) {
+			s.latest = sample.Start
+		}
+		if s.latest.Sub(s.lastPrune) >= pruneEvery {
+			s.lastPrune = s.latest
+			return s.prune(tx, s.latest)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write history sample: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) prune(tx *bolt.Tx, now time.Time) error {
+	for _, res := range Resolutions {
+		retention := s.retention.For(res)
+		if retention <= 0 {
+			continue
+		}
+		root := tx.Bucket([]byte(res))
+		if root == nil {
+			continue
+		}
+		cutoff := timeKey(now.Add(-retention))
+
+		err := root.ForEachBucket(func(name []byte) error {
+			b := root.Bucket(name)
+			var expired [][]byte
+			c := b.Cursor()
+			for k, _ := c.First(); k != nil && string(k) < string(cutoff); k, _ = c.Next() {
+				expired = append(expired, append([]byte(nil), k...))
+			}
+			for _, k := range expired {
+				if err := b.Delete(k); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to prune %s samples: %w", res, err)
+		}
+	}
+	return nil
+}
+
+// Query selects samples. Empty Interface and Host match everything; an empty
+// Resolution picks the finest one whose retention still covers From.
+type Query struct {
+	Interface  string
+	Host       string
+	From       time.Time
+	To         time.Time
+	Resolution Resolution
+}
+
+// Query returns the samples overlapping [From, To), ordered by start time
+// and interface. When Host is set, samples only carry that host and samples
+// without it are left out.
+func (s *Store) Query(q Query) ([]Sample, error) {
+	res := q.Resolution
+	if res == "" {
+		res = s.ResolutionFor(q.From)
+	}
+	if q.To.IsZero() {
+		q.To = time.Now()
+	}
+	from := q.From
+	if step := res.Step(); step > 0 {
+		from = from.Truncate(step)
+	}
+	fromKey, toKey := timeKey(from), timeKey(q.To)
+
+	var samples []Sample
+	err := s.db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte(res))
+		if root == nil {
+			return nil
+		}
+		return root.ForEachBucket(func(name []byte) error {
+			if q.Interface != "" && string(name) != q.Interface {
+				return nil
+			}
+			// Host keys follow the totals of their slot, so each slot is
+			// complete when the next one starts.
+			var current *Sample
+			done := func() {
+				if current != nil && (q.Host == "" || len(current.Hosts) > 0) {
+					samples = append(samples, *current)
+				}
+				current = nil
+			}
+			c := root.Bucket(name).Cursor()
+			for k, v := c.Seek(fromKey); k != nil && string(k) < string(toKey); k, v = c.Next() {
+				if len(k) == timeKeyLen {
+					done()
+					var totals slotTotals
+					if err := json.Unmarshal(v, &totals); err != nil {
+						return fmt.Errorf("corrupt %s sample for %s: %w", res, name, err)
+					}
+					current = &Sample{
+						Interface: string(name),
+						Start:     keyTime(k),
+						Duration:  totals.Duration,
+						RxBytes:   totals.RxBytes,
+						TxBytes:   totals.TxBytes,
+						Hosts:     make(map[string]HostBytes),
+					}
+					continue
+				}
+
+				ip := string(k[timeKeyLen:])
+				if current == nil || (q.Host != "" && ip != q.Host) {
+					continue
+				}
+				var host HostBytes
+				if err := json.Unmarshal(v, &host); err != nil {
+					return fmt.Errorf("corrupt %s sample of %s for %s: %w", res, ip, name, err)
+				}
+				current.Hosts[ip] = host
+			}
+			done()
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(samples, func(i, j int) bool {
+		if !samples[i].Start.Equal(samples[j].Start) {
+			return samples[i].Start.Before(samples[j].Start)
+		}
+		return samples[i].Interface < samples[j].Interface
+	})
+	return samples, nil
+}
+
+type HostTotal struct {
+	Host string `json:"host"`
+	HostBytes
+}
+
+// TopHosts sums the traffic of every host over the query range and returns
+// the n hosts that sent the most bytes. n <= 0 returns all of them.
+func (s *Store) TopHosts(q Query, n int) ([]HostTotal, error) {
+	samples, err := s.Query(q)
+	if err != nil {
+		return nil, err
+	}
+
+	totals := make(map[string]*HostTotal)
+	for _, sample := range samples {
+		for ip, data := range sample.Hosts {
+			total, ok := totals[ip]
+			if !ok {
+				total = &HostTotal{Host: ip}
+				totals[ip] = total
+			}
+			total.Bytes += data.Bytes
+			total.RxBytes += data.RxBytes
+			total.TxBytes += data.TxBytes
+		}
+	}
+
+	result := make([]HostTotal, 0, len(totals))
+	for _, total := range totals {
+		result = append(result, *total)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Bytes != result[j].Bytes {
+			return result[i].Bytes > result[j].Bytes
+		}
+		return result[i].Host < result[j].Host
+	})
+	if n > 0 && len(result) > n {
+		result = result[:n]
+	}
+	return result, nil
+}
+
+// ResolutionFor returns the finest resolution whose retention still covers
+// from. Query uses it when no resolution is given.
+func (s *Store) ResolutionFor(from time.Time) Resolution {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.latest
+	if now.IsZero() {
+		now = time.Now()
+	}
+	for _, res := range Resolutions {
+		retention := s.retention.For(res)
+		if retention <= 0 || !from.Before(now.Add(-retention)) {
+			return res
+		}
+	}
+	return ResolutionDay
+}
+
+func interfaceBucket(tx *bolt.Tx, res Resolution, interfaceName string) (*bolt.Bucket, error) {
+	root, err := tx.CreateBucketIfNotExists([]byte(res))
+	if err != nil {
+		return nil, err
+	}
+	return root.CreateBucketIfNotExists([]byte(interfaceName))
+}
+
+const timeKeyLen = 8
+
+// timeKey encodes t so that keys sort chronologically.
+func timeKey(t time.Time) []byte {
+	key := make([]byte, timeKeyLen)
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	return key
+}
+
+func keyTime(key []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(key[:timeKeyLen]))).UTC()
+}
+
+// hostKey is the key of a host's counts in the slot at key. It sorts after
+// the slot's totals and before the next slot.
+func hostKey(key []byte, ip string) []byte {
+	return append(append(make([]byte, 0, len(key)+len(ip)), key...), ip...)
+}
+
+// get decodes the value at key into v, leaving v as it is if there is none.
+func get(b *bolt.Bucket, key []byte, v any) error {
+	data := b.Get(key)
+	if data == nil {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
+
+func put(b *bolt.Bucket, key []byte, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, data)
+}
@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+var base = time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)
+
+func openTestStore(t *testing.T, retention Retention) *Store {
+	t.Helper()
+	store, err := Open(filepath.Join(t.TempDir(), "history.db"), retention)
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func sample(iface string, start time.Time, hosts map[string]HostBytes) Sample {
+	return Sample{Interface: iface, Start: start, Duration: 30 * time.Second, Hosts: hosts}
+}
+
+func TestStoreWriteAndDownsample(t *testing.T) {
+	store := openTestStore(t, Retention{})
+
+	require.NoError(t, store.Write(sample("eth0", base, map[string]HostBytes{
+		"10.0.0.1": {Bytes: 100, TxBytes: 100},
+		"10.0.0.2": {Bytes: 50},
+	})))
+	require.NoError(t, store.Write(sample("eth0", base.Add(30*time.Second), map[string]HostBytes{
+		"10.0.0.1": {Bytes: 300, TxBytes: 200},
+	})))
+	require.NoError(t, store.Write(sample("eth0", base.Add(90*time.Second), map[string]HostBytes{
+		"10.0.0.2": {Bytes: 10},
+	})))
+	require.NoError(t, store.Write(sample("wlan0", base, map[string]HostBytes{
+		"10.0.1.1": {Bytes: 7},
+	})))
+
+	raw, err := store.Query(Query{Interface: "eth0", From: base, To: base.Add(time.Hour), Resolution: ResolutionRaw})
+	require.NoError(t, err)
+	require.Len(t, raw, 3)
+	assert.Equal(t, base.Add(30*time.Second), raw[1].Start)
+
+	minutes, err := store.Query(Query{Interface: "eth0", From: base, To: base.Add(time.Hour), Resolution: ResolutionMinute})
+	require.NoError(t, err)
+	require.Len(t, minutes, 2)
+	assert.Equal(t, time.Minute, minutes[0].Duration)
+	assert.Equal(t, HostBytes{Bytes: 400, TxBytes: 300}, minutes[0].Hosts["10.0.0.1"])
+	assert.Equal(t, int64(450), minutes[0].TotalBytes())
+
+	hours, err := store.Query(Query{From: base, To: base.Add(time.Hour), Resolution: ResolutionHour})
+	require.NoError(t, err)
+	require.Len(t, hours, 2)
+	assert.Equal(t, "eth0", hours[0].Interface)
+	assert.Equal(t, int64(460), hours[0].TotalBytes())
+	assert.Equal(t, "wlan0", hours[1].Interface)
+
+	host, err := store.Query(Query{Host: "10.0.0.2", From: base, To: base.Add(time.Hour), Resolution: ResolutionRaw})
+	require.NoError(t, err)
+	require.Len(t, host, 2)
+	assert.Len(t, host[0].Hosts, 1)
+}
+
+func TestStoreWriteKeysHosts(t *testing.T) {
+	store := openTestStore(t, Retention{})
+	for i := 0; i < 3; i++ {
+		require.NoError(t, store.Write(sample("eth0", base.Add(time.Duration(i)*time.Minute), map[string]HostBytes{
+			"a":                   {Bytes: 1},
+			fmt.Sprintf("b%d", i): {Bytes: 10},
+		})))
+	}
+
+	// The hour slot holds its totals and one key per host it has seen.
+	err := store.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(ResolutionHour)).Bucket([]byte("eth0"))
+		assert.Equal(t, 1+4, b.Stats().KeyN)
+		assert.JSONEq(t, `{"bytes":3}`, string(b.Get(hostKey(timeKey(base), "a"))))
+		return nil
+	})
+	require.NoError(t, err)
+
+	hours, err := store.Query(Query{From: base, To: base.Add(time.Hour), Resolution: ResolutionHour})
+	require.NoError(t, err)
+	require.Len(t, hours, 1)
+	assert.Equal(t, 90*time.Second, hours[0].Duration)
+	assert.Len(t, hours[0].Hosts, 4)
+	assert.Equal(t, int64(33), hours[0].TotalBytes())
+}
+
+func TestStoreTopHosts(t *testing.T) {
+	store := openTestStore(t, Retention{})
+	require.NoError(t, store.Write(sample("eth0", base, map[string]HostBytes{"a": {Bytes: 5}, "b": {Bytes: 50}})))
+	require.NoError(t, store.Write(sample("eth0", base.Add(time.Minute), map[string]HostBytes{"a": {Bytes: 100}})))
+	require.NoError(t, store.Write(sample("eth0", base.Add(2*time.Hour), map[string]HostBytes{"c": {Bytes: 1000}})))
+
+	top, err := store.TopHosts(Query{From: base, To: base.Add(time.Hour)}, 1)
+	require.NoError(t, err)
+	require.Len(t, top, 1)
+	assert.Equal(t, "a", top[0].Host)
+	assert.Equal(t, int64(105), top[0].Bytes)
+}
+
+func TestStoreRetention(t *testing.T) {
+	store := openTestStore(t, Retention{Raw: time.Hour, Minute: 24 * time.Hour})
+
+	require.NoError(t, store.Write(sample("eth0", base, map[string]HostBytes{"a": {Bytes: 1}})))
+	require.NoError(t, store.Write(sample("eth0", base.Add(3*time.Hour), map[string]HostBytes{"a": {Bytes: 2}})))
+
+	raw, err := store.Query(Query{From: base, To: base.Add(4 * time.Hour), Resolution: ResolutionRaw})
+	require.NoError(t, err)
+	require.Len(t, raw, 1, "raw samples older than the retention are pruned")
+	assert.Equal(t, base.Add(3*time.Hour), raw[0].Start)
+
+	minutes, err := store.Query(Query{From: base, To: base.Add(4 * time.Hour), Resolution: ResolutionMinute})
+	require.NoError(t, err)
+	assert.Len(t, minutes, 2)
+
+	// Without an explicit resolution, a range the raw data no longer
+	// covers is answered from the minute rollups.
+	auto, err := store.Query(Query{From: base, To: base.Add(4 * time.Hour)})
+	require.NoError(t, err)
+	assert.Len(t, auto, 2)
+}
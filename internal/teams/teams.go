@@ -0,0 +1,178 @@
+// Package teams sends notifications to Microsoft Teams incoming webhooks
+// (Workflows or the older connectors) as Adaptive Cards.
+package teams
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"network-monitor/internal/alert"
+	"network-monitor/internal/message"
+	"network-monitor/internal/webhook"
+	"strings"
+	"time"
+)
+
+type fact struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+// element is an Adaptive Card TextBlock or FactSet.
+type element struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	Weight   string `json:"weight,omitempty"`
+	Size     string `json:"size,omitempty"`
+	Color    string `json:"color,omitempty"`
+	IsSubtle bool   `json:"isSubtle,omitempty"`
+	Wrap     bool   `json:"wrap,omitempty"`
+	Spacing  string `json:"spacing,omitempty"`
+	Facts    []fact `json:"facts,omitempty"`
+}
+
+type card struct {
+	Schema  string            `json:"$schema"`
+	Type    string            `json:"type"`
+	Version string            `json:"version"`
+	Body    []element         `json:"body"`
+	MSTeams map[string]string `json:"msteams"`
+}
+
+type attachment struct {
+	ContentType string `json:"contentType"`
+	Content     card   `json:"content"`
+}
+
+type payload struct {
+	Type        string       `json:"type"`
+	Attachments []attachment `json:"attachments"`
+}
+
+type Notifier struct {
+	name       string
+	webhookURL string
+	templates  *message.Templates
+	client     *http.Client
+}
+
+// NewNotifier returns a notifier posting to the Teams webhook at webhookURL.
+// templates may be nil to send the built-in messages.
+func NewNotifier(name, webhookURL string, templates *message.Templates) *Notifier {
+	return &Notifier{
+		name:       name,
+		webhookURL: webhookURL,
+		templates:  templates,
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (n *Notifier) Name() string {
+	return n.name
+}
+
+func (n *Notifier) Notify(ctx context.Context, event alert.Event) error {
+	if n.webhookURL == "" {
+		return fmt.Errorf("webhook URL is empty, skipping notification")
+	}
+
+	msg, err := n.templates.Render(event)
+	if err != nil {
+		return err
+	}
+	if err := webhook.Post(ctx, n.client, "teams", n.webhookURL, newPayload(msg, event.Time)); err != nil {
+		return err
+	}
+
+	log.Printf("Successfully sent %s notification to Teams (%s).", event.Kind, n.name)
+	return nil
+}
+
+// newPayload lays the message out as a card with the title in the
+// message's colour, the description, inline fields as a fact set and other
+// fields as headed paragraphs.
+func newPayload(msg message.Message, t time.Time) payload {
+	body := []element{{
+		Type: "TextBlock", Text: msg.Title, Weight: "Bolder", Size: "Large", Color: color(msg.Color), Wrap: true,
+	}}
+	if msg.Description != "" {
+		body = append(body, element{Type: "TextBlock", Text: markdown(msg.Description), Wrap: true})
+	}
+
+	var facts []fact
+	flush := func() {
+		if len(facts) > 0 {
+			body = append(body, element{Type: "FactSet", Facts: facts})
+			facts = nil
+		}
+	}
+	for _, field := range msg.Fields {
+		if field.Inline {
+			facts = append(facts, fact{Title: field.Name, Value: markdown(field.Value)})
+			continue
+		}
+		flush()
+		body = append(body,
+			element{Type: "TextBlock", Text: field.Name, Weight: "Bolder", Wrap: true, Spacing: "Medium"},
+			element{Type: "TextBlock", Text: markdown(field.Value), Wrap: true, Spacing: "None"},
+		)
+	}
+	flush()
+
+	if !t.IsZero() {
+		ts := t.UTC().Format(time.RFC3339)
+		body = append(body, element{
+			Type: "TextBlock", Text: fmt.Sprintf("{{DATE(%s, SHORT)}} {{TIME(%s)}}", ts, ts), Size: "Small", IsSubtle: true, Wrap: true,
+		})
+	}
+
+	return payload{
+		Type: "message",
+		Attachments: []attachment{{
+			ContentType: "application/vnd.microsoft.card.adaptive",
+			Content: card{
+				Schema:  "http://adaptivecards.io/schemas/adaptive-card.json",
+				Type:    "AdaptiveCard",
+				Version: "1.4",
+				Body:    body,
+				MSTeams: map[string]string{"width": "Full"},
+			},
+		}},
+	}
+}
+
+// markdown adapts the messages' Markdown to what cards render: code spans
+// are not supported and a single newline does not break the line.
+func markdown(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "`", ""), "\n", "\n\n")
+}
+
+// palette maps the built-in colours to the card colours, which are named.
+var palette = []struct {
+	rgb  int
+	name string
+}{
+	{message.ColorAlert, "Attention"},
+	{message.ColorDown, "Attention"},
+	{message.ColorWarning, "Warning"},
+	{message.ColorResolved, "Good"},
+	{message.ColorInfo, "Accent"},
+}
+
+// color returns the card colour closest to rgb.
+func color(rgb int) string {
+	var best string
+	bestDist := -1
+	for _, c := range palette {
+		dist := 0
+		for shift := 0; shift <= 16; shift += 8 {
+			d := (rgb>>shift)&0xFF - (c.rgb>>shift)&0xFF
+			dist += d * d
+		}
+		if bestDist < 0 || dist < bestDist {
+			best, bestDist = c.name, dist
+		}
+	}
+	return best
+}
@@ -0,0 +1,108 @@
+package teams
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"network-monitor/internal/alert"
+	"network-monitor/internal/message"
+	"network-monitor/internal/webhook"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotifierSendsThresholdCard(t *testing.T) {
+	var received payload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	event := alert.Event{
+		Kind:            alert.KindThresholdExceeded,
+		Interface:       "eth0",
+		Time:            time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+		IntervalSeconds: 60,
+		SpeedMbps:       150,
+		RxMbps:          140,
+		TxMbps:          10,
+		Breaches:        []alert.Breach{{Direction: "total", SpeedMbps: 150, ThresholdMbps: 100}},
+		TopTalkers:      []alert.Talker{{IP: "10.0.0.1", SpeedMbps: 90, Hostname: "nas.lan"}},
+		TopFlows:        []alert.Flow{{Description: "10.0.0.1:5000 → 1.2.3.4:443 TCP", SpeedMbps: 80}},
+	}
+
+	require.NoError(t, NewNotifier("test", server.URL, nil).Notify(context.Background(), event))
+
+	assert.Equal(t, "message", received.Type)
+	require.Len(t, received.Attachments, 1)
+	assert.Equal(t, "application/vnd.microsoft.card.adaptive", received.Attachments[0].ContentType)
+	card := received.Attachments[0].Content
+	assert.Equal(t, "AdaptiveCard", card.Type)
+
+	body := card.Body
+	require.Len(t, body, 8)
+	assert.Equal(t, element{Type: "TextBlock", Text: "🚨 Network Threshold Exceeded!", Weight: "Bolder", Size: "Large", Color: "Attention", Wrap: true}, body[0])
+	assert.Equal(t, "Overall speed of 150.00 Mbps exceeded the 100.00 Mbps threshold.\n\nMeasured over the last 60 seconds.\n\nTop 1 talkers:", body[1].Text)
+	assert.Equal(t, "Interface", body[2].Text)
+	assert.Equal(t, "eth0", body[3].Text)
+	assert.Equal(t, "FactSet", body[4].Type)
+	assert.Equal(t, []fact{
+		{Title: "⬇️ Download (rx)", Value: "140.00 Mbps"},
+		{Title: "⬆️ Upload (tx)", Value: "10.00 Mbps"},
+		{Title: "Total", Value: "150.00 Mbps"},
+		{Title: "10.0.0.1 (nas.lan)", Value: "90.00 Mbps"},
+	}, body[4].Facts)
+	assert.Equal(t, "Top flows", body[5].Text)
+	assert.Equal(t, "10.0.0.1:5000 → 1.2.3.4:443 TCP 80.00 Mbps", body[6].Text)
+
+	require.NoError(t, NewNotifier("test", server.URL, nil).Notify(context.Background(), alert.Event{
+		Kind: alert.KindInit, Interface: "eth0", Time: event.Time, ThresholdMbps: 100, IntervalSeconds: 60,
+	}))
+	body = received.Attachments[0].Content.Body
+	assert.Equal(t, "Accent", body[0].Color)
+	assert.Contains(t, body[1].Text, "Monitoring Interface: **eth0**")
+	assert.Equal(t, "{{DATE(2024-01-01T12:00:00Z, SHORT)}} {{TIME(2024-01-01T12:00:00Z)}}", body[len(body)-1].Text)
+}
+
+func TestNotifierSendsResolvedCard(t *testing.T) {
+	var received payload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+	}))
+	defer server.Close()
+
+	require.NoError(t, NewNotifier("test", server.URL, nil).Notify(context.Background(), alert.Event{
+		Kind: alert.KindResolved, ResolvedKind: alert.KindNoTraffic, Interface: "eth0", Duration: 10 * time.Minute,
+	}))
+	body := received.Attachments[0].Content.Body
+	assert.Equal(t, "✅ Network Traffic Resumed", body[0].Text)
+	assert.Equal(t, "Good", body[0].Color)
+	assert.Equal(t, "Packets are being captured again.", body[1].Text)
+	assert.Equal(t, []fact{{Title: "Duration", Value: "10m0s"}}, body[4].Facts)
+}
+
+func TestNotifierReportsErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Webhook Bad Request", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	err := NewNotifier("test", server.URL, nil).Notify(context.Background(), alert.Event{Kind: alert.KindInit})
+	var statusErr *webhook.StatusError
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, "teams", statusErr.Service)
+	assert.True(t, statusErr.Permanent())
+}
+
+func TestColor(t *testing.T) {
+	assert.Equal(t, "Warning", color(message.ColorWarning))
+	assert.Equal(t, "Attention", color(0xFF0000))
+	assert.Equal(t, "Good", color(0x00FF00))
+	assert.Equal(t, "Accent", color(0x0000FF))
+}
@@ -0,0 +1,261 @@
+package top
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"network-monitor/internal/analysis"
+)
+
+type SortKey string
+
+const (
+	SortTotal SortKey = "total"
+	SortRx    SortKey = "rx"
+	SortTx    SortKey = "tx"
+	SortBytes SortKey = "bytes"
+	SortHost  SortKey = "host"
+)
+
+func ParseSortKey(s string) (SortKey, error) {
+	switch key := SortKey(s); key {
+	case SortTotal, SortRx, SortTx, SortBytes, SortHost:
+		return key, nil
+	}
+	return "", fmt.Errorf("unknown sort key %q (want total, rx, tx, bytes or host)", s)
+}
+
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+type hostStats struct {
+	ip            string
+	speed, rx, tx float64
+	bytes         int64
+	history       []float64
+	lastSeen      int
+}
+
+// Table accumulates interval results into per-host rates and renders them.
+// It keeps a short history of every host's total rate for the sparklines and
+// forgets hosts once they have been idle for the whole history.
+type Table struct {
+	Interface string
+	Sort      SortKey
+	Paused    bool
+	Finished  bool
+
+	historyLen int
+	intervals  int
+	hosts      map[string]*hostStats
+
+	speed, rx, tx float64
+	packetsPerSec float64
+	totalBytes    int64
+}
+
+func NewTable(interfaceName string, sortKey SortKey, historyLen int) *Table {
+	return &Table{
+		Interface:  interfaceName,
+		Sort:       sortKey,
+		historyLen: historyLen,
+		hosts:      make(map[string]*hostStats),
+	}
+}
+
+// Add folds one interval into the table.
+func (t *Table) Add(result *analysis.IntervalResult) {
+	t.intervals++
+	d := result.Duration
+	t.speed = analysis.CalculateSpeedMbps(result.TotalBytes(), d)
+	t.rx = analysis.CalculateSpeedMbps(result.RxBytes, d)
+	t.tx = analysis.CalculateSpeedMbps(result.TxBytes, d)
+	t.packetsPerSec = 0
+	if d > 0 {
+		t.packetsPerSec = float64(result.Packets) / d.Seconds()
+	}
+	t.totalBytes += result.TotalBytes()
+
+	for ip, data := range result.Hosts {
+		host, ok := t.hosts[ip]
+		if !ok {
+			host = &hostStats{ip: ip}
+			t.hosts[ip] = host
+		}
+		host.lastSeen = t.intervals
+		host.bytes += data.Bytes
+	}
+
+	for ip, host := range t.hosts {
+		if t.intervals-host.lastSeen >= t.historyLen {
+			delete(t.hosts, ip)
+			continue
+		}
+		host.speed, host.rx, host.tx = 0, 0, 0
+		if data, ok := result.Hosts[ip]; ok {
+			host.speed = analysis.CalculateSpeedMbps(data.Bytes, d)
+			host.rx = analysis.CalculateSpeedMbps(data.RxBytes, d)
+			host.tx = analysis.CalculateSpeedMbps(data.TxBytes, d)
+		}
+		host.history = append(host.history, host.speed)
+		if len(host.history) > t.historyLen {
+			host.history = host.history[len(host.history)-t.historyLen:]
+		}
+	}
+}
+
+func (t *Table) sorted() []*hostStats {
+	hosts := make([]*hostStats, 0, len(t.hosts))
+	for _, host := range t.hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Slice(hosts, func(i, j int) bool {
+		a, b := hosts[i], hosts[j]
+		var x, y float64
+		switch t.Sort {
+		case SortHost:
+			return compareIPs(a.ip, b.ip) < 0
+		case SortRx:
+			x, y = a.rx, b.rx
+		case SortTx:
+			x, y = a.tx, b.tx
+		case SortBytes:
+			x, y = float64(a.bytes), float64(b.bytes)
+		default:
+			x, y = a.speed, b.speed
+		}
+		if x != y {
+			return x > y
+		}
+		return compareIPs(a.ip, b.ip) < 0
+	})
+	return hosts
+}
+
+func compareIPs(a, b string) int {
+	ipA, ipB := net.ParseIP(a), net.ParseIP(b)
+	if ipA == nil || ipB == nil {
+		return strings.Compare(a, b)
+	}
+	if a4, b4 := ipA.To4(), ipB.To4(); (a4 == nil) != (b4 == nil) {
+		if a4 != nil {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(string(ipA.To16()), string(ipB.To16()))
+}
+
+// Render draws the table for a terminal of the given size. Every line ends
+// with an erase-to-end-of-line sequence and lines are separated by "\r\n",
+// so a frame can be drawn over the previous one in raw mode.
+func (t *Table) Render(w io.Writer, width, height int, refresh time.Duration) {
+	var lines []string
+
+	status := ""
+	switch {
+	case t.Finished:
+		status = "  [capture finished]"
+	case t.Paused:
+		status = "  [paused]"
+	}
+	lines = append(lines,
+		fmt.Sprintf("network-monitor top — %s   refresh %s   sort: %s%s", t.Interface, refresh, t.Sort, status),
+		fmt.Sprintf("Total %8.2f Mbps   Rx %8.2f Mbps   Tx %8.2f Mbps   %8.0f pkt/s   %d hosts   %s captured",
+			t.speed, t.rx, t.tx, t.packetsPerSec, len(t.hosts), formatBytes(t.totalBytes)),
+		"",
+	)
+
+	const fixed = 40 + 3*12 + 12
+	sparkWidth := width - fixed - 2
+	if sparkWidth > t.historyLen {
+		sparkWidth = t.historyLen
+	}
+	header := fmt.Sprintf("%-40s%12s%12s%12s%12s", "HOST", "TOTAL Mbps", "RX Mbps", "TX Mbps", "BYTES")
+	if sparkWidth > 0 {
+		header += "  HISTORY"
+	}
+	lines = append(lines, header)
+
+	hosts := t.sorted()
+	peak := 0.0
+	for _, host := range hosts {
+		for _, v := range host.history {
+			peak = max(peak, v)
+		}
+	}
+
+	rows := height - len(lines) - 1
+	for i, host := range hosts {
+		if height > 0 && i >= rows {
+			break
+		}
+		line := fmt.Sprintf("%-40s%12.2f%12.2f%12.2f%12s", truncate(host.ip, 39), host.speed, host.rx, host.tx, formatBytes(host.bytes))
+		if sparkWidth > 0 {
+			line += "  " + sparkline(host.history, sparkWidth, peak)
+		}
+		lines = append(lines, line)
+	}
+	if len(hosts) == 0 {
+		lines = append(lines, "(waiting for traffic)")
+	}
+
+	for len(lines) < height-1 {
+		lines = append(lines, "")
+	}
+	lines = append(lines, "keys: t total  r rx  x tx  b bytes  h host  p pause  q quit")
+
+	for i, line := range lines {
+		if width > 0 {
+			line = truncate(line, width)
+		}
+		fmt.Fprintf(w, "%s\x1b[K", line)
+		if i < len(lines)-1 {
+			fmt.Fprint(w, "\r\n")
+		}
+	}
+}
+
+// sparkline draws the last width values scaled against peak, so rows can be
+// compared with each other.
+func sparkline(values []float64, width int, peak float64) string {
+	if len(values) > width {
+		values = values[len(values)-width:]
+	}
+	var b strings.Builder
+	for i := len(values); i < width; i++ {
+		b.WriteRune(' ')
+	}
+	for _, v := range values {
+		level := 0
+		if peak > 0 {
+			level = int(v / peak * float64(len(sparkBlocks)-1))
+		}
+		b.WriteRune(sparkBlocks[min(max(level, 0), len(sparkBlocks)-1)])
+	}
+	return b.String()
+}
+
+func truncate(s string, width int) string {
+	runes := []rune(s)
+	if len(runes) <= width {
+		return s
+	}
+	return string(runes[:width])
+}
+
+func formatBytes(n int64) string {
+	const unit = 1000
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "kMGTPE"[exp])
+}
@@ -0,0 +1,94 @@
+package top
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"network-monitor/internal/analysis"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func interval(hosts map[string]*analysis.TrafficData) *analysis.IntervalResult {
+	result := &analysis.IntervalResult{Duration: time.Second, Hosts: hosts, Packets: 10}
+	for _, data := range hosts {
+		result.RxBytes += data.RxBytes
+		result.TxBytes += data.TxBytes
+	}
+	return result
+}
+
+func TestTableSorting(t *testing.T) {
+	table := NewTable("eth0", SortTotal, 10)
+	table.Add(interval(map[string]*analysis.TrafficData{
+		"192.168.1.10": {Bytes: 125_000, TxBytes: 125_000},
+		"192.168.1.9":  {Bytes: 250_000, RxBytes: 500_000},
+		"1.1.1.1":      {Bytes: 500_000},
+	}))
+
+	order := func() []string {
+		var ips []string
+		for _, host := range table.sorted() {
+			ips = append(ips, host.ip)
+		}
+		return ips
+	}
+
+	assert.Equal(t, []string{"1.1.1.1", "192.168.1.9", "192.168.1.10"}, order())
+	table.Sort = SortRx
+	assert.Equal(t, "192.168.1.9", order()[0])
+	table.Sort = SortTx
+	assert.Equal(t, "192.168.1.10", order()[0])
+	table.Sort = SortHost
+	assert.Equal(t, []string{"1.1.1.1", "192.168.1.9", "192.168.1.10"}, order(), "hosts sort numerically")
+
+	host := table.hosts["192.168.1.9"]
+	assert.InDelta(t, 2.0, host.speed, 1e-9)
+	assert.InDelta(t, 4.0, host.rx, 1e-9)
+}
+
+func TestTableExpiresIdleHosts(t *testing.T) {
+	table := NewTable("eth0", SortTotal, 3)
+	table.Add(interval(map[string]*analysis.TrafficData{"10.0.0.1": {Bytes: 1000}}))
+	for i := 0; i < 2; i++ {
+		table.Add(interval(map[string]*analysis.TrafficData{"10.0.0.2": {Bytes: 1000}}))
+	}
+	require.Contains(t, table.hosts, "10.0.0.1")
+	assert.Equal(t, []float64{0.008, 0, 0}, table.hosts["10.0.0.1"].history)
+
+	table.Add(interval(map[string]*analysis.TrafficData{"10.0.0.2": {Bytes: 1000}}))
+	assert.NotContains(t, table.hosts, "10.0.0.1", "idle for the whole history")
+	assert.Equal(t, int64(4000), table.totalBytes)
+}
+
+func TestTableRender(t *testing.T) {
+	table := NewTable("eth0", SortTotal, 60)
+	table.Add(interval(map[string]*analysis.TrafficData{"10.0.0.1": {Bytes: 1_000_000}}))
+	table.Add(interval(map[string]*analysis.TrafficData{"10.0.0.1": {Bytes: 2_000_000}}))
+
+	var buf bytes.Buffer
+	table.Render(&buf, 120, 10, 500*time.Millisecond)
+	lines := strings.Split(buf.String(), "\r\n")
+	require.Len(t, lines, 10, "the frame fills the terminal height")
+	assert.Contains(t, lines[0], "eth0")
+	assert.Contains(t, lines[0], "refresh 500ms")
+	assert.Contains(t, lines[4], "10.0.0.1")
+	assert.Contains(t, lines[4], "16.00")
+	assert.Contains(t, lines[4], "3.0 MB")
+	assert.Contains(t, lines[4], "▄█")
+	assert.Contains(t, lines[9], "q quit")
+}
+
+func TestSparkline(t *testing.T) {
+	assert.Equal(t, "  ▁▄█", sparkline([]float64{0, 4, 8}, 5, 8))
+	assert.Equal(t, "▁█", sparkline([]float64{8, 0, 8}, 2, 8))
+}
+
+func TestFormatBytes(t *testing.T) {
+	assert.Equal(t, "999 B", formatBytes(999))
+	assert.Equal(t, "1.5 kB", formatBytes(1500))
+	assert.Equal(t, "2.0 GB", formatBytes(2_000_000_000))
+}
@@ -0,0 +1,119 @@
+package top
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"network-monitor/internal/analysis"
+
+	"golang.org/x/term"
+)
+
+const (
+	enterAltScreen = "\x1b[?1049h\x1b[?25l"
+	exitAltScreen  = "\x1b[?25h\x1b[?1049l"
+	cursorHome     = "\x1b[H"
+	clearBelow     = "\x1b[J"
+)
+
+type Options struct {
+	// Refresh is the interval length used for the aggregator, and therefore
+	// how often the screen is redrawn.
+	Refresh time.Duration
+	Sort    SortKey
+	// History is the number of intervals kept for the sparklines.
+	History int
+}
+
+// Run draws every interval result on the terminal until ctx is cancelled or
+// the user presses q. When results are exhausted (a replayed file has been
+// read) the last frame stays on screen until the user quits.
+func Run(ctx context.Context, interfaceName string, results <-chan *analysis.IntervalResult, opts Options) error {
+	out := os.Stdout
+	if !term.IsTerminal(int(out.Fd())) {
+		return errors.New("top needs an interactive terminal")
+	}
+
+	keys := make(chan byte)
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			return err
+		}
+		defer term.Restore(fd, state)
+		go readKeys(os.Stdin, keys)
+	}
+
+	w := bufio.NewWriter(out)
+	w.WriteString(enterAltScreen)
+	defer func() {
+		w.WriteString(exitAltScreen)
+		w.Flush()
+	}()
+
+	table := NewTable(interfaceName, opts.Sort, opts.History)
+	draw := func() {
+		width, height, err := term.GetSize(int(out.Fd()))
+		if err != nil {
+			width, height = 120, 40
+		}
+		w.WriteString(cursorHome)
+		table.Render(w, width, height, opts.Refresh)
+		w.WriteString(clearBelow)
+		w.Flush()
+	}
+	draw()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case result, ok := <-results:
+			if !ok {
+				results = nil
+				table.Finished = true
+				draw()
+				continue
+			}
+			table.Add(result)
+			if !table.Paused {
+				draw()
+			}
+
+		case key := <-keys:
+			switch key {
+			case 'q', 'Q', 3: // 3 is Ctrl+C, which raw mode delivers as a key.
+				return nil
+			case 'p', ' ':
+				table.Paused = !table.Paused
+			case 't':
+				table.Sort = SortTotal
+			case 'r':
+				table.Sort = SortRx
+			case 'x':
+				table.Sort = SortTx
+			case 'b':
+				table.Sort = SortBytes
+			case 'h':
+				table.Sort = SortHost
+			default:
+				continue
+			}
+			draw()
+		}
+	}
+}
+
+func readKeys(in *os.File, keys chan<- byte) {
+	buf := make([]byte, 1)
+	for {
+		if _, err := in.Read(buf); err != nil {
+			return
+		}
+		keys <- buf[0]
+	}
+}
@@ -0,0 +1,212 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"network-monitor/internal/alert"
+	"network-monitor/internal/message"
+	"os"
+	"strconv"
+	"time"
+)
+
+// SchemaVersion is the version of Payload. It changes only when a field is
+// removed or changes meaning; new fields may be added at any time.
+const SchemaVersion = 1
+
+// Headers set on every request of the generic webhook.
+const (
+	TimestampHeader = "X-Network-Monitor-Timestamp"
+	SignatureHeader = "X-Network-Monitor-Signature"
+	VersionHeader   = "X-Network-Monitor-Schema-Version"
+)
+
+// Payload is the body the generic webhook posts. See the README for the
+// documented schema.
+type Payload struct {
+	Version int `json:"version"`
+	// ID identifies the event. It stays the same when a delivery is retried,
+	// so receivers can drop duplicates.
+	ID string `json:"id"`
+	// Host is the name of the machine the monitor runs on.
+	Host string `json:"host"`
+
+	Kind            alert.Kind        `json:"kind"`
+	ResolvedKind    alert.Kind        `json:"resolved_kind,omitempty"`
+	Time            time.Time         `json:"time"`
+	Interface       string            `json:"interface"`
+	IntervalSeconds int               `json:"interval_seconds"`
+	ThresholdMbps   float64           `json:"threshold_mbps"`
+	SpeedMbps       float64           `json:"speed_mbps"`
+	RxMbps          float64           `json:"rx_mbps"`
+	TxMbps          float64           `json:"tx_mbps"`
+	PeakMbps        float64           `json:"peak_mbps"`
+	DurationSeconds float64           `json:"duration_seconds"`
+	Breaches        []alert.Breach    `json:"breaches"`
+	TopTalkers      []alert.Talker    `json:"top_talkers"`
+	TopFlows        []alert.Flow      `json:"top_flows"`
+	Rule            *alert.RuleBreach `json:"rule,omitempty"`
+	Summary         *alert.Summary    `json:"summary,omitempty"`
+	Message         Message           `json:"message"`
+}
+
+// Message is the rendered notification text, as chat notifiers show it.
+type Message struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description"`
+	Color       string         `json:"color"`
+	Fields      []MessageField `json:"fields"`
+}
+
+type MessageField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+// Options configure the generic webhook.
+type Options struct {
+	URL string
+	// Headers are added to every request.
+	Headers map[string]string
+	// BearerToken, if set, is sent as "Authorization: Bearer <token>".
+	BearerToken string
+	// Secret, if set, signs every request with HMAC-SHA256.
+	Secret string
+}
+
+// Notifier posts events to any HTTP endpoint as a Payload.
+type Notifier struct {
+	name      string
+	opts      Options
+	host      string
+	templates *message.Templates
+	client    *http.Client
+	now       func() time.Time
+}
+
+// NewNotifier returns a generic webhook notifier. templates may be nil to
+// send the built-in messages.
+func NewNotifier(name string, opts Options, templates *message.Templates) *Notifier {
+	host, _ := os.Hostname()
+	return &Notifier{
+		name:      name,
+		opts:      opts,
+		host:      host,
+		templates: templates,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		now:       time.Now,
+	}
+}
+
+func (n *Notifier) Name() string {
+	return n.name
+}
+
+func (n *Notifier) Notify(ctx context.Context, event alert.Event) error {
+	if n.opts.URL == "" {
+		return fmt.Errorf("webhook URL is empty, skipping notification")
+	}
+
+	msg, err := n.templates.Render(event)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(n.payload(event, msg))
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook payload: %w", err)
+	}
+
+	header := make(http.Header)
+	for key, value := range n.opts.Headers {
+		header.Set(key, value)
+	}
+	header.Set("User-Agent", "network-monitor")
+	header.Set(VersionHeader, strconv.Itoa(SchemaVersion))
+	if n.opts.BearerToken != "" {
+		header.Set("Authorization", "Bearer "+n.opts.BearerToken)
+	}
+	if n.opts.Secret != "" {
+		timestamp := strconv.FormatInt(n.now().Unix(), 10)
+		header.Set(TimestampHeader, timestamp)
+		header.Set(SignatureHeader, Sign(n.opts.Secret, timestamp, body))
+	}
+
+	if err := PostBody(ctx, n.client, "webhook", n.opts.URL, body, header); err != nil {
+		return err
+	}
+
+	log.Printf("Successfully sent %s notification to webhook (%s).", event.Kind, n.name)
+	return nil
+}
+
+func (n *Notifier) payload(event alert.Event, msg message.Message) Payload {
+	p := Payload{
+		Version:         SchemaVersion,
+		ID:              eventID(event),
+		Host:            n.host,
+		Kind:            event.Kind,
+		ResolvedKind:    event.ResolvedKind,
+		Time:            event.Time.UTC(),
+		Interface:       event.Interface,
+		IntervalSeconds: event.IntervalSeconds,
+		ThresholdMbps:   event.ThresholdMbps,
+		SpeedMbps:       event.SpeedMbps,
+		RxMbps:          event.RxMbps,
+		TxMbps:          event.TxMbps,
+		PeakMbps:        event.PeakMbps,
+		DurationSeconds: event.Duration.Seconds(),
+		Breaches:        nonNil(event.Breaches),
+		TopTalkers:      nonNil(event.TopTalkers),
+		TopFlows:        nonNil(event.TopFlows),
+		Rule:            event.Rule,
+		Message: Message{
+			Title:       msg.Title,
+			Description: msg.Description,
+			Color:       fmt.Sprintf("#%06x", msg.Color),
+			Fields:      []MessageField{},
+		},
+	}
+	if event.Summary != nil {
+		summary := *event.Summary
+		summary.From, summary.To = summary.From.UTC(), summary.To.UTC()
+		p.Summary = &summary
+	}
+	for _, field := range msg.Fields {
+		p.Message.Fields = append(p.Message.Fields, MessageField{Name: field.Name, Value: field.Value, Inline: field.Inline})
+	}
+	return p
+}
+
+// nonNil makes empty lists encode as [] rather than null.
+func nonNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
+
+// eventID derives the ID from the event itself, so that it is the same on
+// every attempt, including after a restart.
+func eventID(event alert.Event) string {
+	data, _ := json.Marshal(event)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16])
+}
+
+// Sign returns the signature header value for a request: "sha256=" and the
+// hex HMAC-SHA256, keyed with secret, of the timestamp header value, a dot
+// and the body.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
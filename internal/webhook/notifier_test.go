@@ -0,0 +1,109 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"network-monitor/internal/alert"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotifierSendsSignedPayload(t *testing.T) {
+	const secret = "s3cret"
+	var requests []*http.Request
+	var bodies [][]byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		requests = append(requests, r)
+		bodies = append(bodies, body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	notifier := NewNotifier("receiver", Options{
+		URL:         server.URL,
+		Headers:     map[string]string{"x-team": "netops"},
+		BearerToken: "tok",
+		Secret:      secret,
+	}, nil)
+	notifier.now = func() time.Time { return time.Unix(1704110460, 0) }
+
+	event := alert.Event{
+		Kind:            alert.KindThresholdExceeded,
+		Interface:       "eth0",
+		Time:            time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+		IntervalSeconds: 60,
+		ThresholdMbps:   100,
+		SpeedMbps:       150,
+		RxMbps:          140,
+		TxMbps:          10,
+		Duration:        90 * time.Second,
+		Breaches:        []alert.Breach{{Direction: "total", SpeedMbps: 150, ThresholdMbps: 100}},
+		TopTalkers:      []alert.Talker{{IP: "10.0.0.1", SpeedMbps: 90, Hostname: "nas.lan"}},
+	}
+	require.NoError(t, notifier.Notify(context.Background(), event))
+	require.NoError(t, notifier.Notify(context.Background(), event))
+	require.Len(t, requests, 2)
+
+	r := requests[0]
+	assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+	assert.Equal(t, "Bearer tok", r.Header.Get("Authorization"))
+	assert.Equal(t, "netops", r.Header.Get("X-Team"))
+	assert.Equal(t, "1", r.Header.Get(VersionHeader))
+	assert.Equal(t, "1704110460", r.Header.Get(TimestampHeader))
+
+	// Verified the way the README tells receivers to.
+	want := Sign(secret, r.Header.Get(TimestampHeader), bodies[0])
+	assert.True(t, hmac.Equal([]byte(want), []byte(r.Header.Get(SignatureHeader))))
+	assert.Regexp(t, "^sha256=[0-9a-f]{64}$", r.Header.Get(SignatureHeader))
+	assert.NotEqual(t, Sign("wrong", r.Header.Get(TimestampHeader), bodies[0]), r.Header.Get(SignatureHeader))
+
+	var payload map[string]any
+	require.NoError(t, json.Unmarshal(bodies[0], &payload))
+	assert.Equal(t, float64(1), payload["version"])
+	assert.Equal(t, "threshold_exceeded", payload["kind"])
+	assert.Equal(t, "2024-01-01T12:00:00Z", payload["time"])
+	assert.Equal(t, "eth0", payload["interface"])
+	assert.Equal(t, float64(90), payload["duration_seconds"])
+	assert.Equal(t, []any{}, payload["top_flows"], "empty lists are [] rather than null")
+	assert.Equal(t, "nas.lan", payload["top_talkers"].([]any)[0].(map[string]any)["hostname"])
+	msg := payload["message"].(map[string]any)
+	assert.Equal(t, "🚨 Network Threshold Exceeded!", msg["title"])
+	assert.Equal(t, "#e74c3c", msg["color"])
+	assert.Equal(t, map[string]any{"name": "Interface", "value": "eth0", "inline": false}, msg["fields"].([]any)[0])
+
+	var again Payload
+	require.NoError(t, json.Unmarshal(bodies[1], &again))
+	assert.Equal(t, payload["id"], again.ID, "retries carry the same id")
+	assert.Len(t, again.ID, 32)
+	require.NoError(t, notifier.Notify(context.Background(), alert.Event{Kind: alert.KindResolved, Time: event.Time}))
+	var other Payload
+	require.NoError(t, json.Unmarshal(bodies[2], &other))
+	assert.NotEqual(t, again.ID, other.ID)
+}
+
+func TestNotifierWithoutSecret(t *testing.T) {
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+	}))
+	defer server.Close()
+
+	require.NoError(t, NewNotifier("plain", Options{URL: server.URL}, nil).Notify(context.Background(), alert.Event{Kind: alert.KindInit}))
+	assert.Empty(t, header.Get(SignatureHeader))
+	assert.Empty(t, header.Get(TimestampHeader))
+	assert.Empty(t, header.Get("Authorization"))
+}
+
+func TestSign(t *testing.T) {
+	// echo -n '1704110460.{"kind":"init"}' | openssl dgst -sha256 -hmac s3cret
+	assert.Equal(t, "sha256=c351e95d7cd46662042ae572c594cafb422bd42f2e566f9971fcc4445988e93f", Sign("s3cret", "1704110460", []byte(`{"kind":"init"}`)))
+}
@@ -0,0 +1,93 @@
+// Package webhook posts JSON payloads to incoming webhooks and turns failed
+// responses into errors the notification queue knows how to retry. Its
+// Notifier sends alerts to any HTTP endpoint in a documented schema.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// StatusError is a non-2xx response other than a rate limit.
+type StatusError struct {
+	Service    string
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("received non-2xx status code from %s: %d %s - %s", e.Service, e.StatusCode, e.Status, e.Body)
+}
+
+// Permanent reports whether retrying cannot help: the request was rejected,
+// e.g. because the webhook was deleted.
+func (e *StatusError) Permanent() bool {
+	return e.StatusCode >= 400 && e.StatusCode < 500 && e.StatusCode != http.StatusRequestTimeout
+}
+
+// RateLimitError means the service answered 429 Too Many Requests.
+type RateLimitError struct {
+	Service string
+	Wait    time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s rate limit reached, retry in %s", e.Service, e.Wait.Round(time.Millisecond))
+}
+
+func (e *RateLimitError) RetryAfter() time.Duration {
+	return e.Wait
+}
+
+// Post sends payload as JSON to url. service names the receiving end in
+// errors.
+func Post(ctx context.Context, client *http.Client, service, url string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s payload: %w", service, err)
+	}
+	return PostBody(ctx, client, service, url, body, nil)
+}
+
+// PostBody sends an encoded JSON body to url with the extra headers.
+func PostBody(ctx context.Context, client *http.Client, service, url string, body []byte, header http.Header) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create http request: %w", err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send %s notification: %w", service, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return &RateLimitError{Service: service, Wait: retryAfter(resp.Header)}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		bodyBytes, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &StatusError{Service: service, StatusCode: resp.StatusCode, Status: resp.Status, Body: string(bodyBytes)}
+	}
+	return nil
+}
+
+// retryAfter reads the Retry-After header in seconds, or waits a second if
+// it is missing.
+func retryAfter(header http.Header) time.Duration {
+	if v, err := strconv.ParseFloat(header.Get("Retry-After"), 64); err == nil && v > 0 {
+		return time.Duration(v * float64(time.Second))
+	}
+	return time.Second
+}
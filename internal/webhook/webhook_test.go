@@ -0,0 +1,46 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPost(t *testing.T) {
+	status := http.StatusNoContent
+	var received map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "1.5")
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	post := func() error {
+		return Post(context.Background(), server.Client(), "chat", server.URL, map[string]string{"text": "hi"})
+	}
+
+	require.NoError(t, post())
+	assert.Equal(t, map[string]string{"text": "hi"}, received)
+
+	status = http.StatusTooManyRequests
+	var limited *RateLimitError
+	require.ErrorAs(t, post(), &limited)
+	assert.Equal(t, 1500*time.Millisecond, limited.RetryAfter())
+
+	status = http.StatusBadGateway
+	var statusErr *StatusError
+	require.ErrorAs(t, post(), &statusErr)
+	assert.False(t, statusErr.Permanent(), "server errors are retried")
+	assert.Contains(t, statusErr.Error(), "from chat: 502")
+
+	assert.Equal(t, time.Second, retryAfter(http.Header{}), "a 429 without a delay still waits")
+}